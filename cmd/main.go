@@ -8,11 +8,17 @@ import (
 	"syscall"
 	"time"
 
+	"asum/internal/account"
+	"asum/internal/admin"
+	"asum/internal/alert"
 	"asum/internal/auth"
 	"asum/internal/ip2"
 	"asum/internal/notify"
 	"asum/internal/task"
 	"asum/internal/user"
+	"asum/internal/watch"
+	"asum/internal/webhook"
+	"asum/pkg/apikey"
 	"asum/pkg/config"
 	"asum/pkg/db"
 	"asum/pkg/engine"
@@ -20,9 +26,15 @@ import (
 	"asum/pkg/mailer"
 	"asum/pkg/maxmind"
 	"asum/pkg/middleware"
+	"asum/pkg/oidc"
+	"asum/pkg/pagination"
 	"asum/pkg/queue"
+	"asum/pkg/rbac"
 	"asum/pkg/rdb"
+	"asum/pkg/session"
 	"asum/pkg/token"
+	"asum/pkg/totp"
+	hook "asum/pkg/webhook"
 	"asum/pkg/wshub"
 
 	_ "asum/docs"
@@ -43,11 +55,16 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
+// @securityDefinitions.apikey ApiKey
+// @in header
+// @name X-API-Key
+// @description Task API key; "Authorization: ApiKey <key>" or "?key=" are also accepted.
 
 func main() {
 	logx.Set()
 
 	conf := mustLoadConfig()
+	pagination.Configure(conf.Cursor)
 
 	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -58,7 +75,14 @@ func main() {
 	app := appEngine.App()
 	installMiddlewares(app)
 
-	mailConsumer, notifyHub := wireRoutes(runCtx, conf, infra, app)
+	keyStore := apikey.NewStore(infra.pg, infra.redis)
+	perms := rbac.NewStore(infra.pg, infra.redis)
+	sessions := session.NewStore(infra.pg, infra.redis, ip2.Locate(ip2.NewRepository(infra.mm)))
+	middleware.UseSessions(sessions)
+	denylist := token.NewDenylist(infra.redis)
+	middleware.UseDenylist(denylist)
+	jwtMgr := token.NewManager(conf.JWT, infra.redis)
+	mailConsumer, notifyHub, svcs := wireRoutes(runCtx, conf, infra, keyStore, perms, sessions, denylist, jwtMgr, app)
 
 	g, ctx := errgroup.WithContext(runCtx)
 
@@ -77,6 +101,50 @@ func main() {
 		return nil
 	})
 
+	g.Go(func() error {
+		return svcs.task.RunKeyReaper(ctx, time.Minute)
+	})
+
+	g.Go(func() error {
+		return svcs.task.RunTrashPurger(ctx, time.Hour)
+	})
+
+	g.Go(func() error {
+		return svcs.account.RunPurger(ctx, time.Hour)
+	})
+
+	g.Go(func() error {
+		return svcs.alert.RunEvaluator(ctx, time.Minute)
+	})
+
+	g.Go(func() error {
+		return svcs.watch.RunScheduler(ctx, time.Minute)
+	})
+
+	g.Go(func() error {
+		return keyStore.RunChecker(ctx, 10*time.Minute)
+	})
+
+	g.Go(func() error {
+		return svcs.hooks.RunWorker(ctx, runtime.NumCPU())
+	})
+
+	g.Go(func() error {
+		return perms.RunSubscriber(ctx, 5*time.Minute)
+	})
+
+	g.Go(func() error {
+		return sessions.RunCleaner(ctx, time.Hour)
+	})
+
+	g.Go(func() error {
+		return denylist.Run(ctx, 10*time.Minute)
+	})
+
+	g.Go(func() error {
+		return jwtMgr.Run(ctx, 10*time.Minute)
+	})
+
 	// http server
 	g.Go(func() error {
 		return appEngine.Run(ctx)
@@ -87,6 +155,15 @@ func main() {
 	}
 }
 
+// backgroundSvcs 为需要在后台运行定时任务的服务
+type backgroundSvcs struct {
+	task    task.Service
+	alert   alert.Service
+	watch   watch.Service
+	account account.Service
+	hooks   *hook.Dispatcher
+}
+
 type infraDeps struct {
 	pg    *db.DB
 	redis *rdb.Client
@@ -162,8 +239,13 @@ func wireRoutes(
 	runCtx context.Context,
 	conf *config.Config,
 	infra infraDeps,
+	keyStore *apikey.Store,
+	perms *rbac.Store,
+	sessions *session.Store,
+	denylist *token.Denylist,
+	jwtMgr *token.Manager,
 	app *fiber.App,
-) (*auth.Consumer, *wshub.Hub) {
+) (*auth.Consumer, *wshub.Hub, backgroundSvcs) {
 
 	// swagger
 	app.Get("/swagger/*", adaptor.HTTPHandler(httpSwagger.WrapHandler))
@@ -174,42 +256,95 @@ func wireRoutes(
 		return c.SendString("ok")
 	})
 	// wire services
-	userRepo := user.NewRepository(infra.pg, infra.redis)
+	keyHasher, err := apikey.NewHasher(conf.ApiKey)
+	if err != nil {
+		panic(err)
+	}
+
+	userRepo := user.NewRepository(infra.pg, infra.redis, keyHasher, keyStore)
 	userSvc := user.NewService(userRepo)
 	userHandler := user.NewHandler(userSvc)
 
-	jwtMgr := token.NewManager(conf.JWT)
 	emailQueue := queue.NewRedisQueue[*auth.EmailJob](infra.redis, "queue:emails")
 	mailConsumer := auth.NewConsumer(emailQueue, infra.mail, runtime.NumCPU())
 
+	hooks := hook.NewDispatcher(infra.pg, infra.redis)
+
 	taskRepo := task.NewRepository(infra.pg)
-	taskSvc := task.NewService(taskRepo, userRepo)
+	if err := apikey.MigratePlaintext(runCtx, infra.pg, keyStore, keyHasher); err != nil {
+		panic(err)
+	}
+	taskSvc := task.NewService(taskRepo, userRepo, infra.redis, keyHasher, keyStore, emailQueue, hooks, conf.BaseURL, conf.Trash.Retention())
 	taskHandler := task.NewHandler(taskSvc)
 
-	authSvc := auth.NewService(userRepo, emailQueue, jwtMgr, infra.redis, conf.BaseURL)
+	alertRepo := alert.NewRepository(infra.pg)
+	alertSvc := alert.NewService(alertRepo, userRepo, taskRepo, infra.redis, emailQueue, hooks)
+	alertHandler := alert.NewHandler(alertSvc)
+
+	totpCipher, err := totp.NewCipher(conf.MFA)
+	if err != nil {
+		panic(err)
+	}
+	oauthRegistry, err := oidc.NewRegistry(conf.OAuth, conf.BaseURL+"/v1/auth/oauth")
+	if err != nil {
+		panic(err)
+	}
+	authSvc := auth.NewService(userRepo, auth.NewMFARepository(infra.pg), auth.NewIdentityRepository(infra.pg), oauthRegistry, totpCipher, emailQueue, jwtMgr, sessions, denylist, infra.redis, conf.BaseURL)
 	authHandler := auth.NewHandler(authSvc)
+	auth.RegisterWellKnown(app, authHandler)
+
+	accountRepo := account.NewRepository(infra.pg)
+	accountSvc := account.NewService(accountRepo, userRepo, taskSvc, perms, sessions, infra.redis, emailQueue, conf.BaseURL, conf.Deletion.CoolingOff())
+	accountHandler := account.NewHandler(accountSvc)
+
+	adminRepo := admin.NewRepository(infra.pg)
+	if err := adminRepo.Promote(runCtx, conf.Admin.Emails); err != nil {
+		panic(err)
+	}
+	adminSvc := admin.NewService(adminRepo, userRepo, authSvc, jwtMgr, perms, sessions, infra.redis)
+	adminHandler := admin.NewHandler(adminSvc)
 
 	ip2Repo := ip2.NewRepository(infra.mm)
-	ip2Svc := ip2.NewService(ip2Repo, userRepo, taskRepo)
+	ip2Svc := ip2.NewService(ip2Repo, userRepo, taskRepo, hooks)
 	ip2Handler := ip2.NewHandler(ip2Svc)
 
+	watchRepo := watch.NewRepository(infra.pg)
+	watchSvc := watch.NewService(watchRepo, taskRepo, ip2Repo, infra.mm, infra.redis, hooks)
+	watchHandler := watch.NewHandler(watchSvc)
+
+	webhookRepo := webhook.NewRepository(infra.pg)
+	webhookSvc := webhook.NewService(webhookRepo, taskRepo, hooks)
+	webhookHandler := webhook.NewHandler(webhookSvc)
+
 	notifyHub := wshub.New()
 	notifyWS := notify.NewWSHandler(runCtx, notifyHub, infra.redis)
+	inboxHandler := notify.NewInboxHandler(infra.redis)
 
 	// routes
 	v1 := app.Group("/v1")
 
 	authGroup := v1.Group("/auth")
-	auth.RegisterRoutes(authGroup, authHandler)
+	auth.RegisterRoutes(authGroup, authHandler, middleware.Auth(jwtMgr, infra.redis))
+	account.RegisterPublicRoutes(v1, accountHandler)
+	task.RegisterPublicRoutes(v1, taskHandler)
 
 	ipGroup := v1.Group("/ip")
-	ipGroup.Use(middleware.RateLimitAndAuthMiddleware(runCtx, infra.redis))
-	ip2.RegisterRoutes(ipGroup, ip2Handler)
+	ipGroup.Use(middleware.ApiKeyAuth(runCtx, infra.redis, keyHasher))
+	ip2.RegisterRoutes(ipGroup, ip2Handler, middleware.NewLimiter(runCtx, infra.redis))
 
 	appGroup := v1.Group("/app")
-	appGroup.Use(middleware.Auth(conf.JWT.Secret))
+	appGroup.Use(middleware.Auth(jwtMgr, infra.redis))
 	user.RegisterRoutes(appGroup, userHandler)
-	task.RegisterRoutes(appGroup, taskHandler)
+	account.RegisterRoutes(appGroup, accountHandler)
+	auth.RegisterMFARoutes(appGroup, authHandler)
+	task.RegisterRoutes(appGroup, taskHandler, perms)
+	alert.RegisterRoutes(appGroup, alertHandler)
+	watch.RegisterRoutes(appGroup, watchHandler)
+	webhook.RegisterRoutes(appGroup, webhookHandler)
+	notify.RegisterRoutes(appGroup, inboxHandler)
+
+	adminGroup := appGroup.Group("/admin")
+	admin.RegisterRoutes(adminGroup, adminHandler, perms)
 
 	notifyGroup := v1.Group("/notify")
 	notifyGroup.Use("/ws", func(c fiber.Ctx) error {
@@ -218,10 +353,10 @@ func wireRoutes(
 		}
 		return fiber.ErrUpgradeRequired
 	})
-	notifyGroup.Use("/ws", middleware.Auth(conf.JWT.Secret))
+	notifyGroup.Use("/ws", middleware.Auth(jwtMgr, infra.redis))
 	notifyGroup.Get("/ws", websocket.New(func(c *websocket.Conn) {
 		notifyWS.Handle(c)
 	}))
 
-	return mailConsumer, notifyHub
+	return mailConsumer, notifyHub, backgroundSvcs{task: taskSvc, alert: alertSvc, watch: watchSvc, account: accountSvc, hooks: hooks}
 }
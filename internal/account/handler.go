@@ -0,0 +1,335 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"asum/internal/user"
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{service: svc}
+}
+
+// Export 导出账号数据
+// @Summary 导出账号数据
+// @Description 返回 zip 压缩包，包含 profile、logs、tasks、usage、notifications 五个 JSON 文件；每分钟最多导出一次。
+// @Tags Account
+// @Produce application/zip
+// @Security Bearer
+// @Success 200 {file} file "压缩包"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 429 {object} engine.Response "导出过于频繁"
+// @Router /app/user/me/export [get]
+func (h *Handler) Export(c *engine.Ctx) error {
+	userID := utils.GetUserID(c)
+	data, err := h.service.Export(c.StdCtx, userID)
+	if err != nil {
+		if errors.Is(err, errorx.ErrExportTooFrequent) {
+			return c.Fail(fiber.StatusTooManyRequests, err)
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="asum-export-%d-%s.zip"`, userID, time.Now().UTC().Format("20060102")))
+	return c.Send(data)
+}
+
+// GetDeletion 查看注销申请
+// @Summary 查看注销申请
+// @Description status 0 待邮件确认 / 1 冷静期中，purgeAt 为彻底删除的时间。
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=models.AccountDeletion} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 404 {object} engine.Response "没有进行中的注销申请"
+// @Router /app/user/me/deletion [get]
+func (h *Handler) GetDeletion(c *engine.Ctx) error {
+	data, err := h.service.Deletion(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusNotFound, err.Error())
+	}
+	return c.OK(data)
+}
+
+// RequestDeletion 申请注销账号
+// @Summary 申请注销账号
+// @Description 校验当前密码后向账号邮箱发送确认链接，确认后进入冷静期，期满彻底删除账号、日志、作为所有者的任务以及相关缓存。
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body DeletionReq true "当前密码"
+// @Success 200 {object} engine.Response{data=models.AccountDeletion} "已发送确认邮件"
+// @Failure 400 {object} engine.Response "密码错误或已确认注销"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能申请注销"
+// @Router /app/user/me/deletion [post]
+func (h *Handler) RequestDeletion(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req DeletionReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.RequestDeletion(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		if errors.Is(err, user.ErrWrongPassword) || errors.Is(err, errorx.ErrDeletionScheduled) {
+			return c.Fail(fiber.StatusBadRequest, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// ConfirmDeletion 确认注销账号
+// @Summary 确认注销账号
+// @Description token 来自确认邮件，可放在 query 或 body 中。
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param token query string false "邮件中的 token"
+// @Param request body ConfirmDeletionReq false "邮件中的 token"
+// @Success 200 {object} engine.Response{data=models.AccountDeletion} "已进入冷静期"
+// @Failure 400 {object} engine.Response "token 无效或已过期"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能确认注销"
+// @Failure 404 {object} engine.Response "没有进行中的注销申请"
+// @Router /app/user/me/deletion/confirm [post]
+func (h *Handler) ConfirmDeletion(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	req := ConfirmDeletionReq{Token: c.Query("token")}
+	if req.Token == "" && len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+		}
+	}
+
+	data, err := h.service.ConfirmDeletion(c.StdCtx, utils.GetUserID(c), req.Token)
+	if err != nil {
+		if errors.Is(err, errorx.ErrDeletionNotFound) {
+			return c.Fail(fiber.StatusNotFound, err.Error())
+		}
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	}
+	return c.OK(data)
+}
+
+// ConfirmDeletionPage 邮件中的注销确认链接
+// @Summary 注销确认页
+// @Description 确认邮件中的链接打开的页面，只展示确认按钮，不会注销账号；点击后以 POST 提交到同一地址。
+// @Tags Account
+// @Produce html
+// @Param token query string true "邮件中的 token"
+// @Success 200 {string} string "确认页"
+// @Router /account/deletion/confirm [get]
+func (h *Handler) ConfirmDeletionPage(c *engine.Ctx) error {
+	return c.ConfirmPage("确认注销账号", "确认后账号进入冷静期，冷静期结束后账号及其数据将被彻底删除；冷静期内登录即可撤销。", "确认注销")
+}
+
+// ConfirmDeletionLink 通过邮件链接确认注销账号
+// @Summary 通过邮件链接确认注销账号
+// @Description 只凭 token 确认，无需登录，由注销确认页提交；确认后进入冷静期，冷静期内登录后可撤销。
+// @Tags Account
+// @Produce json
+// @Param token query string true "邮件中的 token"
+// @Success 200 {object} engine.Response{data=models.AccountDeletion} "已进入冷静期"
+// @Failure 400 {object} engine.Response "token 无效或已过期"
+// @Router /account/deletion/confirm [post]
+func (h *Handler) ConfirmDeletionLink(c *engine.Ctx) error {
+	data, err := h.service.ConfirmDeletionByLink(c.StdCtx, c.Query("token"))
+	if err != nil {
+		if errors.Is(err, errorx.ErrTokenInvalid) {
+			return c.Fail(fiber.StatusBadRequest, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// CancelDeletion 撤销注销申请
+// @Summary 撤销注销申请
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response "撤销成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 404 {object} engine.Response "没有进行中的注销申请"
+// @Router /app/user/me/deletion [delete]
+func (h *Handler) CancelDeletion(c *engine.Ctx) error {
+	if err := h.service.CancelDeletion(c.StdCtx, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusNotFound, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// RequestEmailChange 申请修改邮箱
+// @Summary 申请修改邮箱
+// @Description 校验当前密码后向新邮箱发送确认链接（24 小时内有效），同时向旧邮箱发送通知，通知中的撤销链接 7 天内有效；确认前账号邮箱不变。
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body EmailChangeReq true "新邮箱与当前密码"
+// @Success 200 {object} engine.Response{data=EmailChangeResp} "已发送确认邮件"
+// @Failure 400 {object} engine.Response "邮箱格式错误、与当前邮箱相同或密码错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能修改邮箱"
+// @Failure 409 {object} engine.Response "邮箱已被占用"
+// @Failure 429 {object} engine.Response "请求过于频繁"
+// @Router /app/user/me/email [post]
+func (h *Handler) RequestEmailChange(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req EmailChangeReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.RequestEmailChange(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidEmail), errors.Is(err, errorx.ErrSameEmail), errors.Is(err, user.ErrWrongPassword):
+			return c.Fail(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, errorx.ErrEmailTaken):
+			return c.Fail(fiber.StatusConflict, err.Error())
+		case errors.Is(err, errorx.ErrTooManyRequests):
+			return c.Fail(fiber.StatusTooManyRequests, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// ConfirmEmailChange 确认修改邮箱
+// @Summary 确认修改邮箱
+// @Description 新邮箱中的确认链接，确认后邮箱立即生效，此前签发的所有令牌失效。
+// @Tags Account
+// @Produce json
+// @Param token query string true "邮件中的 token"
+// @Success 200 {object} engine.Response{data=EmailChangeResult} "修改成功"
+// @Failure 400 {object} engine.Response "token 无效或已过期"
+// @Failure 409 {object} engine.Response "邮箱已被占用或账号邮箱已变化"
+// @Router /account/email/confirm [get]
+func (h *Handler) ConfirmEmailChange(c *engine.Ctx) error {
+	data, err := h.service.ConfirmEmailChange(c.StdCtx, c.Query("token"))
+	if err != nil {
+		return h.failEmailChange(c, err)
+	}
+	return c.OK(data)
+}
+
+// RevertEmailChange 撤销修改邮箱
+// @Summary 撤销修改邮箱
+// @Description 旧邮箱通知中的撤销链接：未确认的申请直接取消，已确认的恢复为旧邮箱；两种情况都会使此前签发的所有令牌失效。
+// @Tags Account
+// @Produce json
+// @Param token query string true "邮件中的 token"
+// @Success 200 {object} engine.Response{data=EmailChangeResult} "撤销成功"
+// @Failure 400 {object} engine.Response "token 无效或已过期"
+// @Failure 409 {object} engine.Response "旧邮箱已被占用或账号邮箱已变化"
+// @Router /account/email/revert [get]
+func (h *Handler) RevertEmailChange(c *engine.Ctx) error {
+	data, err := h.service.RevertEmailChange(c.StdCtx, c.Query("token"))
+	if err != nil {
+		return h.failEmailChange(c, err)
+	}
+	return c.OK(data)
+}
+
+func (h *Handler) failEmailChange(c *engine.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errorx.ErrTokenInvalid):
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, errorx.ErrEmailTaken), errors.Is(err, errorx.ErrEmailChangeStale):
+		return c.Fail(fiber.StatusConflict, err.Error())
+	}
+	return c.Fail(fiber.StatusInternalServerError, err.Error())
+}
+
+// ListSessions 查看登录设备
+// @Summary 查看登录设备
+// @Description 返回仍然有效的登录会话，最近活跃的在前；current 标记当前请求所用的会话，location 由登录 IP 推断。
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]models.Session} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me/sessions [get]
+func (h *Handler) ListSessions(c *engine.Ctx) error {
+	data, err := h.service.Sessions(c.StdCtx, utils.GetUserID(c), utils.GetSessionID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// RevokeSession 退出指定设备
+// @Summary 退出指定设备
+// @Description 撤销后该会话签发的 access token 与 refresh token 立即失效。
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Param id path string true "会话 ID"
+// @Success 200 {object} engine.Response "撤销成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能管理会话"
+// @Failure 404 {object} engine.Response "会话不存在或已失效"
+// @Router /app/user/me/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	if err := h.service.RevokeSession(c.StdCtx, utils.GetUserID(c), c.Params("id")); err != nil {
+		if errors.Is(err, errorx.ErrSessionNotFound) {
+			return c.Fail(fiber.StatusNotFound, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// RevokeSessions 退出其他设备
+// @Summary 退出其他设备
+// @Description 默认保留当前会话；all=true 时当前会话也一并退出。
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Param all query bool false "是否包括当前会话"
+// @Success 200 {object} engine.Response{data=RevokeSessionsResp} "撤销成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能管理会话"
+// @Router /app/user/me/sessions [delete]
+func (h *Handler) RevokeSessions(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	except := utils.GetSessionID(c)
+	if fiber.Query[bool](c, "all") {
+		except = ""
+	}
+	data, err := h.service.RevokeSessions(c.StdCtx, utils.GetUserID(c), except)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
@@ -0,0 +1,87 @@
+package account
+
+import (
+	"asum/internal/notify"
+	"asum/internal/user"
+	"asum/pkg/models"
+	"asum/pkg/usage"
+	"strconv"
+	"time"
+)
+
+const (
+	deletionTokenExpiry = 24 * time.Hour
+	purgeBatch          = 50
+
+	// exportInterval 内同一用户只能导出一次
+	exportInterval = time.Minute
+
+	emailChangeExpiry   = 24 * time.Hour
+	emailRevertExpiry   = 7 * 24 * time.Hour
+	emailChangeInterval = time.Minute
+)
+
+func exportRateKey(uid uint64) string {
+	return "account:export:" + strconv.FormatUint(uid, 10)
+}
+
+func emailChangeRateKey(uid uint64) string {
+	return "account:email-change:" + strconv.FormatUint(uid, 10)
+}
+
+type EmailChangeReq struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type EmailChangeResp struct {
+	NewEmail  string    `json:"newEmail"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type EmailChangeResult struct {
+	Message string `json:"message"`
+	Email   string `json:"email"`
+}
+
+type DeletionReq struct {
+	// Password 为当前密码，防止会话被盗用后直接申请注销
+	Password string `json:"password"`
+}
+
+type ConfirmDeletionReq struct {
+	Token string `json:"token"`
+}
+
+// ExportProfile 为导出的账号资料，不含密码哈希
+type ExportProfile struct {
+	ID        uint64            `json:"id"`
+	Name      string            `json:"name"`
+	Email     string            `json:"email"`
+	Level     string            `json:"level"`
+	Quota     int               `json:"quota"`
+	Status    models.UserStatus `json:"status"`
+	Role      models.UserRole   `json:"role"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	LoginAt   *time.Time        `json:"loginAt,omitempty"`
+}
+
+// ExportUsage 为最近 usage.RetentionDays 天的每日调用量
+type ExportUsage struct {
+	User  []usage.Daily            `json:"user"`
+	Tasks map[uint64][]usage.Daily `json:"tasks"`
+}
+
+// archive 为导出压缩包中的各个文件
+type archive struct {
+	Profile       ExportProfile
+	Logs          []models.UserLog
+	Tasks         []user.MyTask
+	Usage         ExportUsage
+	Notifications []notify.InboxItem
+}
+
+type RevokeSessionsResp struct {
+	Revoked int `json:"revoked"`
+}
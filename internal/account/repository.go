@@ -0,0 +1,175 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(ctx context.Context, d *models.AccountDeletion) error
+	Update(ctx context.Context, d *models.AccountDeletion) error
+	// FindActive 返回用户待确认或已排期的注销申请
+	FindActive(ctx context.Context, userID uint64) (*models.AccountDeletion, error)
+	// FindPendingByToken 按确认邮件中 token 的哈希查找待确认的注销申请
+	FindPendingByToken(ctx context.Context, hash string) (*models.AccountDeletion, error)
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.AccountDeletion, error)
+
+	// CreateEmailChange 创建修改邮箱申请，同时取消该用户尚未确认的申请
+	CreateEmailChange(ctx context.Context, ch *models.EmailChange) error
+	FindEmailChangeByConfirm(ctx context.Context, hash string) (*models.EmailChange, error)
+	FindEmailChangeByRevert(ctx context.Context, hash string) (*models.EmailChange, error)
+	UpdateEmailChange(ctx context.Context, ch *models.EmailChange) error
+	// ApplyEmailChange 在同一事务中把用户邮箱从 from 改为 to，并把状态仍为 prev 的申请更新为 ch
+	ApplyEmailChange(ctx context.Context, ch *models.EmailChange, prev models.EmailChangeStatus, from, to string) error
+}
+
+type repository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	if err := db.AutoMigrate(&models.AccountDeletion{}, &models.EmailChange{}); err != nil {
+		panic(err)
+	}
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, d *models.AccountDeletion) error {
+	return r.db.WithContext(ctx).Create(d).Error
+}
+
+func (r *repository) Update(ctx context.Context, d *models.AccountDeletion) error {
+	return r.db.WithContext(ctx).Save(d).Error
+}
+
+func (r *repository) FindActive(ctx context.Context, userID uint64) (*models.AccountDeletion, error) {
+	var d models.AccountDeletion
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, []models.DeletionStatus{models.DeletionPending, models.DeletionScheduled}).
+		Order("created_at DESC").
+		First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrDeletionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *repository) FindPendingByToken(ctx context.Context, hash string) (*models.AccountDeletion, error) {
+	if hash == "" {
+		return nil, errorx.ErrTokenInvalid
+	}
+	var d models.AccountDeletion
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND status = ?", hash, models.DeletionPending).
+		First(&d).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDue 返回冷静期已结束的注销申请
+func (r *repository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.AccountDeletion, error) {
+	var list []models.AccountDeletion
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND purge_at <= ?", models.DeletionScheduled, now).
+		Order("purge_at ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *repository) CreateEmailChange(ctx context.Context, ch *models.EmailChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailChange{}).
+			Where("user_id = ? AND status = ?", ch.UserID, models.EmailChangePending).
+			Updates(map[string]any{"status": models.EmailChangeCanceled, "confirm_hash": ""}).Error; err != nil {
+			return err
+		}
+		return tx.Create(ch).Error
+	})
+}
+
+func (r *repository) FindEmailChangeByConfirm(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return r.findEmailChange(ctx, "confirm_hash = ?", hash)
+}
+
+func (r *repository) FindEmailChangeByRevert(ctx context.Context, hash string) (*models.EmailChange, error) {
+	return r.findEmailChange(ctx, "revert_hash = ?", hash)
+}
+
+func (r *repository) findEmailChange(ctx context.Context, query string, hash string) (*models.EmailChange, error) {
+	if hash == "" {
+		return nil, errorx.ErrTokenInvalid
+	}
+	var ch models.EmailChange
+	err := r.db.WithContext(ctx).Where(query, hash).First(&ch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+func (r *repository) UpdateEmailChange(ctx context.Context, ch *models.EmailChange) error {
+	return r.db.WithContext(ctx).Save(ch).Error
+}
+
+// ApplyEmailChange 只在用户当前邮箱仍为 from、目标邮箱未被占用、申请状态未被并发修改时生效；
+// 任一条件不满足则整体回滚
+func (r *repository) ApplyEmailChange(ctx context.Context, ch *models.EmailChange, prev models.EmailChangeStatus, from, to string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&models.User{}).
+			Where("email = ? AND id <> ?", to, ch.UserID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errorx.ErrEmailTaken
+		}
+
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND email = ? AND deleted_at IS NULL", ch.UserID, from).
+			Updates(map[string]any{"email": to, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrEmailChangeStale
+		}
+
+		result = tx.Model(&models.EmailChange{}).
+			Where("id = ? AND status = ?", ch.ID, prev).
+			Updates(map[string]any{
+				"status":       ch.Status,
+				"confirm_hash": ch.ConfirmHash,
+				"revert_hash":  ch.RevertHash,
+				"confirmed_at": ch.ConfirmedAt,
+				"reverted_at":  ch.RevertedAt,
+				"updated_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrTokenInvalid
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package account
+
+import (
+	"asum/pkg/engine"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler) {
+	me := r.Group("/user/me")
+	{
+		me.Get("/export", engine.H(h.Export))
+
+		me.Get("/deletion", engine.H(h.GetDeletion))
+		me.Post("/deletion", engine.H(h.RequestDeletion))
+		me.Post("/deletion/confirm", engine.H(h.ConfirmDeletion))
+		me.Delete("/deletion", engine.H(h.CancelDeletion))
+
+		me.Post("/email", engine.H(h.RequestEmailChange))
+
+		me.Get("/sessions", engine.H(h.ListSessions))
+		me.Delete("/sessions", engine.H(h.RevokeSessions))
+		me.Delete("/sessions/:id", engine.H(h.RevokeSession))
+	}
+}
+
+// RegisterPublicRoutes 注册邮件链接使用的免登录接口；注销链接 GET 只返回确认页，POST 才执行操作
+func RegisterPublicRoutes(r fiber.Router, h *Handler) {
+	g := r.Group("/account")
+	{
+		g.Get("/deletion/confirm", engine.H(h.ConfirmDeletionPage))
+		g.Post("/deletion/confirm", engine.H(h.ConfirmDeletionLink))
+		g.Get("/email/confirm", engine.H(h.ConfirmEmailChange))
+		g.Get("/email/revert", engine.H(h.RevertEmailChange))
+	}
+}
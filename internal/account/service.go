@@ -0,0 +1,534 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"asum/internal/auth"
+	"asum/internal/notify"
+	"asum/internal/task"
+	"asum/internal/user"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/queue"
+	"asum/pkg/rbac"
+	"asum/pkg/rdb"
+	"asum/pkg/session"
+	"asum/pkg/token"
+	"asum/pkg/usage"
+	"asum/pkg/utils"
+)
+
+type Service interface {
+	Export(c context.Context, userID uint64) ([]byte, error)
+
+	Deletion(c context.Context, userID uint64) (*models.AccountDeletion, error)
+	RequestDeletion(c context.Context, userID uint64, req *DeletionReq) (*models.AccountDeletion, error)
+	ConfirmDeletion(c context.Context, userID uint64, token string) (*models.AccountDeletion, error)
+	ConfirmDeletionByLink(c context.Context, token string) (*models.AccountDeletion, error)
+	CancelDeletion(c context.Context, userID uint64) error
+	RunPurger(ctx context.Context, interval time.Duration) error
+
+	RequestEmailChange(c context.Context, userID uint64, req *EmailChangeReq) (*EmailChangeResp, error)
+	ConfirmEmailChange(c context.Context, token string) (*EmailChangeResult, error)
+	RevertEmailChange(c context.Context, token string) (*EmailChangeResult, error)
+
+	Sessions(c context.Context, userID uint64, current string) ([]models.Session, error)
+	RevokeSession(c context.Context, userID uint64, sessionID string) error
+	RevokeSessions(c context.Context, userID uint64, except string) (*RevokeSessionsResp, error)
+}
+
+type service struct {
+	repo       Repository
+	userRepo   user.Repository
+	taskSvc    task.Service
+	perms      *rbac.Store
+	sessions   *session.Store
+	cache      *rdb.Client
+	q          *queue.RedisQueue[*auth.EmailJob]
+	baseURL    string
+	coolingOff time.Duration
+}
+
+func NewService(
+	repo Repository,
+	userRepo user.Repository,
+	taskSvc task.Service,
+	perms *rbac.Store,
+	sessions *session.Store,
+	cache *rdb.Client,
+	emailQueue *queue.RedisQueue[*auth.EmailJob],
+	baseURL string,
+	coolingOff time.Duration,
+) Service {
+	return &service{
+		repo:       repo,
+		userRepo:   userRepo,
+		taskSvc:    taskSvc,
+		perms:      perms,
+		sessions:   sessions,
+		cache:      cache,
+		q:          emailQueue,
+		baseURL:    baseURL,
+		coolingOff: coolingOff,
+	}
+}
+
+// Export 打包账号资料、日志、任务、用量与通知为 zip，每个部分一个 JSON 文件
+func (s *service) Export(c context.Context, userID uint64) ([]byte, error) {
+	ok, err := s.cache.SetNX(c, exportRateKey(userID), 1, exportInterval).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errorx.ErrExportTooFrequent
+	}
+
+	a, err := s.collect(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data any
+	}{
+		{"profile.json", a.Profile},
+		{"logs.json", a.Logs},
+		{"tasks.json", a.Tasks},
+		{"usage.json", a.Usage},
+		{"notifications.json", a.Notifications},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *service) collect(c context.Context, userID uint64) (*archive, error) {
+	u, err := s.userRepo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{
+		Profile: ExportProfile{
+			ID:        u.ID,
+			Name:      u.Name,
+			Email:     u.Email,
+			Level:     u.Level.String(),
+			Quota:     u.Quota,
+			Status:    u.Status,
+			Role:      u.Role,
+			CreatedAt: u.CreatedAt,
+			UpdatedAt: u.UpdatedAt,
+			LoginAt:   u.LoginAt,
+		},
+		Usage: ExportUsage{Tasks: map[uint64][]usage.Daily{}},
+	}
+
+	if a.Logs, err = s.userRepo.AllLogs(c, userID); err != nil {
+		return nil, err
+	}
+	if a.Tasks, err = s.userRepo.ListMyTasks(c, userID); err != nil {
+		return nil, err
+	}
+	if a.Usage.User, err = usage.UserDays(c, s.cache, userID, usage.RetentionDays); err != nil {
+		return nil, err
+	}
+	for _, t := range a.Tasks {
+		days, err := usage.TaskDays(c, s.cache, t.ID, usage.RetentionDays)
+		if err != nil {
+			return nil, err
+		}
+		a.Usage.Tasks[t.ID] = days
+	}
+	if a.Notifications, err = notify.ExportInbox(c, s.cache, userID); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *service) Deletion(c context.Context, userID uint64) (*models.AccountDeletion, error) {
+	return s.repo.FindActive(c, userID)
+}
+
+// RequestDeletion 校验密码后发送确认邮件；重复申请会替换尚未确认的申请
+func (s *service) RequestDeletion(c context.Context, userID uint64, req *DeletionReq) (*models.AccountDeletion, error) {
+	u, err := s.userRepo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(req.Password, u.Password) {
+		return nil, user.ErrWrongPassword
+	}
+
+	token := utils.GenerateConfirmToken()
+	d, err := s.repo.FindActive(c, userID)
+	switch {
+	case err == nil && d.Status == models.DeletionScheduled:
+		return nil, errorx.ErrDeletionScheduled
+	case err == nil:
+		d.TokenHash = utils.HashToken(token)
+		d.TokenExpiresAt = time.Now().Add(deletionTokenExpiry)
+		err = s.repo.Update(c, d)
+	case errors.Is(err, errorx.ErrDeletionNotFound):
+		d = &models.AccountDeletion{
+			UserID:         userID,
+			Status:         models.DeletionPending,
+			TokenHash:      utils.HashToken(token),
+			TokenExpiresAt: time.Now().Add(deletionTokenExpiry),
+		}
+		err = s.repo.Create(c, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&auth.DeletionPayload{
+		Link:           fmt.Sprintf("%s/v1/account/deletion/confirm?token=%s", s.baseURL, token),
+		CoolingOffDays: int(s.coolingOff / (24 * time.Hour)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.q.Push(c, &auth.EmailJob{
+		RequestID: utils.GetRequestID(c),
+		EmailType: auth.TypeAccountDeletion,
+		To:        u.Email,
+		Name:      u.Name,
+		Data:      payload,
+	}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ConfirmDeletion 确认后进入冷静期，到期由 RunPurger 彻底删除
+func (s *service) ConfirmDeletion(c context.Context, userID uint64, token string) (*models.AccountDeletion, error) {
+	d, err := s.repo.FindActive(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == models.DeletionScheduled {
+		return d, nil
+	}
+	if token == "" || d.TokenHash != utils.HashToken(token) {
+		return nil, errorx.ErrTokenInvalid
+	}
+	return s.schedule(c, d)
+}
+
+// ConfirmDeletionByLink 供邮件中的链接使用，只凭 token 确认，无需登录
+func (s *service) ConfirmDeletionByLink(c context.Context, token string) (*models.AccountDeletion, error) {
+	if token == "" {
+		return nil, errorx.ErrTokenInvalid
+	}
+	d, err := s.repo.FindPendingByToken(c, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return s.schedule(c, d)
+}
+
+// schedule 把 token 已校验的申请置为冷静期
+func (s *service) schedule(c context.Context, d *models.AccountDeletion) (*models.AccountDeletion, error) {
+	if time.Now().After(d.TokenExpiresAt) {
+		return nil, errorx.ErrTokenInvalid
+	}
+
+	now := time.Now()
+	purgeAt := now.Add(s.coolingOff)
+	d.Status = models.DeletionScheduled
+	d.TokenHash = ""
+	d.ConfirmedAt = &now
+	d.PurgeAt = &purgeAt
+	if err := s.repo.Update(c, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CancelDeletion 冷静期结束前可以撤销
+func (s *service) CancelDeletion(c context.Context, userID uint64) error {
+	d, err := s.repo.FindActive(c, userID)
+	if err != nil {
+		return err
+	}
+	d.Status = models.DeletionCanceled
+	d.TokenHash = ""
+	return s.repo.Update(c, d)
+}
+
+func (s *service) RunPurger(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		due, err := s.repo.ListDue(ctx, time.Now(), purgeBatch)
+		if err != nil {
+			logx.Errorf("list due account deletions: %v", err)
+			continue
+		}
+		for _, d := range due {
+			if err := s.purge(ctx, &d); err != nil {
+				logx.Errorf("purge user %d: %v", d.UserID, err)
+			}
+		}
+	}
+}
+
+// purge 删除用户作为 owner 的 task、用户本身及所有以用户关联的记录（见 user.Repository.HardDelete），
+// 再清理 Redis 中以用户或邮箱为键的数据。会话先撤销再删除，Redis 中的墓碑让尚未过期的 access token 立即失效。
+// 每一步都可重入，中途失败下一轮会重试
+func (s *service) purge(ctx context.Context, d *models.AccountDeletion) error {
+	var email string
+	if u, err := s.userRepo.FindByID(ctx, d.UserID); err == nil {
+		email = u.Email
+	} else if !errors.Is(err, user.ErrUserNotFound) {
+		return err
+	}
+
+	if _, err := s.sessions.RevokeAll(ctx, d.UserID, ""); err != nil {
+		return err
+	}
+	if err := s.taskSvc.PurgeOwned(ctx, d.UserID); err != nil {
+		return err
+	}
+	if err := s.userRepo.HardDelete(ctx, d.UserID); err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		return err
+	}
+
+	if err := notify.DeleteUser(ctx, s.cache, d.UserID); err != nil {
+		return err
+	}
+	if err := usage.DeleteUser(ctx, s.cache, d.UserID); err != nil {
+		return err
+	}
+	keys := []string{exportRateKey(d.UserID)}
+	if email != "" {
+		keys = append(keys, auth.EmailKeys(email)...)
+	}
+	if err := s.cache.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	if err := s.perms.InvalidateUser(ctx, d.UserID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	d.Status = models.DeletionCompleted
+	d.CompletedAt = &now
+	return s.repo.Update(ctx, d)
+}
+
+// RequestEmailChange 校验密码后向新邮箱发送确认链接、向旧邮箱发送带撤销链接的通知；
+// 新邮箱确认前账号邮箱保持不变
+func (s *service) RequestEmailChange(c context.Context, userID uint64, req *EmailChangeReq) (*EmailChangeResp, error) {
+	newEmail := utils.SanitizeEmail(req.NewEmail)
+	if err := utils.ValidateEmail(newEmail); err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(req.Password, u.Password) {
+		return nil, user.ErrWrongPassword
+	}
+	if newEmail == u.Email {
+		return nil, errorx.ErrSameEmail
+	}
+	taken, err := s.userRepo.ExistsByEmail(c, newEmail)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errorx.ErrEmailTaken
+	}
+
+	ok, err := s.cache.SetNX(c, emailChangeRateKey(userID), 1, emailChangeInterval).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errorx.ErrTooManyRequests
+	}
+
+	confirmToken, revertToken := utils.GenerateConfirmToken(), utils.GenerateConfirmToken()
+	now := time.Now()
+	ch := &models.EmailChange{
+		UserID:          userID,
+		OldEmail:        u.Email,
+		NewEmail:        newEmail,
+		Status:          models.EmailChangePending,
+		ConfirmHash:     utils.HashToken(confirmToken),
+		RevertHash:      utils.HashToken(revertToken),
+		ExpiresAt:       now.Add(emailChangeExpiry),
+		RevertExpiresAt: now.Add(emailRevertExpiry),
+	}
+	if err := s.repo.CreateEmailChange(c, ch); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendEmailChange(c, auth.TypeEmailChangeConfirm, newEmail, u.Name, &auth.EmailChangePayload{
+		NewEmail: newEmail,
+		Link:     fmt.Sprintf("%s/v1/account/email/confirm?token=%s", s.baseURL, confirmToken),
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.sendEmailChange(c, auth.TypeEmailChangeNotice, u.Email, u.Name, &auth.EmailChangePayload{
+		NewEmail: newEmail,
+		Link:     fmt.Sprintf("%s/v1/account/email/revert?token=%s", s.baseURL, revertToken),
+	}); err != nil {
+		return nil, err
+	}
+	return &EmailChangeResp{NewEmail: newEmail, ExpiresAt: ch.ExpiresAt}, nil
+}
+
+func (s *service) sendEmailChange(c context.Context, kind auth.EmailType, to, name string, payload *auth.EmailChangePayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.q.Push(c, &auth.EmailJob{
+		RequestID: utils.GetRequestID(c),
+		EmailType: kind,
+		To:        to,
+		Name:      name,
+		Data:      data,
+	})
+}
+
+// ConfirmEmailChange 原子地替换邮箱，成功后此前签发的令牌全部失效
+func (s *service) ConfirmEmailChange(c context.Context, raw string) (*EmailChangeResult, error) {
+	ch, err := s.repo.FindEmailChangeByConfirm(c, utils.HashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if ch.Status != models.EmailChangePending || time.Now().After(ch.ExpiresAt) {
+		return nil, errorx.ErrTokenInvalid
+	}
+
+	now := time.Now()
+	ch.Status = models.EmailChangeConfirmed
+	ch.ConfirmHash = ""
+	ch.ConfirmedAt = &now
+	if err := s.repo.ApplyEmailChange(c, ch, models.EmailChangePending, ch.OldEmail, ch.NewEmail); err != nil {
+		return nil, err
+	}
+
+	if err := s.afterEmailChange(c, ch.UserID, models.LogTypeChangeEmail, ch.OldEmail, ch.NewEmail); err != nil {
+		return nil, err
+	}
+	return &EmailChangeResult{Message: "邮箱已修改，请使用新邮箱重新登录", Email: ch.NewEmail}, nil
+}
+
+// RevertEmailChange 未确认的申请直接取消；已确认的在撤销期内恢复为旧邮箱，并使全部令牌失效
+func (s *service) RevertEmailChange(c context.Context, raw string) (*EmailChangeResult, error) {
+	ch, err := s.repo.FindEmailChangeByRevert(c, utils.HashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(ch.RevertExpiresAt) {
+		return nil, errorx.ErrTokenInvalid
+	}
+
+	now := time.Now()
+	switch ch.Status {
+	case models.EmailChangePending:
+		ch.Status = models.EmailChangeCanceled
+		ch.ConfirmHash = ""
+		ch.RevertHash = ""
+		if err := s.repo.UpdateEmailChange(c, ch); err != nil {
+			return nil, err
+		}
+		if err := s.signOut(c, ch.UserID); err != nil {
+			return nil, err
+		}
+		return &EmailChangeResult{Message: "已撤销修改邮箱申请，所有设备已退出登录，请尽快重置密码", Email: ch.OldEmail}, nil
+	case models.EmailChangeConfirmed:
+		ch.Status = models.EmailChangeReverted
+		ch.RevertHash = ""
+		ch.RevertedAt = &now
+		if err := s.repo.ApplyEmailChange(c, ch, models.EmailChangeConfirmed, ch.NewEmail, ch.OldEmail); err != nil {
+			return nil, err
+		}
+		if err := s.afterEmailChange(c, ch.UserID, models.LogTypeRevertEmail, ch.NewEmail, ch.OldEmail); err != nil {
+			return nil, err
+		}
+		return &EmailChangeResult{Message: "已恢复原邮箱，所有设备已退出登录，请尽快重置密码", Email: ch.OldEmail}, nil
+	default:
+		return nil, errorx.ErrTokenInvalid
+	}
+}
+
+func (s *service) afterEmailChange(c context.Context, userID uint64, kind models.LogType, from, to string) error {
+	if err := s.signOut(c, userID); err != nil {
+		return err
+	}
+	_ = s.userRepo.AddLog(c, &models.UserLog{
+		UserID:    userID,
+		Type:      kind,
+		IP:        utils.GetRemoteIP(c),
+		UserAgent: utils.GetUserAgent(c),
+		Extra:     from + " -> " + to,
+	})
+	return nil
+}
+
+// signOut 撤销用户的全部会话，并使模拟登录等没有会话的令牌一并失效
+func (s *service) signOut(c context.Context, userID uint64) error {
+	if _, err := s.sessions.RevokeAll(c, userID, ""); err != nil {
+		return err
+	}
+	return token.RevokeUser(c, s.cache, userID, time.Now())
+}
+
+// Sessions 返回用户仍然有效的登录会话，并标记发起请求的那个
+func (s *service) Sessions(c context.Context, userID uint64, current string) ([]models.Session, error) {
+	list, err := s.sessions.List(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Current = list[i].ID == current
+	}
+	return list, nil
+}
+
+func (s *service) RevokeSession(c context.Context, userID uint64, sessionID string) error {
+	return s.sessions.Revoke(c, userID, sessionID)
+}
+
+// RevokeSessions 撤销除 except 以外的全部会话，except 为空时当前会话也会退出
+func (s *service) RevokeSessions(c context.Context, userID uint64, except string) (*RevokeSessionsResp, error) {
+	n, err := s.sessions.RevokeAll(c, userID, except)
+	if err != nil {
+		return nil, err
+	}
+	return &RevokeSessionsResp{Revoked: n}, nil
+}
@@ -0,0 +1,13 @@
+package admin
+
+import "errors"
+
+var (
+	ErrSelfAction     = errors.New("不能对自己执行此操作")
+	ErrTargetAdmin    = errors.New("不能对管理员执行此操作")
+	ErrReasonRequired = errors.New("请填写操作原因")
+	ErrReasonTooLong  = errors.New("操作原因不能超过 500 字")
+	ErrInvalidLevel   = errors.New("无效的用户等级")
+	ErrInvalidQuota   = errors.New("无效的额度调整")
+	ErrUserNotActive  = errors.New("该用户未处于正常状态")
+)
@@ -0,0 +1,466 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"asum/internal/user"
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"asum/pkg/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{service: svc}
+}
+
+func parseID(c *engine.Ctx) (uint64, error) {
+	return strconv.ParseUint(c.Params("id"), 10, 64)
+}
+
+func fail(c *engine.Ctx, err error) error {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound), errors.Is(err, errorx.ErrRoleNotFound):
+		return c.Fail(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, ErrSelfAction), errors.Is(err, ErrTargetAdmin):
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	case errors.Is(err, errorx.ErrTooManyRequests):
+		return c.Fail(fiber.StatusTooManyRequests, err.Error())
+	default:
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	}
+}
+
+// ListUsers 搜索用户
+// @Summary 搜索用户
+// @Description 包含已删除的用户，deletedAt 不为空表示已删除。
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param email query string false "按邮箱模糊搜索"
+// @Param name query string false "按名称模糊搜索"
+// @Param status query int false "状态 0 未激活 / 1 正常 / 2 封禁"
+// @Param level query int false "等级 0 basic / 1 plus / 2 premium / 3 top"
+// @Param role query string false "角色 user/admin"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]UserDetail}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "无权限"
+// @Router /app/admin/users [get]
+func (h *Handler) ListUsers(c *engine.Ctx) error {
+	p, err := pagination.Parse(c, userListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.ListUsers(c.StdCtx, p)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
+}
+
+// GetUser 查看用户详情
+// @Summary 查看用户详情
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Success 200 {object} engine.Response{data=UserDetail} "查询成功"
+// @Failure 403 {object} engine.Response "无权限"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id} [get]
+func (h *Handler) GetUser(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.GetUser(c.StdCtx, id)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// UserTasks 查看用户参与的任务
+// @Summary 查看用户的任务
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Success 200 {object} engine.Response{data=[]user.MyTask} "查询成功"
+// @Failure 403 {object} engine.Response "无权限"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/tasks [get]
+func (h *Handler) UserTasks(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.UserTasks(c.StdCtx, id)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// UserLogs 查看用户的操作日志
+// @Summary 查看用户日志
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param type query int false "按日志类型筛选"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]models.UserLog}} "查询成功"
+// @Failure 403 {object} engine.Response "无权限"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/logs [get]
+func (h *Handler) UserLogs(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	p, err := pagination.Parse(c, userLogListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.UserLogs(c.StdCtx, id, p)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OKPage(page.List, page.Next)
+}
+
+// Ban 封禁用户
+// @Summary 封禁用户
+// @Description 封禁后用户无法登录，已登录的会话与令牌、名下任务的 API key 立即失效。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body ReasonReq false "原因"
+// @Success 200 {object} engine.Response{data=UserDetail} "封禁成功"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/ban [post]
+func (h *Handler) Ban(c *engine.Ctx) error {
+	return h.setStatus(c, h.service.Ban)
+}
+
+// Unban 解封用户
+// @Summary 解封用户
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body ReasonReq false "原因"
+// @Success 200 {object} engine.Response{data=UserDetail} "解封成功"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/unban [post]
+func (h *Handler) Unban(c *engine.Ctx) error {
+	return h.setStatus(c, h.service.Unban)
+}
+
+func (h *Handler) setStatus(c *engine.Ctx, fn func(ctx context.Context, adminID, id uint64, req *ReasonReq) (*UserDetail, error)) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req ReasonReq
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+		}
+	}
+
+	data, err := fn(c.StdCtx, utils.GetUserID(c), id, &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// SetLevel 修改用户等级(套餐)
+// @Summary 修改用户等级
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body SetLevelReq true "等级 0 basic / 1 plus / 2 premium / 3 top"
+// @Success 200 {object} engine.Response{data=UserDetail} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/level [put]
+func (h *Handler) SetLevel(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req SetLevelReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.SetLevel(c.StdCtx, utils.GetUserID(c), id, &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// AdjustQuota 调整用户余额
+// @Summary 调整用户余额
+// @Description delta 为正数时增加，负数时扣减，扣减后余额不能为负。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body AdjustQuotaReq true "调整量"
+// @Success 200 {object} engine.Response{data=UserDetail} "调整成功"
+// @Failure 400 {object} engine.Response "参数错误或余额不足"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/quota [post]
+func (h *Handler) AdjustQuota(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req AdjustQuotaReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.AdjustQuota(c.StdCtx, utils.GetUserID(c), id, &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// ResetPassword 强制重置密码
+// @Summary 强制重置密码
+// @Description 向用户发送重置邮件并使当前密码失效，已登录的会话与令牌同时失效。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body ReasonReq false "原因"
+// @Success 200 {object} engine.Response "已发送重置邮件"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Failure 429 {object} engine.Response "邮件发送过于频繁"
+// @Router /app/admin/users/{id}/reset-password [post]
+func (h *Handler) ResetPassword(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req ReasonReq
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+		}
+	}
+
+	if err := h.service.ResetPassword(c.StdCtx, utils.GetUserID(c), id, &req); err != nil {
+		return fail(c, err)
+	}
+	return c.OK(nil)
+}
+
+// DeleteUser 删除用户
+// @Summary 删除用户
+// @Description 默认软删除；hard=true 时彻底删除用户及其日志与任务关联，不可恢复。两种方式都会使用户已登录的会话与令牌立即失效。
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param hard query bool false "是否彻底删除"
+// @Param reason query string false "原因"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id} [delete]
+func (h *Handler) DeleteUser(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	hard := fiber.Query[bool](c, "hard")
+	if err := h.service.DeleteUser(c.StdCtx, utils.GetUserID(c), id, hard, c.Query("reason")); err != nil {
+		return fail(c, err)
+	}
+	return c.OK(nil)
+}
+
+// Impersonate 模拟用户登录
+// @Summary 模拟用户登录
+// @Description 必须填写原因并记入审计；返回 30 分钟有效的 access token，不能刷新，也不能访问管理接口。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body ReasonReq true "原因"
+// @Success 200 {object} engine.Response{data=ImpersonateResp} "签发成功"
+// @Failure 400 {object} engine.Response "未填写原因或用户未处于正常状态"
+// @Failure 403 {object} engine.Response "无权限或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户不存在"
+// @Router /app/admin/users/{id}/impersonate [post]
+func (h *Handler) Impersonate(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req ReasonReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Impersonate(c.StdCtx, utils.GetUserID(c), id, &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// AssignRole 修改用户角色
+// @Summary 修改用户角色
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "用户 ID"
+// @Param request body AssignRoleReq true "角色"
+// @Success 200 {object} engine.Response{data=UserDetail} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "无权限、修改自己或目标为管理人员"
+// @Failure 404 {object} engine.Response "用户或角色不存在"
+// @Router /app/admin/users/{id}/role [put]
+func (h *Handler) AssignRole(c *engine.Ctx) error {
+	id, err := parseID(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req AssignRoleReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.AssignRole(c.StdCtx, utils.GetUserID(c), id, &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// ListRoles 查看角色
+// @Summary 查看角色
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]models.Role} "查询成功"
+// @Failure 403 {object} engine.Response "无权限"
+// @Router /app/admin/roles [get]
+func (h *Handler) ListRoles(c *engine.Ctx) error {
+	return c.OK(h.service.ListRoles(c.StdCtx))
+}
+
+// SaveRole 创建或修改角色
+// @Summary 创建或修改角色
+// @Description 角色名为 2-16 位小写字母、数字、_ 或 -；内置角色可修改权限，admin 须保留 *。修改立即在所有实例生效。
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param name path string true "角色名"
+// @Param request body RoleReq true "权限，如 tasks:read、tasks:write、users:read、users:write、users:impersonate、audits:read、roles:manage、*"
+// @Success 200 {object} engine.Response{data=models.Role} "保存成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "无权限"
+// @Router /app/admin/roles/{name} [put]
+func (h *Handler) SaveRole(c *engine.Ctx) error {
+	var req RoleReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.SaveRole(c.StdCtx, utils.GetUserID(c), models.UserRole(c.Params("name")), &req)
+	if err != nil {
+		return fail(c, err)
+	}
+	return c.OK(data)
+}
+
+// DeleteRole 删除角色
+// @Summary 删除角色
+// @Description 内置角色与仍有用户使用的角色不能删除。
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param name path string true "角色名"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 400 {object} engine.Response "内置角色或仍在使用"
+// @Failure 403 {object} engine.Response "无权限"
+// @Failure 404 {object} engine.Response "角色不存在"
+// @Router /app/admin/roles/{name} [delete]
+func (h *Handler) DeleteRole(c *engine.Ctx) error {
+	if err := h.service.DeleteRole(c.StdCtx, utils.GetUserID(c), models.UserRole(c.Params("name"))); err != nil {
+		return fail(c, err)
+	}
+	return c.OK(nil)
+}
+
+// ListAudits 查看管理员操作审计
+// @Summary 查看审计记录
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param adminId query int false "按管理员筛选"
+// @Param targetId query int false "按目标用户筛选"
+// @Param action query string false "按操作类型筛选，如 user.impersonate"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]models.AdminAudit}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "无权限"
+// @Router /app/admin/audits [get]
+func (h *Handler) ListAudits(c *engine.Ctx) error {
+	p, err := pagination.Parse(c, auditListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.ListAudits(c.StdCtx, p)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"time"
+)
+
+var userListSpec = &pagination.Spec{
+	Name: "admin_users",
+	Filters: map[string]pagination.Filter{
+		"email":  {Column: "email", Like: true},
+		"name":   {Column: "name", Like: true},
+		"status": {Column: "status", Int: true},
+		"level":  {Column: "level", Int: true},
+		"role":   {Column: "role"},
+	},
+}
+
+var userLogListSpec = &pagination.Spec{
+	Name: "admin_user_logs",
+	Filters: map[string]pagination.Filter{
+		"type": {Column: "type", Int: true},
+	},
+}
+
+var auditListSpec = &pagination.Spec{
+	Name: "admin_audits",
+	Filters: map[string]pagination.Filter{
+		"adminId":  {Column: "admin_id", Int: true},
+		"targetId": {Column: "target_id", Int: true},
+		"action":   {Column: "action"},
+	},
+}
+
+// maxReasonLen 为操作原因的最大长度
+const maxReasonLen = 500
+
+// UserDetail 在用户信息之外带上删除时间，已软删除的用户也能查到
+type UserDetail struct {
+	models.User
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+func newUserDetail(u *models.User) *UserDetail {
+	return &UserDetail{User: *u, DeletedAt: u.DeletedAt}
+}
+
+type ReasonReq struct {
+	Reason string `json:"reason"`
+}
+
+type SetLevelReq struct {
+	Level  models.Level `json:"level"`
+	Reason string       `json:"reason"`
+}
+
+type AdjustQuotaReq struct {
+	// Delta 为正数时增加余额，负数时扣减，扣减后不能为负
+	Delta  int    `json:"delta"`
+	Reason string `json:"reason"`
+}
+
+type AssignRoleReq struct {
+	Role   models.UserRole `json:"role"`
+	Reason string          `json:"reason"`
+}
+
+type RoleReq struct {
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+type ImpersonateResp struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"asum/internal/user"
+	"asum/pkg/db"
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Promote(ctx context.Context, emails []string) error
+
+	FindUser(ctx context.Context, id uint64) (*models.User, error)
+	ListUsers(ctx context.Context, p *pagination.Params) ([]models.User, error)
+
+	AddAudit(ctx context.Context, a *models.AdminAudit) error
+	ListAudits(ctx context.Context, p *pagination.Params) ([]models.AdminAudit, error)
+}
+
+type repository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	if err := db.AutoMigrate(&models.AdminAudit{}); err != nil {
+		panic(err)
+	}
+	return &repository{db: db}
+}
+
+// Promote 将配置中的邮箱设为管理员，用于首次部署时引导出第一个管理员
+func (r *repository) Promote(ctx context.Context, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("email IN ? AND deleted_at IS NULL", emails).
+		Update("role", models.UserRoleAdmin).Error
+}
+
+// FindUser 包含已软删除的用户
+func (r *repository) FindUser(ctx context.Context, id uint64) (*models.User, error) {
+	var u models.User
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, user.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *repository) ListUsers(ctx context.Context, p *pagination.Params) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).
+		Scopes(p.Scope).
+		Find(&users).Error
+	return users, err
+}
+
+func (r *repository) AddAudit(ctx context.Context, a *models.AdminAudit) error {
+	return r.db.WithContext(ctx).Create(a).Error
+}
+
+func (r *repository) ListAudits(ctx context.Context, p *pagination.Params) ([]models.AdminAudit, error) {
+	var audits []models.AdminAudit
+	err := r.db.WithContext(ctx).
+		Scopes(p.Scope).
+		Find(&audits).Error
+	return audits, err
+}
@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"asum/pkg/engine"
+	"asum/pkg/middleware"
+	"asum/pkg/models"
+	"asum/pkg/rbac"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler, perms *rbac.Store) {
+	read := middleware.Require(perms, models.PermissionUsersRead)
+	write := middleware.Require(perms, models.PermissionUsersWrite)
+	roles := middleware.Require(perms, models.PermissionRolesManage)
+
+	users := r.Group("/users")
+	{
+		users.Get("/", read, engine.H(h.ListUsers))
+		users.Get("/:id", read, engine.H(h.GetUser))
+		users.Get("/:id/tasks", read, engine.H(h.UserTasks))
+		users.Get("/:id/logs", read, engine.H(h.UserLogs))
+
+		users.Delete("/:id", write, engine.H(h.DeleteUser))
+		users.Post("/:id/ban", write, engine.H(h.Ban))
+		users.Post("/:id/unban", write, engine.H(h.Unban))
+		users.Put("/:id/level", write, engine.H(h.SetLevel))
+		users.Post("/:id/quota", write, engine.H(h.AdjustQuota))
+		users.Post("/:id/reset-password", write, engine.H(h.ResetPassword))
+		users.Post("/:id/impersonate", middleware.Require(perms, models.PermissionUsersImpersonate), engine.H(h.Impersonate))
+		users.Put("/:id/role", roles, engine.H(h.AssignRole))
+	}
+
+	r.Get("/roles", roles, engine.H(h.ListRoles))
+	r.Put("/roles/:name", roles, engine.H(h.SaveRole))
+	r.Delete("/roles/:name", roles, engine.H(h.DeleteRole))
+
+	r.Get("/audits", middleware.Require(perms, models.PermissionAuditsRead), engine.H(h.ListAudits))
+}
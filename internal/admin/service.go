@@ -0,0 +1,404 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"asum/internal/auth"
+	"asum/internal/user"
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"asum/pkg/rbac"
+	"asum/pkg/rdb"
+	"asum/pkg/session"
+	"asum/pkg/token"
+	"asum/pkg/utils"
+)
+
+type Service interface {
+	ListUsers(c context.Context, p *pagination.Params) (*pagination.Page[UserDetail], error)
+	GetUser(c context.Context, id uint64) (*UserDetail, error)
+	UserTasks(c context.Context, id uint64) ([]user.MyTask, error)
+	UserLogs(c context.Context, id uint64, p *pagination.Params) (*pagination.Page[models.UserLog], error)
+
+	Ban(c context.Context, adminID, id uint64, req *ReasonReq) (*UserDetail, error)
+	Unban(c context.Context, adminID, id uint64, req *ReasonReq) (*UserDetail, error)
+	SetLevel(c context.Context, adminID, id uint64, req *SetLevelReq) (*UserDetail, error)
+	AdjustQuota(c context.Context, adminID, id uint64, req *AdjustQuotaReq) (*UserDetail, error)
+	ResetPassword(c context.Context, adminID, id uint64, req *ReasonReq) error
+	DeleteUser(c context.Context, adminID, id uint64, hard bool, reason string) error
+	Impersonate(c context.Context, adminID, id uint64, req *ReasonReq) (*ImpersonateResp, error)
+
+	AssignRole(c context.Context, adminID, id uint64, req *AssignRoleReq) (*UserDetail, error)
+	ListRoles(c context.Context) []models.Role
+	SaveRole(c context.Context, adminID uint64, name models.UserRole, req *RoleReq) (*models.Role, error)
+	DeleteRole(c context.Context, adminID uint64, name models.UserRole) error
+
+	ListAudits(c context.Context, p *pagination.Params) (*pagination.Page[models.AdminAudit], error)
+}
+
+type service struct {
+	repo     Repository
+	userRepo user.Repository
+	authSvc  auth.Service
+	jwt      *token.Manager
+	perms    *rbac.Store
+	sessions *session.Store
+	cache    *rdb.Client
+}
+
+func NewService(repo Repository, userRepo user.Repository, authSvc auth.Service, jwtMgr *token.Manager, perms *rbac.Store, sessions *session.Store, cache *rdb.Client) Service {
+	return &service{
+		repo:     repo,
+		userRepo: userRepo,
+		authSvc:  authSvc,
+		jwt:      jwtMgr,
+		perms:    perms,
+		sessions: sessions,
+		cache:    cache,
+	}
+}
+
+// signOut 撤销用户的全部会话，并使已签发的 access token（含模拟登录令牌）立即失效
+func (s *service) signOut(c context.Context, userID uint64) error {
+	if _, err := s.sessions.RevokeAll(c, userID, ""); err != nil {
+		return err
+	}
+	return token.RevokeUser(c, s.cache, userID, time.Now())
+}
+
+// target 取出要操作的用户；不能操作自己，也不能操作拥有管理类权限的用户
+func (s *service) target(c context.Context, adminID, id uint64) (*models.User, error) {
+	if adminID == id {
+		return nil, ErrSelfAction
+	}
+	u, err := s.userRepo.FindByID(c, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.perms.Privileged(u.Role) {
+		return nil, ErrTargetAdmin
+	}
+	return u, nil
+}
+
+func (s *service) audit(c context.Context, adminID, targetID uint64, action models.AdminAction, detail map[string]any) error {
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	return s.repo.AddAudit(c, &models.AdminAudit{
+		AdminID:   adminID,
+		TargetID:  targetID,
+		Action:    action,
+		Detail:    string(raw),
+		IP:        utils.GetRemoteIP(c),
+		UserAgent: utils.GetUserAgent(c),
+	})
+}
+
+func cleanReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxReasonLen {
+		return "", ErrReasonTooLong
+	}
+	return reason, nil
+}
+
+func (s *service) ListUsers(c context.Context, p *pagination.Params) (*pagination.Page[UserDetail], error) {
+	users, err := s.repo.ListUsers(c, p)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]UserDetail, len(users))
+	for i := range users {
+		list[i] = *newUserDetail(&users[i])
+	}
+	return pagination.Cut(p, list, func(u *UserDetail) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: u.CreatedAt, ID: u.ID}
+	}), nil
+}
+
+func (s *service) GetUser(c context.Context, id uint64) (*UserDetail, error) {
+	u, err := s.repo.FindUser(c, id)
+	if err != nil {
+		return nil, err
+	}
+	return newUserDetail(u), nil
+}
+
+func (s *service) UserTasks(c context.Context, id uint64) ([]user.MyTask, error) {
+	if _, err := s.repo.FindUser(c, id); err != nil {
+		return nil, err
+	}
+	return s.userRepo.ListMyTasks(c, id)
+}
+
+func (s *service) UserLogs(c context.Context, id uint64, p *pagination.Params) (*pagination.Page[models.UserLog], error) {
+	if _, err := s.repo.FindUser(c, id); err != nil {
+		return nil, err
+	}
+	logs, err := s.userRepo.ListLogs(c, id, p)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Cut(p, logs, func(l *models.UserLog) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: l.CreatedAt, ID: l.ID}
+	}), nil
+}
+
+// setStatus 封禁与解封；状态变化由 userRepo.Update 同步到 key 缓存，并使权限缓存失效，封禁时同时踢下线
+func (s *service) setStatus(c context.Context, adminID, id uint64, status models.UserStatus, action models.AdminAction, req *ReasonReq) (*UserDetail, error) {
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status == status {
+		// 重复封禁时再踢一次下线，上次踢下线失败时可以重试
+		if status == models.StatusBanned {
+			if err := s.signOut(c, id); err != nil {
+				return nil, err
+			}
+		}
+		return newUserDetail(u), nil
+	}
+
+	from := u.Status
+	u.Status = status
+	if err := s.userRepo.Update(c, u); err != nil {
+		return nil, err
+	}
+	if err := s.perms.InvalidateUser(c, id); err != nil {
+		return nil, err
+	}
+	if status == models.StatusBanned {
+		if err := s.signOut(c, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.audit(c, adminID, id, action, map[string]any{"from": from, "to": status, "reason": reason}); err != nil {
+		return nil, err
+	}
+	return newUserDetail(u), nil
+}
+
+func (s *service) Ban(c context.Context, adminID, id uint64, req *ReasonReq) (*UserDetail, error) {
+	return s.setStatus(c, adminID, id, models.StatusBanned, models.AdminActionBan, req)
+}
+
+func (s *service) Unban(c context.Context, adminID, id uint64, req *ReasonReq) (*UserDetail, error) {
+	return s.setStatus(c, adminID, id, models.StatusActive, models.AdminActionUnban, req)
+}
+
+func (s *service) SetLevel(c context.Context, adminID, id uint64, req *SetLevelReq) (*UserDetail, error) {
+	if !req.Level.Valid() {
+		return nil, ErrInvalidLevel
+	}
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Level == req.Level {
+		return newUserDetail(u), nil
+	}
+
+	from := u.Level
+	u.Level = req.Level
+	if err := s.userRepo.Update(c, u); err != nil {
+		return nil, err
+	}
+	if err := s.audit(c, adminID, id, models.AdminActionSetLevel, map[string]any{"from": from.String(), "to": u.Level.String(), "reason": reason}); err != nil {
+		return nil, err
+	}
+	return newUserDetail(u), nil
+}
+
+func (s *service) AdjustQuota(c context.Context, adminID, id uint64, req *AdjustQuotaReq) (*UserDetail, error) {
+	if req.Delta == 0 {
+		return nil, ErrInvalidQuota
+	}
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := s.userRepo.AdjustQuota(c, id, req.Delta)
+	if err != nil {
+		return nil, err
+	}
+	u.Quota = int(quota)
+	if err := s.audit(c, adminID, id, models.AdminActionAdjustQuota, map[string]any{"delta": req.Delta, "quota": quota, "reason": reason}); err != nil {
+		return nil, err
+	}
+	return newUserDetail(u), nil
+}
+
+// ResetPassword 先发出重置邮件，再把密码替换为随机值并踢下线，用户只能通过邮件设置新密码
+func (s *service) ResetPassword(c context.Context, adminID, id uint64, req *ReasonReq) error {
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return err
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.authSvc.ResetPassword(c, &auth.ResetPasswordReq{Email: u.Email}); err != nil {
+		return err
+	}
+	hashed, err := utils.HashPassword(utils.GenerateRandomToken(32))
+	if err != nil {
+		return err
+	}
+	u.Password = hashed
+	if err := s.userRepo.Update(c, u); err != nil {
+		return err
+	}
+	if err := s.signOut(c, id); err != nil {
+		return err
+	}
+	return s.audit(c, adminID, id, models.AdminActionResetPassword, map[string]any{"reason": reason})
+}
+
+// DeleteUser 软删除后可以再彻底删除，彻底删除会移除日志与任务关联，审计记录保留
+func (s *service) DeleteUser(c context.Context, adminID, id uint64, hard bool, reason string) error {
+	reason, err := cleanReason(reason)
+	if err != nil {
+		return err
+	}
+	if adminID == id {
+		return ErrSelfAction
+	}
+	u, err := s.repo.FindUser(c, id)
+	if err != nil {
+		return err
+	}
+	if s.perms.Privileged(u.Role) {
+		return ErrTargetAdmin
+	}
+
+	// 先踢下线再删除，踢下线失败时用户仍在，可以重试
+	if err := s.signOut(c, id); err != nil {
+		return err
+	}
+	action := models.AdminActionDelete
+	if hard {
+		action = models.AdminActionHardDelete
+		err = s.userRepo.HardDelete(c, id)
+	} else {
+		err = s.userRepo.Delete(c, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.perms.InvalidateUser(c, id); err != nil {
+		return err
+	}
+	return s.audit(c, adminID, id, action, map[string]any{"email": u.Email, "reason": reason})
+}
+
+// Impersonate 必须填写原因，审计写入成功后才签发令牌
+func (s *service) Impersonate(c context.Context, adminID, id uint64, req *ReasonReq) (*ImpersonateResp, error) {
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != models.StatusActive {
+		return nil, ErrUserNotActive
+	}
+
+	expiresAt := time.Now().Add(token.ImpersonationExpiry)
+	if err := s.audit(c, adminID, id, models.AdminActionImpersonate, map[string]any{"reason": reason, "expiresAt": expiresAt}); err != nil {
+		return nil, err
+	}
+	tk, err := s.jwt.GenerateImpersonationToken(u.ID, u.Email, int(u.Level), adminID)
+	if err != nil {
+		return nil, err
+	}
+	return &ImpersonateResp{Token: tk, ExpiresAt: expiresAt}, nil
+}
+
+// AssignRole 可以授予管理类角色，但不能修改自己或已拥有管理类权限的用户的角色；
+// 撤销管理员只能通过配置中的 admin.emails 或直接修改数据库
+func (s *service) AssignRole(c context.Context, adminID, id uint64, req *AssignRoleReq) (*UserDetail, error) {
+	reason, err := cleanReason(req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.target(c, adminID, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Role == req.Role {
+		return newUserDetail(u), nil
+	}
+
+	from := u.Role
+	if err := s.perms.AssignRole(c, id, req.Role); err != nil {
+		return nil, err
+	}
+	u.Role = req.Role
+	if err := s.audit(c, adminID, id, models.AdminActionSetRole, map[string]any{"from": from, "to": req.Role, "reason": reason}); err != nil {
+		return nil, err
+	}
+	return newUserDetail(u), nil
+}
+
+func (s *service) ListRoles(c context.Context) []models.Role {
+	return s.perms.Roles()
+}
+
+func (s *service) SaveRole(c context.Context, adminID uint64, name models.UserRole, req *RoleReq) (*models.Role, error) {
+	role := &models.Role{
+		Name:        name,
+		Description: strings.TrimSpace(req.Description),
+		Permissions: req.Permissions,
+	}
+	if err := s.perms.SaveRole(c, role); err != nil {
+		return nil, err
+	}
+	if err := s.audit(c, adminID, 0, models.AdminActionSaveRole, map[string]any{"role": name, "permissions": role.Permissions}); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (s *service) DeleteRole(c context.Context, adminID uint64, name models.UserRole) error {
+	if err := s.perms.DeleteRole(c, name); err != nil {
+		return err
+	}
+	return s.audit(c, adminID, 0, models.AdminActionDeleteRole, map[string]any{"role": name})
+}
+
+func (s *service) ListAudits(c context.Context, p *pagination.Params) (*pagination.Page[models.AdminAudit], error) {
+	audits, err := s.repo.ListAudits(c, p)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Cut(p, audits, func(a *models.AdminAudit) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: a.CreatedAt, ID: a.ID}
+	}), nil
+}
@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"asum/internal/user"
+	"asum/pkg/db"
+	"asum/pkg/models"
+	"asum/pkg/rbac"
+	"asum/pkg/rdb"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeUsers 只实现 target 与各修改操作用到的方法，其余方法调用时 panic
+type fakeUsers struct {
+	user.Repository
+	users map[uint64]models.User
+}
+
+func (f *fakeUsers) FindByID(_ context.Context, id uint64) (*models.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	return &u, nil
+}
+
+func (f *fakeUsers) Update(_ context.Context, u *models.User) error {
+	f.users[u.ID] = *u
+	return nil
+}
+
+func (f *fakeUsers) AdjustQuota(_ context.Context, id uint64, delta int) (int64, error) {
+	u := f.users[id]
+	u.Quota += delta
+	f.users[id] = u
+	return int64(u.Quota), nil
+}
+
+type fakeRepo struct {
+	Repository
+	audits []models.AdminAudit
+}
+
+func (f *fakeRepo) AddAudit(_ context.Context, a *models.AdminAudit) error {
+	f.audits = append(f.audits, *a)
+	return nil
+}
+
+func newTestService(t *testing.T, users ...models.User) (*service, *fakeUsers, *fakeRepo) {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &db.DB{DB: gdb}
+	if err := pg.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	fu := &fakeUsers{users: map[uint64]models.User{}}
+	for _, u := range users {
+		if err := pg.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+		fu.users[u.ID] = u
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	perms := rbac.NewStore(pg, &rdb.Client{Client: client})
+	// support 只有 users:read，也算管理人员
+	if err := perms.SaveRole(context.Background(), &models.Role{
+		Name:        "support",
+		Permissions: []models.Permission{models.PermissionUsersRead},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeRepo{}
+	return &service{repo: repo, userRepo: fu, perms: perms}, fu, repo
+}
+
+func TestPrivilegedTarget(t *testing.T) {
+	const adminID, supportID, userID = 1, 2, 3
+	actions := map[string]func(s *service, target uint64) error{
+		"SetLevel": func(s *service, target uint64) error {
+			_, err := s.SetLevel(context.Background(), adminID, target, &SetLevelReq{Level: models.LevelPremium, Reason: "test"})
+			return err
+		},
+		"AdjustQuota": func(s *service, target uint64) error {
+			_, err := s.AdjustQuota(context.Background(), adminID, target, &AdjustQuotaReq{Delta: 100, Reason: "test"})
+			return err
+		},
+		"AssignRole": func(s *service, target uint64) error {
+			_, err := s.AssignRole(context.Background(), adminID, target, &AssignRoleReq{Role: "support", Reason: "test"})
+			return err
+		},
+	}
+
+	for name, do := range actions {
+		for _, tc := range []struct {
+			target uint64
+			want   error
+		}{
+			{adminID, ErrSelfAction},
+			{supportID, ErrTargetAdmin},
+			{userID, nil},
+		} {
+			s, users, repo := newTestService(t,
+				models.User{ID: adminID, Name: "admin", Email: "admin@example.com", Role: models.UserRoleAdmin, Status: models.StatusActive},
+				models.User{ID: supportID, Name: "support", Email: "support@example.com", Role: "support", Status: models.StatusActive},
+				models.User{ID: userID, Name: "user", Email: "user@example.com", Role: models.UserRoleUser, Status: models.StatusActive},
+			)
+			before := users.users[tc.target]
+
+			err := do(s, tc.target)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("%s on user %d: err = %v, want %v", name, tc.target, err, tc.want)
+				continue
+			}
+			if tc.want != nil {
+				if after := users.users[tc.target]; after.Level != before.Level || after.Quota != before.Quota || after.Role != before.Role {
+					t.Errorf("%s on user %d: target changed to %+v", name, tc.target, after)
+				}
+				if len(repo.audits) != 0 {
+					t.Errorf("%s on user %d: audited a refused action", name, tc.target)
+				}
+				continue
+			}
+			if len(repo.audits) != 1 || repo.audits[0].TargetID != tc.target {
+				t.Errorf("%s on user %d: audits = %+v", name, tc.target, repo.audits)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package alert
+
+import (
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{service: svc}
+}
+
+type CreateAlertReq struct {
+	// TaskID 为 0 时为账户级规则
+	TaskID    uint64 `json:"taskId"`
+	Metric    string `json:"metric"`
+	Threshold int64  `json:"threshold"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+type UpdateAlertReq struct {
+	Threshold *int64 `json:"threshold"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+// ListAlerts 查看用量告警规则
+// @Summary 查看用量告警规则
+// @Tags Alert
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]models.UsageAlert} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/alert [get]
+func (h *Handler) ListAlerts(c *engine.Ctx) error {
+	data, err := h.service.List(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// CreateAlert 新增用量告警规则
+// @Summary 新增用量告警规则
+// @Description metric 为 quota_remaining_pct 时 threshold 为 1-99 的百分比，仅支持账户级；为 daily_usage 时 threshold 为当日调用次数。
+// @Tags Alert
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body CreateAlertReq true "告警规则"
+// @Success 200 {object} engine.Response{data=models.UsageAlert} "创建成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (规则无效或无权操作此任务)"
+// @Router /app/alert [post]
+func (h *Handler) CreateAlert(c *engine.Ctx) error {
+	var req CreateAlertReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Create(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateAlert 修改用量告警规则
+// @Summary 修改用量告警规则
+// @Tags Alert
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "规则 ID"
+// @Param request body UpdateAlertReq true "修改内容"
+// @Success 200 {object} engine.Response{data=models.UsageAlert} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (规则不存在或无效)"
+// @Router /app/alert/{id} [patch]
+func (h *Handler) UpdateAlert(c *engine.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req UpdateAlertReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Update(c.StdCtx, id, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// DeleteAlert 删除用量告警规则
+// @Summary 删除用量告警规则
+// @Tags Alert
+// @Produce json
+// @Security Bearer
+// @Param id path int true "规则 ID"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (规则不存在)"
+// @Router /app/alert/{id} [delete]
+func (h *Handler) DeleteAlert(c *engine.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.Delete(c.StdCtx, id, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"context"
+	"errors"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(ctx context.Context, a *models.UsageAlert) error
+	Update(ctx context.Context, a *models.UsageAlert) error
+	Delete(ctx context.Context, id, userID uint64) error
+	FindByID(ctx context.Context, id, userID uint64) (*models.UsageAlert, error)
+	CountByUser(ctx context.Context, userID uint64) (int64, error)
+	ListByUser(ctx context.Context, userID uint64) ([]models.UsageAlert, error)
+	ListEnabled(ctx context.Context) ([]models.UsageAlert, error)
+	SaveState(ctx context.Context, a *models.UsageAlert) error
+}
+
+type repository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	if err := db.AutoMigrate(&models.UsageAlert{}); err != nil {
+		panic(err)
+	}
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, a *models.UsageAlert) error {
+	return r.db.WithContext(ctx).Create(a).Error
+}
+
+func (r *repository) Update(ctx context.Context, a *models.UsageAlert) error {
+	return r.db.WithContext(ctx).
+		Model(a).
+		Select("threshold", "enabled", "baseline", "triggered", "updated_at").
+		Updates(a).Error
+}
+
+func (r *repository) Delete(ctx context.Context, id, userID uint64) error {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&models.UsageAlert{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errorx.ErrAlertNotFound
+	}
+	return nil
+}
+
+func (r *repository) FindByID(ctx context.Context, id, userID uint64) (*models.UsageAlert, error) {
+	var a models.UsageAlert
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&a).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrAlertNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *repository) CountByUser(ctx context.Context, userID uint64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.UsageAlert{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *repository) ListByUser(ctx context.Context, userID uint64) ([]models.UsageAlert, error) {
+	var alerts []models.UsageAlert
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *repository) ListEnabled(ctx context.Context) ([]models.UsageAlert, error) {
+	var alerts []models.UsageAlert
+	err := r.db.WithContext(ctx).
+		Where("enabled = ?", true).
+		Order("id ASC").
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// SaveState 只写回评估器维护的状态字段，避免覆盖用户同时修改的阈值
+func (r *repository) SaveState(ctx context.Context, a *models.UsageAlert) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UsageAlert{}).
+		Where("id = ?", a.ID).
+		Updates(map[string]any{
+			"baseline":      a.Baseline,
+			"triggered":     a.Triggered,
+			"last_period":   a.LastPeriod,
+			"last_fired_at": a.LastFiredAt,
+		}).Error
+}
@@ -0,0 +1,17 @@
+package alert
+
+import (
+	"asum/pkg/engine"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler) {
+	alert := r.Group("/alert")
+	{
+		alert.Get("/", engine.H(h.ListAlerts))
+		alert.Post("/", engine.H(h.CreateAlert))
+		alert.Patch("/:id", engine.H(h.UpdateAlert))
+		alert.Delete("/:id", engine.H(h.DeleteAlert))
+	}
+}
@@ -0,0 +1,318 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"asum/internal/auth"
+	"asum/internal/notify"
+	"asum/internal/task"
+	"asum/internal/user"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/queue"
+	"asum/pkg/rdb"
+	"asum/pkg/usage"
+	"asum/pkg/webhook"
+)
+
+type Service interface {
+	List(c context.Context, userID uint64) ([]models.UsageAlert, error)
+	Create(c context.Context, userID uint64, req *CreateAlertReq) (*models.UsageAlert, error)
+	Update(c context.Context, id, userID uint64, req *UpdateAlertReq) (*models.UsageAlert, error)
+	Delete(c context.Context, id, userID uint64) error
+	RunEvaluator(ctx context.Context, interval time.Duration) error
+}
+
+const (
+	maxAlertsPerUser = 20
+	// firedTTL 覆盖一个统计周期，多实例同时评估时只有一个实例能发出告警
+	firedTTL = 48 * time.Hour
+)
+
+type service struct {
+	repo     Repository
+	userRepo user.Repository
+	taskRepo task.Repository
+	cache    *rdb.Client
+	q        *queue.RedisQueue[*auth.EmailJob]
+	hooks    *webhook.Dispatcher
+}
+
+func NewService(repo Repository, userRepo user.Repository, taskRepo task.Repository, cache *rdb.Client, emailQueue *queue.RedisQueue[*auth.EmailJob], hooks *webhook.Dispatcher) Service {
+	return &service{
+		repo:     repo,
+		userRepo: userRepo,
+		taskRepo: taskRepo,
+		cache:    cache,
+		q:        emailQueue,
+		hooks:    hooks,
+	}
+}
+
+func (s *service) List(c context.Context, userID uint64) ([]models.UsageAlert, error) {
+	return s.repo.ListByUser(c, userID)
+}
+
+func (s *service) Create(c context.Context, userID uint64, req *CreateAlertReq) (*models.UsageAlert, error) {
+	if !slices.Contains(models.AlertMetrics, req.Metric) || !validThreshold(req.Metric, req.Threshold) {
+		return nil, errorx.ErrInvalidAlert
+	}
+	// 余额属于账户，不能按 task 设置
+	if req.Metric == models.AlertQuotaRemainingPct && req.TaskID != 0 {
+		return nil, errorx.ErrInvalidAlert
+	}
+	if req.TaskID != 0 {
+		ok, err := s.taskRepo.IsMember(c, req.TaskID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errorx.ErrTaskForbidden
+		}
+	}
+
+	count, err := s.repo.CountByUser(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxAlertsPerUser {
+		return nil, errorx.ErrInvalidAlert
+	}
+
+	a := &models.UsageAlert{
+		UserID:    userID,
+		TaskID:    req.TaskID,
+		Metric:    req.Metric,
+		Threshold: req.Threshold,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	}
+	if a.Metric == models.AlertQuotaRemainingPct {
+		u, err := s.userRepo.FindByID(c, userID)
+		if err != nil {
+			return nil, err
+		}
+		a.Baseline = int64(u.Quota)
+	}
+	if err := s.repo.Create(c, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *service) Update(c context.Context, id, userID uint64, req *UpdateAlertReq) (*models.UsageAlert, error) {
+	a, err := s.repo.FindByID(c, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Threshold != nil {
+		if !validThreshold(a.Metric, *req.Threshold) {
+			return nil, errorx.ErrInvalidAlert
+		}
+		a.Threshold = *req.Threshold
+		// 阈值变化后按新阈值重新判断是否越线
+		a.Triggered = false
+	}
+	if req.Enabled != nil {
+		a.Enabled = *req.Enabled
+	}
+	if err := s.repo.Update(c, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *service) Delete(c context.Context, id, userID uint64) error {
+	return s.repo.Delete(c, id, userID)
+}
+
+func validThreshold(metric string, threshold int64) bool {
+	switch metric {
+	case models.AlertQuotaRemainingPct:
+		return threshold >= 1 && threshold <= 99
+	case models.AlertDailyUsage:
+		return threshold > 0
+	}
+	return false
+}
+
+// RunEvaluator 定期对照用量计数与账户余额检查全部启用的告警规则；
+// 每条规则在越线时告警一次，同一统计周期（UTC 自然日）内最多告警一次
+func (s *service) RunEvaluator(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		alerts, err := s.repo.ListEnabled(ctx)
+		if err != nil {
+			logx.Errorf("list usage alerts: %v", err)
+			continue
+		}
+		for i := range alerts {
+			if err := s.evaluate(ctx, &alerts[i]); err != nil {
+				logx.Errorf("evaluate usage alert %d: %v", alerts[i].ID, err)
+			}
+		}
+	}
+}
+
+type AlertEvent struct {
+	Type      string `json:"type"`
+	AlertID   uint64 `json:"alertId"`
+	TaskID    uint64 `json:"taskId,omitempty"`
+	Metric    string `json:"metric"`
+	Threshold int64  `json:"threshold"`
+	Value     int64  `json:"value"`
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+}
+
+func (s *service) evaluate(ctx context.Context, a *models.UsageAlert) error {
+	period := usage.Today()
+	before := *a
+
+	var value int64
+	var crossed bool
+	switch a.Metric {
+	case models.AlertDailyUsage:
+		var daily []usage.Daily
+		var err error
+		if a.TaskID != 0 {
+			daily, err = usage.TaskDays(ctx, s.cache, a.TaskID, 1)
+		} else {
+			daily, err = usage.UserDays(ctx, s.cache, a.UserID, 1)
+		}
+		if err != nil {
+			return err
+		}
+		value = daily[0].Count
+		crossed = value > a.Threshold
+	case models.AlertQuotaRemainingPct:
+		u, err := s.userRepo.FindByID(ctx, a.UserID)
+		if err != nil {
+			return err
+		}
+		value = int64(u.Quota)
+		// 充值后以新余额为基准重新布防
+		if value > a.Baseline {
+			a.Baseline = value
+			a.Triggered = false
+		}
+		crossed = a.Baseline > 0 && value*100 < a.Baseline*a.Threshold
+	default:
+		return nil
+	}
+
+	if !crossed {
+		a.Triggered = false
+		return s.saveIfChanged(ctx, &before, a)
+	}
+	if a.Triggered || a.LastPeriod == period {
+		a.Triggered = true
+		return s.saveIfChanged(ctx, &before, a)
+	}
+
+	fired, err := s.cache.SetNX(ctx, fmt.Sprintf("alert:fired:%d:%s", a.ID, period), 1, firedTTL).Result()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	a.Triggered = true
+	a.LastPeriod = period
+	if fired {
+		a.LastFiredAt = &now
+	}
+	if err := s.repo.SaveState(ctx, a); err != nil {
+		return err
+	}
+	if !fired {
+		return nil
+	}
+	return s.fire(ctx, a, value)
+}
+
+func (s *service) saveIfChanged(ctx context.Context, before, a *models.UsageAlert) error {
+	if before.Baseline == a.Baseline && before.Triggered == a.Triggered {
+		return nil
+	}
+	return s.repo.SaveState(ctx, a)
+}
+
+func (s *service) fire(ctx context.Context, a *models.UsageAlert, value int64) error {
+	ev := AlertEvent{
+		Type:      "usage_alert",
+		AlertID:   a.ID,
+		TaskID:    a.TaskID,
+		Metric:    a.Metric,
+		Threshold: a.Threshold,
+		Value:     value,
+	}
+	switch a.Metric {
+	case models.AlertDailyUsage:
+		ev.Title = fmt.Sprintf("今日调用量已超过 %d 次", a.Threshold)
+		ev.Detail = fmt.Sprintf("账户今日调用量已达 %d 次。", value)
+		if a.TaskID != 0 {
+			name := fmt.Sprintf("#%d", a.TaskID)
+			if t, err := s.taskRepo.FindByID(ctx, a.TaskID); err == nil {
+				name = t.Name
+			}
+			ev.Detail = fmt.Sprintf("任务「%s」今日调用量已达 %d 次。", name, value)
+		}
+	case models.AlertQuotaRemainingPct:
+		ev.Title = fmt.Sprintf("剩余余额低于 %d%%", a.Threshold)
+		ev.Detail = fmt.Sprintf("当前余额 %d，充值后余额为 %d，余额耗尽后批量查询将被拒绝。", value, a.Baseline)
+	}
+
+	if _, err := notify.IncUnread(ctx, s.cache, a.UserID, 1); err != nil {
+		logx.Errorf("inc unread %d: %v", a.UserID, err)
+	}
+	if err := notify.PublishUser(ctx, s.cache, notify.StreamKeyDefault, a.UserID, ev); err != nil {
+		logx.Errorf("publish usage alert %d: %v", a.ID, err)
+	}
+	if a.Metric == models.AlertQuotaRemainingPct {
+		s.publishQuotaLow(ctx, a, value)
+	}
+
+	u, err := s.userRepo.FindByID(ctx, a.UserID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&auth.UsageAlertPayload{Title: ev.Title, Detail: ev.Detail})
+	if err != nil {
+		return err
+	}
+	return s.q.Push(ctx, &auth.EmailJob{
+		EmailType: auth.TypeUsageAlert,
+		To:        u.Email,
+		Name:      u.Name,
+		Data:      payload,
+	})
+}
+
+// publishQuotaLow 余额属于账户，推送到该用户拥有的全部 task 的 webhook
+func (s *service) publishQuotaLow(ctx context.Context, a *models.UsageAlert, value int64) {
+	tasks, err := s.userRepo.GetTasks(ctx, a.UserID)
+	if err != nil {
+		logx.Errorf("list tasks of user %d: %v", a.UserID, err)
+		return
+	}
+	data := &webhook.QuotaLowData{Quota: value, Baseline: a.Baseline, Threshold: a.Threshold}
+	for _, t := range tasks {
+		if t.Role != models.RoleOwner {
+			continue
+		}
+		if err := s.hooks.Publish(ctx, t.TaskID, models.EventQuotaLow, data); err != nil {
+			logx.Errorf("publish quota webhook of task %d: %v", t.TaskID, err)
+		}
+	}
+}
@@ -19,6 +19,12 @@ const (
 	TypeRegister EmailType = iota
 	TypePasswordReset
 	TypeVerifyCode
+	TypeUsageAlert
+	TypeTaskInvite
+	TypeAccountDeletion
+	TypeEmailChangeConfirm
+	TypeEmailChangeNotice
+	TypeMFAChanged
 )
 
 type EmailJob struct {
@@ -34,6 +40,34 @@ type ConfirmPayload struct {
 	Link string `json:"link"`
 }
 
+type UsageAlertPayload struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+type InvitePayload struct {
+	TaskName string `json:"taskName"`
+	Inviter  string `json:"inviter"`
+	Role     string `json:"role"`
+	Link     string `json:"link"`
+}
+
+type DeletionPayload struct {
+	Link           string `json:"link"`
+	CoolingOffDays int    `json:"coolingOffDays"`
+}
+
+type EmailChangePayload struct {
+	NewEmail string `json:"newEmail"`
+	Link     string `json:"link"`
+}
+
+type MFAPayload struct {
+	Enabled bool   `json:"enabled"`
+	IP      string `json:"ip"`
+	Time    string `json:"time"`
+}
+
 type Consumer struct {
 	q      *queue.RedisQueue[*EmailJob]
 	mailer *mailer.Mailer
@@ -123,6 +157,48 @@ func (c *Consumer) processJob(job *EmailJob) {
 		}
 		logx.Infof("code = %s", payload.Code)
 		err = c.mailer.SendVerificationEmail(ctx, job.To, job.Name, payload.Code)
+	case TypeUsageAlert:
+		var payload UsageAlertPayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的用量提醒: %v", err)
+			return
+		}
+		err = c.mailer.SendUsageAlertEmail(ctx, job.To, job.Name, payload.Title, payload.Detail)
+	case TypeTaskInvite:
+		var payload InvitePayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的任务邀请: %v", err)
+			return
+		}
+		err = c.mailer.SendTaskInviteEmail(ctx, job.To, payload.Inviter, payload.TaskName, payload.Role, payload.Link)
+	case TypeAccountDeletion:
+		var payload DeletionPayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的注销请求: %v", err)
+			return
+		}
+		err = c.mailer.SendAccountDeletionEmail(ctx, job.To, job.Name, payload.Link, payload.CoolingOffDays)
+	case TypeEmailChangeConfirm:
+		var payload EmailChangePayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的修改邮箱确认: %v", err)
+			return
+		}
+		err = c.mailer.SendEmailChangeConfirmEmail(ctx, job.To, job.Name, payload.Link)
+	case TypeEmailChangeNotice:
+		var payload EmailChangePayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的修改邮箱通知: %v", err)
+			return
+		}
+		err = c.mailer.SendEmailChangeNoticeEmail(ctx, job.To, job.Name, payload.NewEmail, payload.Link)
+	case TypeMFAChanged:
+		var payload MFAPayload
+		if err := json.Unmarshal(job.Data, &payload); err != nil {
+			logx.Errorf("无效的两步验证通知: %v", err)
+			return
+		}
+		err = c.mailer.SendMFAChangedEmail(ctx, job.To, job.Name, payload.Enabled, payload.IP, payload.Time)
 	default:
 		logx.Errorf("未知的请求抬头: %d", job.EmailType)
 		return
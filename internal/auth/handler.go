@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"errors"
+	"time"
+
 	"asum/pkg/engine"
 	"asum/pkg/errorx"
+	"asum/pkg/utils"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -20,16 +24,22 @@ func NewHandler(authSvc Service) *Handler {
 type LoginReq struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
+	// Device 为客户端自定的设备名，为空时从 User-Agent 推断
+	Device string `json:"device,omitempty"`
 }
 type LoginResp struct {
-	Token        string    `json:"token"`
+	Token        string    `json:"token,omitempty"`
 	RefreshToken string    `json:"refreshToken,omitempty"`
-	User         *UserInfo `json:"user"`
+	SessionID    string    `json:"sessionId,omitempty"`
+	User         *UserInfo `json:"user,omitempty"`
+	// MFARequired 为 true 时上面的字段都为空，需用 MFAToken 调用 /auth/login/mfa 完成登录
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
 }
 
 // Login 用户登录
 // @Summary 用户登录
-// @Description 使用邮箱和密码登录
+// @Description 使用邮箱和密码登录；已启用两步验证时返回 mfaRequired 与 5 分钟内有效的 mfaToken
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -37,6 +47,7 @@ type LoginResp struct {
 // @Success 200 {object} engine.Response{data=LoginResp}
 // @Failure 400 {object} engine.Response
 // @Failure 401 {object} engine.Response
+// @Failure 429 {object} engine.Response "两步验证失败次数过多"
 // @Router /auth/login [post]
 func (h *Handler) Login(c *engine.Ctx) error {
 	var req LoginReq
@@ -46,12 +57,54 @@ func (h *Handler) Login(c *engine.Ctx) error {
 
 	data, err := h.service.Login(c.StdCtx, &req)
 	if err != nil {
+		if errors.Is(err, errorx.ErrMFALocked) {
+			return c.Fail(fiber.StatusTooManyRequests, err.Error())
+		}
 		return c.Fail(fiber.StatusForbidden, err.Error())
 	}
 
 	return c.OK(data)
 }
 
+type LoginMFAReq struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	// Code 为验证器中的 6 位验证码或一次性恢复码
+	Code string `json:"code" validate:"required"`
+}
+
+// LoginMFA 两步验证登录
+// @Summary 两步验证登录
+// @Description 用登录返回的 mfaToken 与验证码（或恢复码）换取令牌；同一用户 15 分钟内最多尝试 10 次，重新登录不会重置，验证成功后清零。
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body LoginMFAReq true "mfaToken 与验证码"
+// @Success 200 {object} engine.Response{data=LoginResp}
+// @Failure 400 {object} engine.Response "验证码或恢复码无效"
+// @Failure 401 {object} engine.Response "mfaToken 无效或已过期"
+// @Failure 429 {object} engine.Response "两步验证失败次数过多"
+// @Router /auth/login/mfa [post]
+func (h *Handler) LoginMFA(c *engine.Ctx) error {
+	var req LoginMFAReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.LoginMFA(c.StdCtx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errorx.ErrMFACodeInvalid):
+			return c.Fail(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, errorx.ErrMFATokenExpired):
+			return c.Fail(fiber.StatusUnauthorized, err.Error())
+		case errors.Is(err, errorx.ErrMFALocked):
+			return c.Fail(fiber.StatusTooManyRequests, err.Error())
+		}
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
 type RegisterReq struct {
 	Name     string `json:"name" validate:"required,min=2,max=50"`
 	Email    string `json:"email" validate:"required,email"`
@@ -194,6 +247,7 @@ type UserInfo struct {
 
 // RefreshToken 刷新 Token
 // @Summary 刷新 Access Token
+// @Description refresh token 只能使用一次，每次刷新都会返回新的 refresh token；旧 token 被重复使用时该会话立即退出。
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -210,12 +264,32 @@ func (h *Handler) RefreshToken(c *engine.Ctx) error {
 
 	data, err := h.service.RefreshToken(c, &req)
 	if err != nil {
+		if errors.Is(err, errorx.ErrTokenInvalid) || errors.Is(err, errorx.ErrRefreshReused) {
+			return c.Fail(fiber.StatusUnauthorized, err.Error())
+		}
 		return c.Fail(fiber.StatusForbidden, err.Error())
 	}
 
 	return c.OK(data)
 }
 
+// Logout 退出登录
+// @Summary 退出登录
+// @Description 当前 access token 立即失效，所属会话的 refresh token 也一并作废。
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response "已退出"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /auth/logout [post]
+func (h *Handler) Logout(c *engine.Ctx) error {
+	err := h.service.Logout(c.StdCtx, utils.GetUserID(c), utils.GetSessionID(c), utils.GetTokenID(c), utils.GetTokenExpiresAt(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(nil)
+}
+
 type ResetPasswordReq struct {
 	Email string `json:"email" validate:"required,email"`
 }
@@ -270,3 +344,237 @@ func (h *Handler) ResetPasswordConfirm(c *engine.Ctx) error {
 
 	return c.OK(data)
 }
+
+type MFAStatusResp struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt,omitempty"`
+	RecoveryCodesLeft int64      `json:"recoveryCodesLeft"`
+}
+
+type MFAEnrollReq struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type MFAEnrollResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFACodeReq struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFARecoveryResp struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MFADisableReq struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// GetMFA 查看两步验证状态
+// @Summary 查看两步验证状态
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=MFAStatusResp}
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me/mfa [get]
+func (h *Handler) GetMFA(c *engine.Ctx) error {
+	data, err := h.service.MFAStatus(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// EnrollMFA 绑定验证器
+// @Summary 绑定验证器
+// @Description 校验密码后返回新的密钥与 otpauth URI（可生成二维码），调用 /confirm 提交首个验证码后才会启用。
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body MFAEnrollReq true "当前密码"
+// @Success 200 {object} engine.Response{data=MFAEnrollResp}
+// @Failure 400 {object} engine.Response "密码错误或已启用两步验证"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能修改两步验证"
+// @Router /app/user/me/mfa/enroll [post]
+func (h *Handler) EnrollMFA(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req MFAEnrollReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.EnrollMFA(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		return h.failMFA(c, err)
+	}
+	return c.OK(data)
+}
+
+// ConfirmMFA 启用两步验证
+// @Summary 启用两步验证
+// @Description 提交验证器中的首个验证码，成功后返回 10 个一次性恢复码，只显示这一次；同时向账号邮箱发送通知。
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body MFACodeReq true "验证码"
+// @Success 200 {object} engine.Response{data=MFARecoveryResp}
+// @Failure 400 {object} engine.Response "验证码无效、未获取密钥或已启用"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能修改两步验证"
+// @Router /app/user/me/mfa/confirm [post]
+func (h *Handler) ConfirmMFA(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req MFACodeReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.ConfirmMFA(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		return h.failMFA(c, err)
+	}
+	return c.OK(data)
+}
+
+// DisableMFA 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 需要当前密码与验证码（或恢复码），成功后删除密钥与全部恢复码，并向账号邮箱发送通知。
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body MFADisableReq true "密码与验证码"
+// @Success 200 {object} engine.Response "已关闭"
+// @Failure 400 {object} engine.Response "密码或验证码错误、未启用两步验证"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能修改两步验证"
+// @Failure 429 {object} engine.Response "两步验证失败次数过多"
+// @Router /app/user/me/mfa/disable [post]
+func (h *Handler) DisableMFA(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req MFADisableReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.DisableMFA(c.StdCtx, utils.GetUserID(c), &req); err != nil {
+		return h.failMFA(c, err)
+	}
+	return c.OK(nil)
+}
+
+func (h *Handler) failMFA(c *engine.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errorx.ErrInvalidCredentials),
+		errors.Is(err, errorx.ErrMFACodeInvalid),
+		errors.Is(err, errorx.ErrMFAEnabled),
+		errors.Is(err, errorx.ErrMFANotEnabled),
+		errors.Is(err, errorx.ErrMFANotEnrolled):
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	case errors.Is(err, errorx.ErrMFALocked):
+		return c.Fail(fiber.StatusTooManyRequests, err.Error())
+	}
+	return c.Fail(fiber.StatusInternalServerError, err.Error())
+}
+
+type OAuthCallbackReq struct {
+	Provider string `json:"-"`
+	Code     string `query:"code"`
+	State    string `query:"state"`
+	Error    string `query:"error"`
+}
+
+// OAuthProviders 第三方登录方式列表
+// @Summary 第三方登录方式列表
+// @Description 返回已配置的第三方登录名称，用于 /auth/oauth/{provider}
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} engine.Response{data=[]string}
+// @Router /auth/oauth [get]
+func (h *Handler) OAuthProviders(c *engine.Ctx) error {
+	return c.OK(h.service.OAuthProviders())
+}
+
+// OAuthStart 发起第三方登录
+// @Summary 发起第三方登录
+// @Description 生成 state、nonce 与 PKCE 参数后跳转到第三方授权页，10 分钟内有效
+// @Tags Auth
+// @Param provider path string true "登录方式，如 google、github"
+// @Success 302 "跳转到第三方授权页"
+// @Failure 404 {object} engine.Response "不支持的登录方式"
+// @Router /auth/oauth/{provider} [get]
+func (h *Handler) OAuthStart(c *engine.Ctx) error {
+	url, err := h.service.OAuthURL(c.StdCtx, c.Params("provider"))
+	if err != nil {
+		if errors.Is(err, errorx.ErrOAuthProvider) {
+			return c.Fail(fiber.StatusNotFound, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.Redirect().To(url)
+}
+
+// OAuthCallback 第三方登录回调
+// @Summary 第三方登录回调
+// @Description 校验 state 后用授权码换取身份：已关联的直接登录；邮箱已验证时关联同邮箱用户，没有则新建并激活。返回与登录相同，已启用两步验证时返回 mfaToken。
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "登录方式"
+// @Param code query string true "授权码"
+// @Param state query string true "发起时生成的 state"
+// @Success 200 {object} engine.Response{data=LoginResp}
+// @Failure 400 {object} engine.Response "state 无效、第三方登录失败或邮箱未验证"
+// @Failure 403 {object} engine.Response "此用户被封号"
+// @Failure 404 {object} engine.Response "不支持的登录方式"
+// @Failure 429 {object} engine.Response "两步验证失败次数过多"
+// @Router /auth/oauth/{provider}/callback [get]
+func (h *Handler) OAuthCallback(c *engine.Ctx) error {
+	var req OAuthCallbackReq
+	if err := c.Bind().Query(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	req.Provider = c.Params("provider")
+
+	data, err := h.service.OAuthCallback(c.StdCtx, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errorx.ErrOAuthProvider):
+			return c.Fail(fiber.StatusNotFound, err.Error())
+		case errors.Is(err, errorx.ErrOAuthState),
+			errors.Is(err, errorx.ErrOAuthFailed),
+			errors.Is(err, errorx.ErrOAuthEmailUnverified):
+			return c.Fail(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, errorx.ErrUserBanned):
+			return c.Fail(fiber.StatusForbidden, err.Error())
+		case errors.Is(err, errorx.ErrMFALocked):
+			return c.Fail(fiber.StatusTooManyRequests, err.Error())
+		}
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// JWKS 签名公钥
+// @Summary 签名公钥
+// @Description 返回验证 access token 的公钥（RFC 7517），包含即将启用的下一把密钥；其他服务据此按 kid 离线验证令牌。使用 HS256 时为空列表。
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} token.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) JWKS(c *engine.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.service.JWKS())
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/totp"
+	"asum/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	mfaPendingExpiry = 5 * time.Minute
+	// 同一用户在 mfaAttemptWindow 内最多尝试 mfaMaxAttempts 次，与 mfaToken 无关，
+	// 重新登录拿到新的 mfaToken 不会重置；验证成功后清零
+	mfaMaxAttempts     = 10
+	mfaAttemptWindow   = 15 * time.Minute
+	recoveryCodeCount  = 10
+	mfaPendingPrefix   = "mfa:pending:"
+	mfaAttemptsPrefix  = "mfa:attempts:"
+	recoveryCodeLength = 5
+)
+
+// mfaPending 为密码校验通过、等待两步验证的登录
+type mfaPending struct {
+	UserID uint64 `json:"userId"`
+	Device string `json:"device,omitempty"`
+}
+
+// startMFA 保存待验证的登录，返回交给客户端的一次性 mfaToken
+func (s *service) startMFA(ctx context.Context, userID uint64, device string) (string, error) {
+	raw := utils.GenerateConfirmToken()
+	data, err := json.Marshal(&mfaPending{UserID: userID, Device: device})
+	if err != nil {
+		return "", err
+	}
+	if err := s.cache.Set(ctx, mfaPendingPrefix+utils.HashToken(raw), data, mfaPendingExpiry).Err(); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// LoginMFA 用 TOTP 验证码或恢复码完成两步验证，换取正式的令牌；mfaToken 成功后立即失效
+func (s *service) LoginMFA(ctx context.Context, req *LoginMFAReq) (*LoginResp, error) {
+	pendingKey := mfaPendingPrefix + utils.HashToken(req.MFAToken)
+
+	val, err := s.cache.Get(ctx, pendingKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errorx.ErrMFATokenExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending mfaPending
+	if err := json.Unmarshal([]byte(val), &pending); err != nil {
+		return nil, errorx.ErrMFATokenExpired
+	}
+
+	if err := s.attemptMFA(ctx, pending.UserID, req.Code); err != nil {
+		return nil, err
+	}
+	// 并发请求只有删除成功的那个继续
+	n, err := s.cache.Del(ctx, pendingKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errorx.ErrMFATokenExpired
+	}
+
+	u, err := s.userRepo.FindByID(ctx, pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != models.StatusActive {
+		return nil, errorx.ErrUserBanned
+	}
+	return s.issue(ctx, u, pending.Device)
+}
+
+func mfaAttemptsKey(userID uint64) string {
+	return mfaAttemptsPrefix + strconv.FormatUint(userID, 10)
+}
+
+// mfaLocked 判断用户的尝试次数是否已用完，用完时不再签发新的 mfaToken
+func (s *service) mfaLocked(ctx context.Context, userID uint64) (bool, error) {
+	n, err := s.cache.Get(ctx, mfaAttemptsKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return n >= mfaMaxAttempts, nil
+}
+
+// attemptMFA 先占用一次尝试机会再校验，并发请求也不会超出 mfaMaxAttempts
+func (s *service) attemptMFA(ctx context.Context, userID uint64, code string) error {
+	key := mfaAttemptsKey(userID)
+	attempts, err := s.cache.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if attempts == 1 {
+		_ = s.cache.Expire(ctx, key, mfaAttemptWindow).Err()
+	}
+	if attempts > mfaMaxAttempts {
+		return errorx.ErrMFALocked
+	}
+
+	if err := s.verifyMFA(ctx, userID, code); err != nil {
+		return err
+	}
+	_ = s.cache.Del(ctx, key).Err()
+	return nil
+}
+
+// verifyMFA 校验 TOTP 验证码，不匹配时再按恢复码校验；用过的验证码与恢复码都不能再次使用
+func (s *service) verifyMFA(ctx context.Context, userID uint64, code string) error {
+	m, err := s.mfa.Find(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !m.Enabled {
+		return errorx.ErrMFANotEnabled
+	}
+	secret, err := s.totp.Open(m.Secret)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := totp.Verify(secret, code, time.Now()); ok {
+		fresh, err := s.mfa.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errorx.ErrMFACodeInvalid
+		}
+		return nil
+	}
+
+	used, err := s.mfa.UseRecoveryCode(ctx, userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errorx.ErrMFACodeInvalid
+	}
+	return nil
+}
+
+func (s *service) MFAStatus(ctx context.Context, userID uint64) (*MFAStatusResp, error) {
+	m, err := s.mfa.Find(ctx, userID)
+	if errors.Is(err, errorx.ErrMFANotEnrolled) {
+		return &MFAStatusResp{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &MFAStatusResp{Enabled: m.Enabled, EnabledAt: m.EnabledAt}
+	if m.Enabled {
+		if resp.RecoveryCodesLeft, err = s.mfa.RecoveryCodesLeft(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// EnrollMFA 校验密码后生成新的密钥，确认首个验证码前不生效
+func (s *service) EnrollMFA(ctx context.Context, userID uint64, req *MFAEnrollReq) (*MFAEnrollResp, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(req.Password, u.Password) {
+		return nil, errorx.ErrInvalidCredentials
+	}
+
+	secret := totp.GenerateSecret()
+	if err := s.mfa.Enroll(ctx, userID, s.totp.Seal(secret)); err != nil {
+		return nil, err
+	}
+	return &MFAEnrollResp{
+		Secret: secret,
+		URI:    totp.URI(s.totp.Issuer(), u.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA 用首个验证码确认绑定，启用两步验证并返回恢复码；恢复码只在这里出现一次
+func (s *service) ConfirmMFA(ctx context.Context, userID uint64, req *MFACodeReq) (*MFARecoveryResp, error) {
+	m, err := s.mfa.Find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Enabled {
+		return nil, errorx.ErrMFAEnabled
+	}
+	secret, err := s.totp.Open(m.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Verify(secret, req.Code, time.Now())
+	if !ok {
+		return nil, errorx.ErrMFACodeInvalid
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i] = utils.GenerateRandomKey(recoveryCodeLength)
+		codes[i] = codes[i][:recoveryCodeLength] + "-" + codes[i][recoveryCodeLength:]
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := s.mfa.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	s.afterMFAChange(ctx, userID, true)
+	return &MFARecoveryResp{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA 需要密码与验证码（或恢复码）同时正确
+func (s *service) DisableMFA(ctx context.Context, userID uint64, req *MFADisableReq) error {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPassword(req.Password, u.Password) {
+		return errorx.ErrInvalidCredentials
+	}
+	if err := s.attemptMFA(ctx, userID, req.Code); err != nil {
+		return err
+	}
+	if err := s.mfa.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.afterMFAChange(ctx, userID, false)
+	return nil
+}
+
+// afterMFAChange 记录日志并通知账号邮箱
+func (s *service) afterMFAChange(ctx context.Context, userID uint64, enabled bool) {
+	logType := models.LogTypeDisableMFA
+	if enabled {
+		logType = models.LogTypeEnableMFA
+	}
+	ip := utils.GetRemoteIP(ctx)
+	_ = s.userRepo.AddLog(ctx, &models.UserLog{
+		UserID:    userID,
+		Type:      logType,
+		IP:        ip,
+		UserAgent: utils.GetUserAgent(ctx),
+	})
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		logx.Errorf("mfa notice: find user %d: %v", userID, err)
+		return
+	}
+	data, err := json.Marshal(&MFAPayload{
+		Enabled: enabled,
+		IP:      ip,
+		Time:    time.Now().Format("2006-01-02 15:04:05 MST"),
+	})
+	if err != nil {
+		logx.Errorf("email marshal err: %v", err)
+		return
+	}
+	if err := s.q.Push(ctx, &EmailJob{
+		RequestID: utils.GetRequestID(ctx),
+		EmailType: TypeMFAChanged,
+		To:        u.Email,
+		Name:      u.Name,
+		Data:      data,
+	}); err != nil {
+		logx.Errorf("push email job err: %s: %v", u.Email, err)
+	}
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"asum/internal/user"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/oidc"
+	"asum/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oauthStateExpiry = 10 * time.Minute
+	oauthStatePrefix = "oauth:state:"
+)
+
+// oauthState 为发起授权时保存的参数，回调时凭 state 取回，只能使用一次
+type oauthState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func (s *service) OAuthProviders() []string {
+	return s.oauth.Names()
+}
+
+// OAuthURL 生成 state、nonce 与 PKCE verifier，返回第三方授权页地址
+func (s *service) OAuthURL(ctx context.Context, provider string) (string, error) {
+	p, err := s.oauth.Get(provider)
+	if err != nil {
+		return "", errorx.ErrOAuthProvider
+	}
+	req := oidc.NewAuthRequest()
+	data, err := json.Marshal(&oauthState{Provider: provider, Nonce: req.Nonce, Verifier: req.Verifier})
+	if err != nil {
+		return "", err
+	}
+	if err := s.cache.Set(ctx, oauthStatePrefix+req.State, data, oauthStateExpiry).Err(); err != nil {
+		return "", err
+	}
+	return p.AuthCodeURL(ctx, req)
+}
+
+// OAuthCallback 校验 state 并用授权码换取身份，关联或创建用户后按普通登录签发令牌（含两步验证）
+func (s *service) OAuthCallback(ctx context.Context, req *OAuthCallbackReq) (*LoginResp, error) {
+	p, err := s.oauth.Get(req.Provider)
+	if err != nil {
+		return nil, errorx.ErrOAuthProvider
+	}
+	if req.State == "" {
+		return nil, errorx.ErrOAuthState
+	}
+	val, err := s.cache.GetDel(ctx, oauthStatePrefix+req.State).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errorx.ErrOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st oauthState
+	if err := json.Unmarshal([]byte(val), &st); err != nil || st.Provider != req.Provider {
+		return nil, errorx.ErrOAuthState
+	}
+	if req.Error != "" || req.Code == "" {
+		return nil, errorx.ErrOAuthFailed
+	}
+
+	id, err := p.Exchange(ctx, req.Code, &oidc.AuthRequest{State: req.State, Nonce: st.Nonce, Verifier: st.Verifier})
+	if err != nil {
+		logx.Errorf("oauth %s exchange: %v", req.Provider, err)
+		return nil, errorx.ErrOAuthFailed
+	}
+
+	u, err := s.linkIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status == models.StatusBanned {
+		return nil, errorx.ErrUserBanned
+	}
+	return s.signIn(ctx, u, "")
+}
+
+// linkIdentity 找到第三方账号关联的用户；尚未关联时按已验证的邮箱关联已有用户，
+// 没有该邮箱的用户则新建并激活，与邮件激活一样初始化默认空间
+func (s *service) linkIdentity(ctx context.Context, id *oidc.Identity) (*models.User, error) {
+	ident, err := s.identities.Find(ctx, id.Provider, id.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if ident != nil {
+		return s.userRepo.FindByID(ctx, ident.UserID)
+	}
+
+	email := utils.SanitizeEmail(id.Email)
+	if !id.EmailVerified || utils.ValidateEmail(email) != nil {
+		return nil, errorx.ErrOAuthEmailUnverified
+	}
+
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		if u, err = s.createOAuthUser(ctx, email, id.Name); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case u.Status == models.StatusBanned:
+		return nil, errorx.ErrUserBanned
+	case u.Status == models.StatusInactive:
+		// 第三方已验证邮箱，视同完成了邮件激活。未激活的账号可能是别人抢先用这个邮箱注册的，
+		// 注册时设的密码不能保留，否则注册者激活后可以直接用密码登录；邮箱主人需要密码时走找回密码
+		if u.Password, err = randomPassword(); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.Update(ctx, u); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.UserActiveAndInit(ctx, u.ID, u.Level); err != nil {
+			return nil, err
+		}
+		u.Status = models.StatusActive
+	}
+
+	if err := s.identities.Create(ctx, &models.UserIdentity{
+		UserID:   u.ID,
+		Provider: id.Provider,
+		Subject:  id.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	_ = s.userRepo.AddLog(ctx, &models.UserLog{
+		UserID:    u.ID,
+		Type:      models.LogTypeLinkIdentity,
+		IP:        utils.GetRemoteIP(ctx),
+		UserAgent: utils.GetUserAgent(ctx),
+		Extra:     id.Provider,
+	})
+	return u, nil
+}
+
+// createOAuthUser 新建的用户没有可用的密码，需要时可通过重置密码设置
+func (s *service) createOAuthUser(ctx context.Context, email, name string) (*models.User, error) {
+	name = utils.SanitizeName(name)
+	if utils.ValidateName(name) != nil {
+		name = utils.SanitizeName(email[:strings.IndexByte(email, '@')])
+	}
+	if utils.ValidateName(name) != nil {
+		name = "user"
+	}
+	hashedPassword, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &models.User{
+		Name:     name,
+		Email:    email,
+		Password: hashedPassword,
+		Level:    models.LevelBasic,
+		Status:   models.StatusInactive,
+	}
+	if err := s.userRepo.Create(ctx, u); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UserActiveAndInit(ctx, u.ID, u.Level); err != nil {
+		return nil, err
+	}
+	u.Status = models.StatusActive
+	return u, nil
+}
+
+// randomPassword 返回随机密码的哈希，没人知道原文，只能通过第三方登录或找回密码进入账号
+func randomPassword() (string, error) {
+	return utils.HashPassword(utils.GenerateRandomToken(32))
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"asum/internal/user"
+	"asum/pkg/models"
+	"asum/pkg/oidc"
+	"asum/pkg/utils"
+)
+
+// fakeUsers 只实现 linkIdentity 用到的方法，其余方法调用时 panic
+type fakeUsers struct {
+	user.Repository
+	users map[string]*models.User
+}
+
+func (f *fakeUsers) FindByEmail(_ context.Context, email string) (*models.User, error) {
+	u, ok := f.users[email]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (f *fakeUsers) Update(_ context.Context, u *models.User) error {
+	cp := *u
+	f.users[u.Email] = &cp
+	return nil
+}
+
+func (f *fakeUsers) UserActiveAndInit(_ context.Context, id uint64, _ models.Level) error {
+	for _, u := range f.users {
+		if u.ID == id {
+			u.Status = models.StatusActive
+		}
+	}
+	return nil
+}
+
+func (f *fakeUsers) AddLog(context.Context, *models.UserLog) error {
+	return nil
+}
+
+type fakeIdentities struct {
+	created []models.UserIdentity
+}
+
+func (f *fakeIdentities) Find(context.Context, string, string) (*models.UserIdentity, error) {
+	return nil, nil
+}
+
+func (f *fakeIdentities) Create(_ context.Context, ident *models.UserIdentity) error {
+	f.created = append(f.created, *ident)
+	return nil
+}
+
+func TestLinkIdentityReplacesInactivePassword(t *testing.T) {
+	const email = "victim@example.com"
+	hashed, err := utils.HashPassword("squatter-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUsers{users: map[string]*models.User{
+		email: {ID: 7, Email: email, Password: hashed, Status: models.StatusInactive},
+	}}
+	identities := &fakeIdentities{}
+	s := &service{userRepo: users, identities: identities}
+
+	u, err := s.linkIdentity(context.Background(), &oidc.Identity{
+		Provider:      "google",
+		Subject:       "42",
+		Email:         email,
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("linkIdentity: %v", err)
+	}
+	if u.ID != 7 || u.Status != models.StatusActive {
+		t.Errorf("linked user = %d status %d, want 7 active", u.ID, u.Status)
+	}
+	stored := users.users[email]
+	if stored.Status != models.StatusActive {
+		t.Errorf("stored status = %d, want active", stored.Status)
+	}
+	if utils.CheckPassword("squatter-password", stored.Password) {
+		t.Error("password set before activation still works after linking")
+	}
+	if len(identities.created) != 1 || identities.created[0].UserID != 7 {
+		t.Errorf("identities = %+v, want one for user 7", identities.created)
+	}
+}
+
+func TestLinkIdentityKeepsActivePassword(t *testing.T) {
+	const email = "owner@example.com"
+	hashed, err := utils.HashPassword("owner-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUsers{users: map[string]*models.User{
+		email: {ID: 8, Email: email, Password: hashed, Status: models.StatusActive},
+	}}
+	s := &service{userRepo: users, identities: &fakeIdentities{}}
+
+	if _, err := s.linkIdentity(context.Background(), &oidc.Identity{
+		Provider:      "google",
+		Subject:       "43",
+		Email:         email,
+		EmailVerified: true,
+	}); err != nil {
+		t.Fatalf("linkIdentity: %v", err)
+	}
+	if !utils.CheckPassword("owner-password", users.users[email].Password) {
+		t.Error("password of an active account changed after linking")
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MFARepository 保存两步验证的密钥与恢复码
+type MFARepository interface {
+	Find(ctx context.Context, userID uint64) (*models.UserMFA, error)
+	Enroll(ctx context.Context, userID uint64, sealed string) error
+	Enable(ctx context.Context, userID uint64, step int64, codeHashes []string) error
+	UseStep(ctx context.Context, userID uint64, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error)
+	RecoveryCodesLeft(ctx context.Context, userID uint64) (int64, error)
+	Delete(ctx context.Context, userID uint64) error
+}
+
+type mfaRepository struct {
+	db *db.DB
+}
+
+func NewMFARepository(pg *db.DB) MFARepository {
+	if err := pg.AutoMigrate(&models.UserMFA{}, &models.MFARecoveryCode{}); err != nil {
+		panic(err)
+	}
+	return &mfaRepository{db: pg}
+}
+
+func (r *mfaRepository) Find(ctx context.Context, userID uint64) (*models.UserMFA, error) {
+	var m models.UserMFA
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Enroll 写入待确认的密钥，覆盖之前未确认的；已启用的不会被覆盖
+func (r *mfaRepository) Enroll(ctx context.Context, userID uint64, sealed string) error {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]any{"secret": sealed, "last_step": 0, "updated_at": time.Now()}),
+			Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "user_mfa", Name: "enabled"}, Value: false}}},
+		}).
+		Create(&models.UserMFA{UserID: userID, Secret: sealed})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errorx.ErrMFAEnabled
+	}
+	return nil
+}
+
+// Enable 启用两步验证并替换全部恢复码
+func (r *mfaRepository) Enable(ctx context.Context, userID uint64, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.UserMFA{}).
+			Where("user_id = ? AND enabled = ?", userID, false).
+			Updates(map[string]any{"enabled": true, "enabled_at": time.Now(), "last_step": step})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errorx.ErrMFAEnabled
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.MFARecoveryCode, len(codeHashes))
+		for i, h := range codeHashes {
+			codes[i] = models.MFARecoveryCode{UserID: userID, Hash: h}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseStep 记录已使用的时间步，step 不比上次新时返回 false，防止验证码重放
+func (r *mfaRepository) UseStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.UserMFA{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *mfaRepository) RecoveryCodesLeft(ctx context.Context, userID uint64) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *mfaRepository) Delete(ctx context.Context, userID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errorx.ErrMFANotEnabled
+		}
+		return nil
+	})
+}
+
+// IdentityRepository 保存第三方登录账号与用户的关联
+type IdentityRepository interface {
+	Find(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	Create(ctx context.Context, ident *models.UserIdentity) error
+}
+
+type identityRepository struct {
+	db *db.DB
+}
+
+func NewIdentityRepository(pg *db.DB) IdentityRepository {
+	if err := pg.AutoMigrate(&models.UserIdentity{}); err != nil {
+		panic(err)
+	}
+	return &identityRepository{db: pg}
+}
+
+// Find 未关联时返回 nil, nil
+func (r *identityRepository) Find(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var ident models.UserIdentity
+	err := r.db.WithContext(ctx).
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&ident).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ident, nil
+}
+
+func (r *identityRepository) Create(ctx context.Context, ident *models.UserIdentity) error {
+	return r.db.WithContext(ctx).Create(ident).Error
+}
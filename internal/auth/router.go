@@ -6,14 +6,37 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
-func RegisterRoutes(r fiber.Router, h *Handler) {
+// RegisterRoutes 注册登录注册相关接口，requireAuth 用于需要登录的 /logout
+func RegisterRoutes(r fiber.Router, h *Handler, requireAuth fiber.Handler) {
 	r.Post("/login", engine.H(h.Login))
+	r.Post("/login/mfa", engine.H(h.LoginMFA))
 	r.Post("/register", engine.H(h.Register))
 	r.Post("/verify", engine.H(h.Verify))
 	r.Post("/confirm/:code", engine.H(h.ConfirmCode))
 	r.Get("/confirm", engine.H(h.ConfirmURL))
 
+	r.Get("/oauth", engine.H(h.OAuthProviders))
+	r.Get("/oauth/:provider", engine.H(h.OAuthStart))
+	r.Get("/oauth/:provider/callback", engine.H(h.OAuthCallback))
+
 	r.Post("/refresh", engine.H(h.RefreshToken))
+	r.Post("/logout", requireAuth, engine.H(h.Logout))
 	r.Post("/reset-password", engine.H(h.ResetPassword))
 	r.Post("/reset-password/confirm", engine.H(h.ResetPasswordConfirm))
 }
+
+// RegisterMFARoutes 注册两步验证的管理接口，须挂在已登录的路由组下
+func RegisterMFARoutes(r fiber.Router, h *Handler) {
+	g := r.Group("/user/me/mfa")
+	{
+		g.Get("", engine.H(h.GetMFA))
+		g.Post("/enroll", engine.H(h.EnrollMFA))
+		g.Post("/confirm", engine.H(h.ConfirmMFA))
+		g.Post("/disable", engine.H(h.DisableMFA))
+	}
+}
+
+// RegisterWellKnown 在根路径注册 /.well-known/jwks.json
+func RegisterWellKnown(app fiber.Router, h *Handler) {
+	app.Get("/.well-known/jwks.json", engine.H(h.JWKS))
+}
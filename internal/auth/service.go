@@ -11,9 +11,12 @@ import (
 	"asum/pkg/errorx"
 	"asum/pkg/logx"
 	"asum/pkg/models"
+	"asum/pkg/oidc"
 	"asum/pkg/queue"
 	"asum/pkg/rdb"
+	"asum/pkg/session"
 	"asum/pkg/token"
+	"asum/pkg/totp"
 	"asum/pkg/utils"
 )
 
@@ -36,31 +39,62 @@ type Service interface {
 	ConfirmCode(ctx context.Context, email, code string) (*ConfirmResp, error)
 	ConfirmURL(ctx context.Context, req *ConfirmReq) (*ConfirmResp, error)
 	RefreshToken(ctx context.Context, req *RefreshReq) (*RefreshResp, error)
+	Logout(ctx context.Context, userID uint64, sessionID, jti string, exp time.Time) error
 	ResetPassword(ctx context.Context, req *ResetPasswordReq) (*VerifyResp, error)
 	ResetPasswordConfirm(ctx context.Context, req *ResetPasswordConfirmReq) (*ConfirmResp, error)
+
+	LoginMFA(ctx context.Context, req *LoginMFAReq) (*LoginResp, error)
+	MFAStatus(ctx context.Context, userID uint64) (*MFAStatusResp, error)
+	EnrollMFA(ctx context.Context, userID uint64, req *MFAEnrollReq) (*MFAEnrollResp, error)
+	ConfirmMFA(ctx context.Context, userID uint64, req *MFACodeReq) (*MFARecoveryResp, error)
+	DisableMFA(ctx context.Context, userID uint64, req *MFADisableReq) error
+
+	OAuthProviders() []string
+	OAuthURL(ctx context.Context, provider string) (string, error)
+	OAuthCallback(ctx context.Context, req *OAuthCallbackReq) (*LoginResp, error)
+
+	JWKS() *token.JWKS
 }
 
 type service struct {
-	userRepo user.Repository
-	jwt      *token.Manager
-	cache    *rdb.Client
-	baseURL  string
-	q        *queue.RedisQueue[*EmailJob]
+	userRepo   user.Repository
+	mfa        MFARepository
+	identities IdentityRepository
+	oauth      *oidc.Registry
+	totp       *totp.Cipher
+	jwt        *token.Manager
+	sessions   *session.Store
+	denylist   *token.Denylist
+	cache      *rdb.Client
+	baseURL    string
+	q          *queue.RedisQueue[*EmailJob]
 }
 
 func NewService(
 	userRepo user.Repository,
+	mfaRepo MFARepository,
+	identityRepo IdentityRepository,
+	oauthRegistry *oidc.Registry,
+	totpCipher *totp.Cipher,
 	emailQueue *queue.RedisQueue[*EmailJob],
 	jwtMgr *token.Manager,
+	sessions *session.Store,
+	denylist *token.Denylist,
 	cache *rdb.Client,
 	baseURL string,
 ) Service {
 	return &service{
-		userRepo: userRepo,
-		jwt:      jwtMgr,
-		cache:    cache,
-		baseURL:  baseURL,
-		q:        emailQueue,
+		userRepo:   userRepo,
+		mfa:        mfaRepo,
+		identities: identityRepo,
+		oauth:      oauthRegistry,
+		totp:       totpCipher,
+		jwt:        jwtMgr,
+		sessions:   sessions,
+		denylist:   denylist,
+		cache:      cache,
+		baseURL:    baseURL,
+		q:          emailQueue,
 	}
 }
 
@@ -89,12 +123,52 @@ func (s *service) Login(ctx context.Context, req *LoginReq) (*LoginResp, error)
 		return nil, errorx.ErrInvalidCredentials
 	}
 
-	accessToken, err := s.jwt.GenerateAccessToken(u.ID, u.Email, int(u.Level))
+	return s.signIn(ctx, u, req.Device)
+}
+
+// signIn 在第一步验证通过后调用：开启了两步验证时返回 mfaToken，否则直接签发令牌。
+// 两步验证的尝试次数已用完时直接拒绝，不再签发新的 mfaToken
+func (s *service) signIn(ctx context.Context, u *models.User, device string) (*LoginResp, error) {
+	m, err := s.mfa.Find(ctx, u.ID)
+	if err != nil && !errors.Is(err, errorx.ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if m != nil && m.Enabled {
+		locked, err := s.mfaLocked(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, errorx.ErrMFALocked
+		}
+		mfaToken, err := s.startMFA(ctx, u.ID, device)
+		if err != nil {
+			return nil, fmt.Errorf("start mfa: %w", err)
+		}
+		return &LoginResp{MFARequired: true, MFAToken: mfaToken}, nil
+	}
+
+	return s.issue(ctx, u, device)
+}
+
+// JWKS 为验证 access token 的公钥，供其他服务离线验证
+func (s *service) JWKS() *token.JWKS {
+	return s.jwt.JWKS()
+}
+
+// issue 为通过验证的登录新建会话并签发令牌
+func (s *service) issue(ctx context.Context, u *models.User, device string) (*LoginResp, error) {
+	sess, err := s.sessions.Create(ctx, u.ID, device, time.Now().Add(s.jwt.RefreshExpiry()))
+	if err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+
+	accessToken, err := s.jwt.GenerateAccessToken(u.ID, u.Email, int(u.Level), sess.ID)
 	if err != nil {
 		return nil, fmt.Errorf("generate access token: %w", err)
 	}
 
-	refreshToken, err := s.jwt.GenerateRefreshToken(u.ID, u.Email, int(u.Level))
+	refreshToken, err := s.sessions.IssueRefresh(ctx, sess)
 	if err != nil {
 		return nil, fmt.Errorf("generate refresh token: %w", err)
 	}
@@ -115,6 +189,7 @@ func (s *service) Login(ctx context.Context, req *LoginReq) (*LoginResp, error)
 	return &LoginResp{
 		Token:        accessToken,
 		RefreshToken: refreshToken,
+		SessionID:    sess.ID,
 		User: &UserInfo{
 			ID:    u.ID,
 			Name:  u.Name,
@@ -315,11 +390,31 @@ func (s *service) ConfirmURL(ctx context.Context, req *ConfirmReq) (*ConfirmResp
 	}, nil
 }
 
+// RefreshToken 轮换 refresh token 并签发新的 access token；重复使用旧 token 会撤销整个会话
 func (s *service) RefreshToken(ctx context.Context, req *RefreshReq) (*RefreshResp, error) {
-	accessToken, refreshToken, err := s.jwt.RefreshToken(req.RefreshToken)
-	if err != nil {
+	if req.RefreshToken == "" {
 		return nil, errorx.ErrTokenInvalid
 	}
+	sess, refreshToken, err := s.sessions.Rotate(ctx, req.RefreshToken, time.Now().Add(s.jwt.RefreshExpiry()))
+	if err != nil {
+		if errors.Is(err, errorx.ErrSessionRevoked) {
+			return nil, errorx.ErrTokenInvalid
+		}
+		return nil, err
+	}
+
+	u, err := s.userRepo.FindByID(ctx, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != models.StatusActive {
+		return nil, errorx.ErrUserBanned
+	}
+
+	accessToken, err := s.jwt.GenerateAccessToken(u.ID, u.Email, int(u.Level), sess.ID)
+	if err != nil {
+		return nil, fmt.Errorf("generate access token: %w", err)
+	}
 
 	return &RefreshResp{
 		Token:        accessToken,
@@ -327,6 +422,27 @@ func (s *service) RefreshToken(ctx context.Context, req *RefreshReq) (*RefreshRe
 	}, nil
 }
 
+// Logout 作废当前 access token 并撤销它所属的会话（即 refresh token 家族）
+func (s *service) Logout(ctx context.Context, userID uint64, sessionID, jti string, exp time.Time) error {
+	if err := s.denylist.Deny(ctx, jti, exp); err != nil {
+		return err
+	}
+	if sessionID != "" {
+		if err := s.sessions.Revoke(ctx, userID, sessionID); err != nil && !errors.Is(err, errorx.ErrSessionNotFound) {
+			return err
+		}
+	}
+
+	_ = s.userRepo.AddLog(ctx, &models.UserLog{
+		UserID:    userID,
+		Type:      models.LogTypeLogout,
+		IP:        utils.GetRemoteIP(ctx),
+		UserAgent: utils.GetUserAgent(ctx),
+		Extra:     sessionID,
+	})
+	return nil
+}
+
 func (s *service) ResetPassword(ctx context.Context, req *ResetPasswordReq) (*VerifyResp, error) {
 	email := utils.SanitizeEmail(req.Email)
 	u, err := s.userRepo.FindByEmail(ctx, email)
@@ -390,6 +506,10 @@ func (s *service) ResetPasswordConfirm(ctx context.Context, req *ResetPasswordCo
 	}
 
 	_ = s.cache.Del(ctx, tokenKey)
+	// 重置密码意味着密码可能已泄露，所有设备都需要重新登录
+	if _, err := s.sessions.RevokeAll(ctx, u.ID, ""); err != nil {
+		return nil, err
+	}
 	_ = s.userRepo.AddLog(ctx, &models.UserLog{
 		UserID:    u.ID,
 		Type:      models.LogTypeResetPassword,
@@ -401,6 +521,11 @@ func (s *service) ResetPasswordConfirm(ctx context.Context, req *ResetPasswordCo
 	}, nil
 }
 
+// EmailKeys 返回以邮箱为键的验证码与发信频率缓存，注销账号时一并清理
+func EmailKeys(email string) []string {
+	return []string{codeCachePrefix + email, rateLimitPrefix + email}
+}
+
 func (s *service) isRateLimited(ctx context.Context, email string) bool {
 	key := rateLimitPrefix + email
 	return s.cache.Exists(ctx, key).Val() > 0
@@ -3,6 +3,10 @@ package ip2
 import (
 	"asum/pkg/engine"
 	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/utils"
+	"bytes"
+	"strconv"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -23,26 +27,43 @@ func NewHandler(ip2Svc Service) *Handler {
 // @Tags IP
 // @Accept json
 // @Produce json
+// @Security ApiKey
 // @Param ip path string true "IP 地址 (例如: 1.1.1.1)"
-// @Param lang query string false "语言代码 (默认: en)" Enums(en, zh-CN) default(en)
+// @Param key query string false "API key，也可通过 X-API-Key 或 Authorization: ApiKey 传入"
+// @Param lang query string false "语言代码，默认沿用任务设置，未设置时为 en" Enums(en, zh-CN, de, es, fr, ja, pt-BR, ru)
+// @Param fields query string false "逗号分隔的返回字段，如 country,city,asn"
+// @Param format query string false "输出格式 json/csv"
+// @Param cidr query bool false "是否返回网段 CIDR"
+// @Param redact query bool false "是否将经纬度降到城市级精度"
 // @Success 200 {object} engine.Response{data=GetIP} "查询成功"
 // @Failure 400 {object} engine.Response "参数错误"
 // @Failure 500 {object} engine.Response "服务器内部错误"
 // @Router /ip/{ip} [get]
 func (h *Handler) GetIP(c *engine.Ctx) error {
 	ip := c.Params("ip")
-	lang := c.Query("lang", "en")
-	data, err := h.service.GetIP(c.StdCtx, ip, lang)
+	override, err := queryOverride(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+	opts, err := h.service.Options(utils.GetApiCache(c), override)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	data, err := h.service.GetIP(c.StdCtx, ip, opts)
 	if err != nil {
 		return c.Fail(fiber.StatusForbidden, err.Error())
 	}
+	if opts.Format == models.FormatCSV {
+		return sendCSV(c, []*GetIP{data}, opts)
+	}
 	return c.OK(data)
 }
 
+// BatchIps 中的 lang、fields、format、cidr、redact 未给出时沿用任务设置
 type BatchIps struct {
-	IPs    []string `json:"ips"`
-	Lang   string   `json:"lang"`
-	ApiKey string   `json:"apiKey"`
+	IPs []string `json:"ips"`
+	LookupOverride
 }
 
 // BatchIP 批量查询 IP 信息
@@ -51,9 +72,11 @@ type BatchIps struct {
 // @Tags IP
 // @Accept json
 // @Produce json
+// @Security ApiKey
 // @Param request body BatchIps true "批量查询参数"
-// @Success 200 {object} engine.Response{data=BatchIPResp} "查询成功"
+// @Success 200 {object} engine.Response{data=BatchIPResp} "查询成功；format 为 csv 时返回 text/csv，余额在 X-Quota-Remaining 头中"
 // @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "无效的API"
 // @Router /ip/batch [post]
 func (h *Handler) BatchIP(c *engine.Ctx) error {
 	var req BatchIps
@@ -61,17 +84,76 @@ func (h *Handler) BatchIP(c *engine.Ctx) error {
 		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
 	}
 
-	if req.ApiKey == "" {
-		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	apiCache := utils.GetApiCache(c)
+	if apiCache == nil {
+		return c.Fail(fiber.StatusUnauthorized, errorx.ErrInvalidTaskKey)
+	}
+
+	opts, err := h.service.Options(apiCache, req.LookupOverride)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	data, err := h.service.BatchIP(c.StdCtx, req.IPs, apiCache, opts)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	if opts.Format == models.FormatCSV {
+		c.Set("X-Quota-Remaining", strconv.FormatInt(data.Quota, 10))
+		return sendCSV(c, data.Result, opts)
 	}
+	return c.OK(data)
+}
 
-	if req.Lang == "" {
-		req.Lang = "en"
+// Check 查询 API key 状态
+// @Summary 查询 API key 状态
+// @Description 返回当前 API key 的等级、余额与访问限制
+// @Tags IP
+// @Produce json
+// @Security ApiKey
+// @Success 200 {object} engine.Response{data=CheckResp} "查询成功"
+// @Failure 401 {object} engine.Response "无效的API"
+// @Failure 403 {object} engine.Response "API已过期或无权访问"
+// @Router /ip/check [get]
+func (h *Handler) Check(c *engine.Ctx) error {
+	apiCache := utils.GetApiCache(c)
+	if apiCache == nil {
+		return c.Fail(fiber.StatusUnauthorized, errorx.ErrInvalidTaskKey)
 	}
 
-	data, err := h.service.BatchIP(c.StdCtx, req.IPs, req.ApiKey, req.Lang)
+	data, err := h.service.Check(c.StdCtx, apiCache)
 	if err != nil {
 		return c.Fail(fiber.StatusForbidden, err.Error())
 	}
 	return c.OK(data)
 }
+
+// queryOverride 读取 GET 查询参数中的查询设置
+func queryOverride(c *engine.Ctx) (LookupOverride, error) {
+	o := LookupOverride{
+		Lang:   c.Query("lang"),
+		Fields: splitFields(c.Query("fields")),
+		Format: c.Query("format"),
+	}
+	for key, dst := range map[string]**bool{"cidr": &o.CIDR, "redact": &o.Redact} {
+		raw := c.Query(key)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return o, errorx.ErrInvalidLookup
+		}
+		*dst = &v
+	}
+	return o, nil
+}
+
+func sendCSV(c *engine.Ctx, rows []*GetIP, opts LookupOptions) error {
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, rows, opts); err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err)
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,283 @@
+package ip2
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+)
+
+// 城市级精度：经纬度保留 1 位小数（约 11km），精度半径不小于 20km
+const (
+	redactScale      = 10
+	redactAccuracyKm = 20
+)
+
+// LookupOverride 为请求中显式给出的查询参数，未给出的沿用 task 默认值
+type LookupOverride struct {
+	Lang   string   `json:"lang"`
+	Fields []string `json:"fields"`
+	Format string   `json:"format"`
+	CIDR   *bool    `json:"cidr"`
+	Redact *bool    `json:"redact"`
+}
+
+// LookupOptions 为一次查询最终生效的参数
+type LookupOptions struct {
+	Lang   string
+	Fields []string
+	Format string
+	CIDR   bool
+	Redact bool
+}
+
+// resolveOptions 以 task 默认值为基础叠加请求参数
+func resolveOptions(d models.LookupDefaults, o LookupOverride) (LookupOptions, error) {
+	if o.Lang != "" {
+		d.Lang = o.Lang
+	}
+	if len(o.Fields) > 0 {
+		d.Fields = o.Fields
+	}
+	if o.Format != "" {
+		d.Format = o.Format
+	}
+	if o.CIDR != nil {
+		d.OmitCIDR = !*o.CIDR
+	}
+	if o.Redact != nil {
+		d.Redact = *o.Redact
+	}
+	if !d.Valid() {
+		return LookupOptions{}, errorx.ErrInvalidLookup
+	}
+
+	opts := LookupOptions{
+		Lang:   d.Lang,
+		Fields: d.Fields,
+		Format: d.Format,
+		CIDR:   !d.OmitCIDR,
+		Redact: d.Redact,
+	}
+	if opts.Lang == "" {
+		opts.Lang = "en"
+	}
+	if opts.Format == "" {
+		opts.Format = models.FormatJSON
+	}
+	return opts, nil
+}
+
+func (o LookupOptions) fields() []string {
+	if len(o.Fields) == 0 {
+		return models.LookupFields
+	}
+	return o.Fields
+}
+
+// apply 按参数裁剪单条结果；指针字段可能指向 IP 库的查询结果，只替换不修改
+func (o LookupOptions) apply(r *GetIP) {
+	if r == nil || r.Err != "" {
+		return
+	}
+	if !o.CIDR && r.Network != nil {
+		r.Network = &Network{IPVersion: r.Network.IPVersion}
+	}
+	if o.Redact && r.Location != nil {
+		r.Location = redactLocation(r.Location)
+	}
+	if len(o.Fields) == 0 {
+		return
+	}
+	keep := func(f string) bool { return slices.Contains(o.Fields, f) }
+	if !keep("network") {
+		r.Network = nil
+	}
+	if !keep("continent") {
+		r.Continent = nil
+	}
+	if !keep("country") {
+		r.Country = nil
+	}
+	if !keep("region") {
+		r.Region = nil
+	}
+	if !keep("city") {
+		r.City = nil
+	}
+	if !keep("postal") {
+		r.Postal = nil
+	}
+	if !keep("location") {
+		r.Location = nil
+	}
+	if !keep("timezone") {
+		r.Timezone = nil
+	}
+	if !keep("asn") {
+		r.Asn = nil
+	}
+	if !keep("traits") {
+		r.Traits = nil
+	}
+}
+
+func redactLocation(l *Location) *Location {
+	out := &Location{}
+	if l.Lat != nil {
+		v := math.Round(*l.Lat*redactScale) / redactScale
+		out.Lat = &v
+	}
+	if l.Lon != nil {
+		v := math.Round(*l.Lon*redactScale) / redactScale
+		out.Lon = &v
+	}
+	radius := redactAccuracyKm
+	if l.AccuracyRadiusKm != nil && *l.AccuracyRadiusKm > radius {
+		radius = *l.AccuracyRadiusKm
+	}
+	out.AccuracyRadiusKm = &radius
+	return out
+}
+
+// csvColumns 为各字段展开后的列
+var csvColumns = map[string][]string{
+	"network":   {"network.cidr", "network.ipVersion"},
+	"continent": {"continent.code", "continent.name"},
+	"country":   {"country.iso2", "country.name"},
+	"region":    {"region.iso", "region.name"},
+	"city":      {"city.name"},
+	"postal":    {"postal.code"},
+	"location":  {"location.lat", "location.lon", "location.accuracyRadiusKm"},
+	"timezone":  {"timezone"},
+	"asn":       {"asn.number", "asn.org"},
+	"traits":    {"traits.isAnonymousProxy", "traits.isSatelliteProvider"},
+}
+
+// writeCSV 以 ip、err 及所选字段展开的列输出结果
+func writeCSV(w io.Writer, rows []*GetIP, opts LookupOptions) error {
+	fields := opts.fields()
+	header := []string{"ip", "err"}
+	for _, f := range fields {
+		header = append(header, csvColumns[f]...)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if r == nil {
+			continue
+		}
+		record := []string{r.IP, r.Err}
+		for _, f := range fields {
+			record = append(record, csvValues(r, f)...)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValues(r *GetIP, field string) []string {
+	switch field {
+	case "network":
+		if r.Network == nil {
+			return []string{"", ""}
+		}
+		return []string{str(r.Network.Cidr), num(r.Network.IPVersion)}
+	case "continent":
+		if r.Continent == nil {
+			return []string{"", ""}
+		}
+		return []string{str(r.Continent.Code), str(r.Continent.Name)}
+	case "country":
+		if r.Country == nil {
+			return []string{"", ""}
+		}
+		return []string{str(r.Country.Iso2), str(r.Country.Name)}
+	case "region":
+		if r.Region == nil {
+			return []string{"", ""}
+		}
+		return []string{str(r.Region.Iso), str(r.Region.Name)}
+	case "city":
+		if r.City == nil {
+			return []string{""}
+		}
+		return []string{str(r.City.Name)}
+	case "postal":
+		if r.Postal == nil {
+			return []string{""}
+		}
+		return []string{str(r.Postal.Code)}
+	case "location":
+		if r.Location == nil {
+			return []string{"", "", ""}
+		}
+		return []string{float(r.Location.Lat), float(r.Location.Lon), num(r.Location.AccuracyRadiusKm)}
+	case "timezone":
+		return []string{str(r.Timezone)}
+	case "asn":
+		if r.Asn == nil {
+			return []string{"", ""}
+		}
+		return []string{num(r.Asn.Number), str(r.Asn.Org)}
+	case "traits":
+		if r.Traits == nil {
+			return []string{"", ""}
+		}
+		return []string{boolean(r.Traits.IsAnonymousProxy), boolean(r.Traits.IsSatelliteProvider)}
+	}
+	return nil
+}
+
+func str(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func num(p *int) string {
+	if p == nil {
+		return ""
+	}
+	return strconv.Itoa(*p)
+}
+
+func float(p *float64) string {
+	if p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*p, 'f', -1, 64)
+}
+
+func boolean(p *bool) string {
+	if p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*p)
+}
+
+// splitFields 解析查询参数中逗号分隔的字段列表
+func splitFields(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var out []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
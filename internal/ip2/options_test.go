@@ -0,0 +1,59 @@
+package ip2
+
+import (
+	"testing"
+
+	"asum/pkg/models"
+)
+
+func TestResolveOptions(t *testing.T) {
+	d := models.LookupDefaults{Lang: "zh-CN", Fields: []string{"country"}, OmitCIDR: true, Redact: true}
+
+	opts, err := resolveOptions(d, LookupOverride{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Lang != "zh-CN" || opts.Format != models.FormatJSON || opts.CIDR || !opts.Redact {
+		t.Fatalf("defaults not applied: %+v", opts)
+	}
+
+	on, off := true, false
+	opts, err = resolveOptions(d, LookupOverride{Lang: "en", Format: "csv", CIDR: &on, Redact: &off})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Lang != "en" || opts.Format != models.FormatCSV || !opts.CIDR || opts.Redact {
+		t.Fatalf("overrides not applied: %+v", opts)
+	}
+
+	if _, err := resolveOptions(d, LookupOverride{Fields: []string{"password"}}); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	cidr, ver := "1.2.3.0/24", 4
+	lat, lon, radius := 31.230416, 121.473701, 5
+	name := "CN"
+	r := &GetIP{
+		IP:       "1.2.3.4",
+		Network:  &Network{Cidr: &cidr, IPVersion: &ver},
+		Country:  &Country{Iso2: &name},
+		Location: &Location{Lat: &lat, Lon: &lon, AccuracyRadiusKm: &radius},
+	}
+
+	LookupOptions{Fields: []string{"network", "location"}, Redact: true}.apply(r)
+
+	if r.Network == nil || r.Network.Cidr != nil || *r.Network.IPVersion != 4 {
+		t.Fatalf("network: %+v", r.Network)
+	}
+	if r.Country != nil {
+		t.Fatal("country not projected out")
+	}
+	if *r.Location.Lat != 31.2 || *r.Location.Lon != 121.5 || *r.Location.AccuracyRadiusKm != redactAccuracyKm {
+		t.Fatalf("location not redacted: %v %v %v", *r.Location.Lat, *r.Location.Lon, *r.Location.AccuracyRadiusKm)
+	}
+	if lat != 31.230416 {
+		t.Fatal("redaction modified the source value")
+	}
+}
@@ -3,8 +3,10 @@ package ip2
 import (
 	"context"
 	"net"
+	"strings"
 
 	"asum/pkg/maxmind"
+	"asum/pkg/session"
 )
 
 type Repository interface {
@@ -142,3 +144,28 @@ func (r *repository) needCountryFallback(out *GetIP) bool {
 func (r *repository) Close() error {
 	return r.DB.Close()
 }
+
+// Locate 把 Lookup 包装为会话记录使用的位置查询，结果形如 "Shanghai, Shanghai, China"
+func Locate(repo Repository) session.Locator {
+	return func(ctx context.Context, ip string) string {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return ""
+		}
+		data, err := repo.Lookup(ctx, addr, "en")
+		if err != nil {
+			return ""
+		}
+		var parts []string
+		if data.City != nil && data.City.Name != nil {
+			parts = append(parts, *data.City.Name)
+		}
+		if data.Region != nil && data.Region.Name != nil {
+			parts = append(parts, *data.Region.Name)
+		}
+		if data.Country != nil && data.Country.Name != nil {
+			parts = append(parts, *data.Country.Name)
+		}
+		return strings.Join(parts, ", ")
+	}
+}
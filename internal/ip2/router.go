@@ -2,11 +2,35 @@ package ip2
 
 import (
 	"asum/pkg/engine"
+	"asum/pkg/middleware"
+	"asum/pkg/models"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-func RegisterRoutes(r fiber.Router, h *Handler) {
-	r.Get("/:ip", engine.H(h.GetIP))      // GET 查询单个IP
-	r.Post("/batch", engine.H(h.BatchIP)) // POST 批量查询IP
+// 各接口消耗的令牌数，批量接口按 IP 数量计费
+const (
+	lookupCost     = 1
+	checkCost      = 1
+	batchCostPerIP = 1
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler, l *middleware.Limiter) {
+	// GET 查询 API key 状态
+	r.Get("/check",
+		middleware.RequireScope(models.ScopeCheck),
+		l.Cost(middleware.FixedCost(checkCost)),
+		engine.H(h.Check))
+
+	// GET 查询单个IP
+	r.Get("/:ip",
+		middleware.RequireScope(models.ScopeLookup),
+		l.Cost(middleware.FixedCost(lookupCost)),
+		engine.H(h.GetIP))
+
+	// POST 批量查询IP
+	r.Post("/batch",
+		middleware.RequireScope(models.ScopeBatch),
+		l.Cost(middleware.PerIPCost(batchCostPerIP)),
+		engine.H(h.BatchIP))
 }
@@ -4,6 +4,8 @@ import (
 	"asum/internal/task"
 	"asum/internal/user"
 	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/webhook"
 	"context"
 	"net"
 	"sync"
@@ -80,9 +82,11 @@ type LookupResult struct {
 }
 
 type Service interface {
-	GetIP(ctx context.Context, ip, lang string) (*GetIP, error)
-	BatchIP(ctx context.Context, ips []string, taskKey, lang string) (*BatchIPResp, error)
-	lookupIP(ctx context.Context, ips []string, lang string) ([]*GetIP, error)
+	Options(apiCache *models.ApiCache, o LookupOverride) (LookupOptions, error)
+	GetIP(ctx context.Context, ip string, opts LookupOptions) (*GetIP, error)
+	BatchIP(ctx context.Context, ips []string, apiCache *models.ApiCache, opts LookupOptions) (*BatchIPResp, error)
+	Check(ctx context.Context, apiCache *models.ApiCache) (*CheckResp, error)
+	lookupIP(ctx context.Context, ips []string, opts LookupOptions) ([]*GetIP, error)
 	getUserQuotaByKey(ctx context.Context, key string) int64
 }
 
@@ -90,13 +94,15 @@ type service struct {
 	repo     Repository
 	userRepo user.Repository
 	taskRepo task.Repository
+	hooks    *webhook.Dispatcher
 }
 
-func NewService(repo Repository, userRepo user.Repository, taskRepo task.Repository) Service {
+func NewService(repo Repository, userRepo user.Repository, taskRepo task.Repository, hooks *webhook.Dispatcher) Service {
 	return &service{
 		repo:     repo,
 		userRepo: userRepo,
 		taskRepo: taskRepo,
+		hooks:    hooks,
 	}
 }
 
@@ -105,30 +111,69 @@ type BatchIPResp struct {
 	Result []*GetIP `json:"result"`
 }
 
-func (s *service) GetIP(ctx context.Context, ip, lang string) (*GetIP, error) {
-	result, err := s.lookupIP(ctx, []string{ip}, lang)
+// Options 以 key 所属 task 的查询默认值叠加请求参数
+func (s *service) Options(apiCache *models.ApiCache, o LookupOverride) (LookupOptions, error) {
+	var d models.LookupDefaults
+	if apiCache != nil {
+		d = apiCache.Lookup
+	}
+	return resolveOptions(d, o)
+}
+
+func (s *service) GetIP(ctx context.Context, ip string, opts LookupOptions) (*GetIP, error) {
+	result, err := s.lookupIP(ctx, []string{ip}, opts)
 	return result[0], err
 }
 
-func (s *service) BatchIP(ctx context.Context, ips []string, taskKey, lang string) (*BatchIPResp, error) {
-	if exist, err := s.taskRepo.ExistsByTaskKey(ctx, taskKey); err != nil || !exist {
+// BatchIP 使用 API key 中间件已解析的 apiCache，不再重复查库校验 key
+func (s *service) BatchIP(ctx context.Context, ips []string, apiCache *models.ApiCache, opts LookupOptions) (*BatchIPResp, error) {
+	if apiCache == nil {
 		return nil, errorx.ErrInvalidTaskKey
 	}
-	quota := s.userRepo.GetQuotaByKey(ctx, taskKey)
+	quota := s.userRepo.GetQuotaByKey(ctx, apiCache.Key)
 	if len(ips) > int(quota) {
 		return nil, errorx.ErrQuota
 	}
 
-	result, err := s.lookupIP(ctx, ips, lang)
+	result, err := s.lookupIP(ctx, ips, opts)
 	data := &BatchIPResp{Result: result, Quota: quota}
+	if err == nil {
+		s.hooks.Go(apiCache.TaskID, models.EventBulkFinished, &webhook.BulkFinishedData{
+			KeyPrefix: apiCache.KeyID,
+			Count:     len(ips),
+			Quota:     quota,
+		})
+	}
 	return data, err
 }
 
+type CheckResp struct {
+	TaskID uint64                `json:"taskId"`
+	Level  string                `json:"level"`
+	Quota  int64                 `json:"quota"`
+	Policy models.KeyPolicy      `json:"policy"`
+	Lookup models.LookupDefaults `json:"lookup"`
+}
+
+func (s *service) Check(ctx context.Context, apiCache *models.ApiCache) (*CheckResp, error) {
+	if apiCache == nil {
+		return nil, errorx.ErrInvalidTaskKey
+	}
+	return &CheckResp{
+		TaskID: apiCache.TaskID,
+		Level:  apiCache.UserLevel.String(),
+		Quota:  s.userRepo.GetQuotaByKey(ctx, apiCache.Key),
+		Policy: apiCache.Policy,
+		Lookup: apiCache.Lookup,
+	}, nil
+}
+
 func (s *service) getUserQuotaByKey(ctx context.Context, key string) int64 {
 	return s.userRepo.GetQuotaByKey(ctx, key)
 }
 
-func (s *service) lookupIP(ctx context.Context, ips []string, lang string) ([]*GetIP, error) {
+func (s *service) lookupIP(ctx context.Context, ips []string, opts LookupOptions) ([]*GetIP, error) {
+	lang := opts.Lang
 	if lang == "" {
 		lang = "en"
 	}
@@ -156,6 +201,7 @@ func (s *service) lookupIP(ctx context.Context, ips []string, lang string) ([]*G
 			if err != nil {
 				out[idx] = &GetIP{IP: ipText, Err: err.Error()}
 			} else {
+				opts.apply(data)
 				out[idx] = data
 			}
 		}(i, ipStr, ipItem)
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"asum/pkg/engine"
+	"asum/pkg/pagination"
+	"asum/pkg/rdb"
+	"asum/pkg/utils"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 收件箱只保留最近的通知，长期不活跃的用户整体过期
+	inboxMaxLen = 500
+	inboxTTL    = 90 * 24 * time.Hour
+	inboxBatch  = 100
+)
+
+func inboxKey(uid uint64) string {
+	return fmt.Sprintf("notify:inbox:%d", uid)
+}
+
+// 收件箱可按通知类型（data.type）筛选；游标由 stream ID 的毫秒时间与序号构成
+var inboxSpec = &pagination.Spec{
+	Name: "notify_inbox",
+	Filters: map[string]pagination.Filter{
+		"type": {Column: "type"},
+	},
+}
+
+type InboxItem struct {
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+	Ts   int64           `json:"ts"`
+}
+
+// ListInbox 分页读取用户收件箱
+func ListInbox(ctx context.Context, redisDB *rdb.Client, uid uint64, p *pagination.Params) (*pagination.Page[InboxItem], error) {
+	kind := p.Filter("type")
+	items := make([]InboxItem, 0, p.Limit+1)
+
+	var from string
+	if p.After != nil {
+		from = "(" + streamID(*p.After)
+	}
+	for len(items) <= p.Limit {
+		msgs, err := readInbox(ctx, redisDB, uid, from, p.Desc)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			item := toInboxItem(msg)
+			if kind != "" && itemType(item.Data) != kind {
+				continue
+			}
+			items = append(items, item)
+			if len(items) > p.Limit {
+				break
+			}
+		}
+		if len(msgs) < inboxBatch {
+			break
+		}
+		from = "(" + msgs[len(msgs)-1].ID
+	}
+
+	return pagination.Cut(p, items, func(it *InboxItem) pagination.Cursor {
+		return streamCursor(it.ID)
+	}), nil
+}
+
+func readInbox(ctx context.Context, redisDB *rdb.Client, uid uint64, from string, desc bool) ([]redis.XMessage, error) {
+	if desc {
+		if from == "" {
+			from = "+"
+		}
+		return redisDB.XRevRangeN(ctx, inboxKey(uid), from, "-", inboxBatch).Result()
+	}
+	if from == "" {
+		from = "-"
+	}
+	return redisDB.XRangeN(ctx, inboxKey(uid), from, "+", inboxBatch).Result()
+}
+
+func toInboxItem(msg redis.XMessage) InboxItem {
+	item := InboxItem{ID: msg.ID, Data: json.RawMessage("null")}
+	if raw, ok := msg.Values["data"].(string); ok && json.Valid([]byte(raw)) {
+		item.Data = json.RawMessage(raw)
+	}
+	if raw, ok := msg.Values["ts"].(string); ok {
+		item.Ts, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return item
+}
+
+func itemType(data json.RawMessage) string {
+	var v struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(data, &v)
+	return v.Type
+}
+
+func streamCursor(id string) pagination.Cursor {
+	ms, seq, _ := strings.Cut(id, "-")
+	t, _ := strconv.ParseInt(ms, 10, 64)
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return pagination.Cursor{CreatedAt: time.UnixMilli(t), ID: n}
+}
+
+func streamID(c pagination.Cursor) string {
+	return fmt.Sprintf("%d-%d", c.CreatedAt.UnixMilli(), c.ID)
+}
+
+type InboxHandler struct {
+	redisDB *rdb.Client
+}
+
+func NewInboxHandler(redisDB *rdb.Client) *InboxHandler {
+	return &InboxHandler{redisDB: redisDB}
+}
+
+// ListInbox 查看通知收件箱
+// @Summary 查看通知
+// @Description 保留最近 500 条推送给当前用户的通知。
+// @Tags Notify
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param type query string false "按通知类型筛选，如 usage_alert、watch_change"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]InboxItem}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/notify/inbox [get]
+func (h *InboxHandler) ListInbox(c *engine.Ctx) error {
+	p, err := pagination.Parse(c, inboxSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := ListInbox(c.StdCtx, h.redisDB, utils.GetUserID(c), p)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
+}
+
+func RegisterRoutes(r fiber.Router, h *InboxHandler) {
+	n := r.Group("/notify")
+	{
+		n.Get("/inbox", engine.H(h.ListInbox))
+	}
+}
+
+// ExportInbox 返回用户收件箱中的全部通知，按时间升序
+func ExportInbox(ctx context.Context, redisDB *rdb.Client, uid uint64) ([]InboxItem, error) {
+	msgs, err := redisDB.XRange(ctx, inboxKey(uid), "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]InboxItem, len(msgs))
+	for i, msg := range msgs {
+		items[i] = toInboxItem(msg)
+	}
+	return items, nil
+}
+
+// DeleteUser 删除用户的收件箱与未读计数
+func DeleteUser(ctx context.Context, redisDB *rdb.Client, uid uint64) error {
+	return redisDB.Del(ctx, inboxKey(uid), unreadKey(uid)).Err()
+}
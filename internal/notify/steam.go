@@ -42,13 +42,26 @@ func EnsureGroup(ctx context.Context, redisDB *rdb.Client, streamKey, group stri
 	return err
 }
 
+// PublishUser 推送给在线用户，并写入用户的收件箱供离线后分页查看
 func PublishUser(ctx context.Context, redisDB *rdb.Client, streamKey string, uid uint64, data any) error {
 	ev := Event{Kind: "user", UID: uid, Data: data, Ts: time.Now().Unix()}
 	b, _ := json.Marshal(ev)
-	return redisDB.XAdd(ctx, &redis.XAddArgs{
+	d, _ := json.Marshal(data)
+
+	pipe := redisDB.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
 		Stream: streamKey,
 		Values: map[string]any{"event": string(b)},
-	}).Err()
+	})
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: inboxKey(uid),
+		MaxLen: inboxMaxLen,
+		Approx: true,
+		Values: map[string]any{"data": string(d), "ts": ev.Ts},
+	})
+	pipe.Expire(ctx, inboxKey(uid), inboxTTL)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 func PublishBroadcast(ctx context.Context, redisDB *rdb.Client, streamKey string, data any) error {
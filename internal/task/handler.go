@@ -3,8 +3,13 @@ package task
 import (
 	"asum/pkg/engine"
 	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"asum/pkg/usage"
 	"asum/pkg/utils"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -22,15 +27,21 @@ type CreateTaskReq struct {
 	Remark string `json:"remark"`
 }
 
+type CreateTaskResp struct {
+	ID        uint64 `json:"id"`
+	TaskKey   string `json:"taskKey"`
+	KeyPrefix string `json:"keyPrefix"`
+}
+
 // CreateTask 创建新任务
 // @Summary 创建新任务
-// @Description 为当前登录用户创建一个新的任务。
+// @Description 为当前登录用户创建一个新的任务，API key 明文仅在本次响应中返回。
 // @Tags Task
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param request body CreateTaskReq true "创建任务参数"
-// @Success 200 {object} engine.Response "创建成功"
+// @Success 200 {object} engine.Response{data=CreateTaskResp} "创建成功"
 // @Failure 400 {object} engine.Response "参数错误 (如名称为空)"
 // @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
 // @Failure 403 {object} engine.Response "禁止操作 (如任务已存在)"
@@ -49,29 +60,607 @@ func (h *Handler) CreateTask(c *engine.Ctx) error {
 		return errors.New("用户未登录")
 	}
 
-	err := h.service.CreateTask(c.StdCtx, &req, currentUserID)
+	data, err := h.service.CreateTask(c.StdCtx, &req, currentUserID)
 	if err != nil {
 		return c.Fail(fiber.StatusForbidden, err.Error())
 	}
 
-	return c.OK(nil)
+	return c.OK(data)
+}
+
+type KeyPolicyReq struct {
+	Scopes         []string   `json:"scopes"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+	AllowedCIDRs   []string   `json:"allowedCidrs"`
+	AllowedOrigins []string   `json:"allowedOrigins"`
+	MaxBatchSize   int        `json:"maxBatchSize"`
+}
+
+// UpdateLookup 设置任务的查询默认参数
+// @Summary 设置查询默认参数
+// @Description 使用该任务 key 查询时默认的语言、返回字段、输出格式(json/csv)、是否返回网段 CIDR、是否将经纬度降到城市级精度；请求中的同名参数优先。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body models.LookupDefaults true "查询默认参数"
+// @Success 200 {object} engine.Response{data=models.LookupDefaults} "设置成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或参数无效)"
+// @Router /app/task/{id}/lookup [put]
+func (h *Handler) UpdateLookup(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req models.LookupDefaults
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.UpdateLookup(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateKeyPolicy 设置任务 API key 的访问限制
+// @Summary 设置 API key 访问限制
+// @Description 设置可访问接口(ip:lookup/ip:batch/ip:check)、过期时间、来源 CIDR、浏览器来源站点及单次批量上限，字段为空表示不限制。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body KeyPolicyReq true "访问限制"
+// @Success 200 {object} engine.Response{data=models.KeyPolicy} "设置成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或限制无效)"
+// @Router /app/task/{id}/policy [put]
+func (h *Handler) UpdateKeyPolicy(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req KeyPolicyReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.UpdateKeyPolicy(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+type RotateKeyReq struct {
+	// GraceSeconds 旧 key 继续可用的秒数，不传默认 24 小时，0 表示立即作废
+	GraceSeconds *int `json:"graceSeconds"`
+}
+
+type RotateKeyResp struct {
+	TaskKey          string     `json:"taskKey"`
+	KeyPrefix        string     `json:"keyPrefix"`
+	PrevKeyPrefix    string     `json:"prevKeyPrefix,omitempty"`
+	PrevKeyExpiresAt *time.Time `json:"prevKeyExpiresAt,omitempty"`
+}
+
+// RotateKey 轮换任务 API key
+// @Summary 轮换 API key
+// @Description 生成新的 API key 并仅在本次响应中返回；旧 key 在宽限期内继续可用，到期后作废。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body RotateKeyReq false "轮换参数"
+// @Success 200 {object} engine.Response{data=RotateKeyResp} "轮换成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id}/rotate-key [post]
+func (h *Handler) RotateKey(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req RotateKeyReq
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+		}
+	}
+
+	data, err := h.service.RotateKey(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+type KeyUsage struct {
+	KeyPrefix string        `json:"keyPrefix"`
+	Current   bool          `json:"current"`
+	ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+	Daily     []usage.Daily `json:"daily"`
+}
+
+// ListKeys 查看任务下的 API key 及用量
+// @Summary 查看 API key 用量
+// @Description 返回当前 key 以及宽限期内旧 key 最近 7 天的每日调用量
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response{data=[]KeyUsage} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id}/keys [get]
+func (h *Handler) ListKeys(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.KeyUsage(c.StdCtx, taskID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
 }
 
+type UpdateTaskReq struct {
+	Name   *string            `json:"name"`
+	Remark *string            `json:"remark"`
+	Status *models.TaskStatus `json:"status"`
+}
+
+// UpdateTask 修改任务
+// @Summary 修改任务
+// @Description 修改名称、备注或状态(0 停用 / 1 启用)，停用后 API key 立即失效，重新启用后恢复。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body UpdateTaskReq true "修改内容"
+// @Success 200 {object} engine.Response{data=models.Task} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id} [patch]
 func (h *Handler) UpdateTask(c *engine.Ctx) error {
-	// return
-	return nil
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req UpdateTaskReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.UpdateTask(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
 }
 
+// GetTask 查看任务详情
+// @Summary 查看任务详情
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response{data=models.Task} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id} [get]
 func (h *Handler) GetTask(c *engine.Ctx) error {
-	// return
-	return nil
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.GetTask(c.StdCtx, taskID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
 }
 
+// DeleteTask 删除任务
+// @Summary 删除任务
+// @Description 删除后 API key 立即失效，任务进入回收站，保留期内可恢复。
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id} [delete]
 func (h *Handler) DeleteTask(c *engine.Ctx) error {
-	// return
-	return nil
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.DeleteTask(c.StdCtx, taskID, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// ListTrash 查看回收站
+// @Summary 查看回收站
+// @Description 返回当前用户作为所有者删除的任务，超过保留期后将被彻底删除。
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]TrashTask} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/task/trash [get]
+func (h *Handler) ListTrash(c *engine.Ctx) error {
+	data, err := h.service.ListTrash(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
+}
+
+// RestoreTask 从回收站恢复任务
+// @Summary 恢复任务
+// @Description 恢复后原 API key 重新生效。
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response{data=models.Task} "恢复成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (任务不在回收站或无权恢复)"
+// @Router /app/task/{id}/restore [post]
+func (h *Handler) RestoreTask(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.RestoreTask(c.StdCtx, taskID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
 }
 
+// ListTask 查看任务列表
+// @Summary 查看任务列表
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param status query int false "状态 0 停用 / 1 启用"
+// @Param name query string false "按名称模糊搜索"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]models.Task}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/task [get]
 func (h *Handler) ListTask(c *engine.Ctx) error {
-	return nil
+	p, err := pagination.Parse(c, taskListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.ListTask(c.StdCtx, utils.GetUserID(c), p)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
+}
+
+type InviteMemberReq struct {
+	Email string          `json:"email"`
+	Role  models.TaskRole `json:"role"`
+}
+
+type UpdateMemberReq struct {
+	Role models.TaskRole `json:"role"`
+}
+
+type InviteTokenReq struct {
+	Token string `json:"token"`
+}
+
+type AcceptInviteResp struct {
+	TaskID uint64          `json:"taskId"`
+	Role   models.TaskRole `json:"role"`
+}
+
+type TransferOwnerReq struct {
+	UserID uint64 `json:"userId"`
+}
+
+// ListMembers 查看任务成员
+// @Summary 查看任务成员
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param role query string false "按角色筛选 owner/admin/member/viewer"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]TaskMember}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id}/members [get]
+func (h *Handler) ListMembers(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	p, err := pagination.Parse(c, memberListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.ListMembers(c.StdCtx, taskID, utils.GetUserID(c), p)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
+}
+
+// InviteMember 邀请成员
+// @Summary 邀请成员
+// @Description 通过邮件邀请成员加入任务，角色可选 admin/member/viewer，且须低于邀请人自身角色。邀请 7 天内有效，只能使用一次。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body InviteMemberReq true "邀请参数"
+// @Success 200 {object} engine.Response{data=models.TaskInvite} "邀请已发送"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权管理成员、角色无效或已是成员)"
+// @Router /app/task/{id}/members [post]
+func (h *Handler) InviteMember(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req InviteMemberReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.InviteMember(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateMember 修改成员角色
+// @Summary 修改成员角色
+// @Description 只能调整角色低于自己的成员，且新角色也须低于自己；owner 只能通过转让变更。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param userId path int true "成员用户 ID"
+// @Param request body UpdateMemberReq true "新角色"
+// @Success 200 {object} engine.Response "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权管理成员或角色无效)"
+// @Router /app/task/{id}/members/{userId} [patch]
+func (h *Handler) UpdateMember(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	memberID, err := strconv.ParseUint(c.Params("userId"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req UpdateMemberReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.UpdateMemberRole(c.StdCtx, taskID, utils.GetUserID(c), memberID, &req); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// RemoveMember 移除成员
+// @Summary 移除成员
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param userId path int true "成员用户 ID"
+// @Success 200 {object} engine.Response "移除成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权管理该成员)"
+// @Router /app/task/{id}/members/{userId} [delete]
+func (h *Handler) RemoveMember(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	memberID, err := strconv.ParseUint(c.Params("userId"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.RemoveMember(c.StdCtx, taskID, utils.GetUserID(c), memberID); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// inviteToken 邀请链接中的 token 放在 query，也可以放在请求体中
+func inviteToken(c *engine.Ctx) (string, error) {
+	if token := c.Query("token"); token != "" {
+		return token, nil
+	}
+	var req InviteTokenReq
+	if err := c.Bind().Body(&req); err != nil || req.Token == "" {
+		return "", errorx.ErrInvalidRequestBody
+	}
+	return req.Token, nil
+}
+
+// AcceptInvite 接受邀请
+// @Summary 接受任务邀请
+// @Description 当前登录账号的邮箱须与受邀邮箱一致。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param token query string false "邀请 token"
+// @Param request body InviteTokenReq false "邀请 token"
+// @Success 200 {object} engine.Response{data=AcceptInviteResp} "已加入任务"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "邀请已失效或不属于当前账号"
+// @Router /app/task/invites/accept [post]
+func (h *Handler) AcceptInvite(c *engine.Ctx) error {
+	token, err := inviteToken(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	data, err := h.service.AcceptInvite(c.StdCtx, utils.GetUserID(c), token)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// AcceptInvitePage 邮件中的邀请链接
+// @Summary 邀请确认页
+// @Description 邮件中的邀请链接打开的页面，只展示确认按钮，不接受邀请；点击后以 POST 提交到同一地址。
+// @Tags Task
+// @Produce html
+// @Param token query string true "邀请 token"
+// @Success 200 {string} string "确认页"
+// @Router /task/invites/accept [get]
+func (h *Handler) AcceptInvitePage(c *engine.Ctx) error {
+	return c.ConfirmPage("接受任务邀请", "确认后将以受邀邮箱对应的账号加入该任务。", "接受邀请")
+}
+
+// AcceptInviteLink 通过邮件链接接受邀请
+// @Summary 通过邮件链接接受任务邀请
+// @Description 免登录，由 token 确定受邀邮箱对应的账号；该邮箱须已注册并激活。由邀请确认页提交。
+// @Tags Task
+// @Produce json
+// @Param token query string true "邀请 token"
+// @Success 200 {object} engine.Response{data=AcceptInviteResp} "已加入任务"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 403 {object} engine.Response "邀请已失效或受邀邮箱尚未注册"
+// @Router /task/invites/accept [post]
+func (h *Handler) AcceptInviteLink(c *engine.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.AcceptInviteByLink(c.StdCtx, token)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// DeclineInvite 拒绝邀请
+// @Summary 拒绝任务邀请
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param token query string false "邀请 token"
+// @Param request body InviteTokenReq false "邀请 token"
+// @Success 200 {object} engine.Response "已拒绝"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "邀请已失效"
+// @Router /app/task/invites/decline [post]
+func (h *Handler) DeclineInvite(c *engine.Ctx) error {
+	token, err := inviteToken(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	if err := h.service.DeclineInvite(c.StdCtx, token); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// LeaveTask 退出任务
+// @Summary 退出任务
+// @Description owner 须先转让任务才能退出。
+// @Tags Task
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response "已退出"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作"
+// @Router /app/task/{id}/leave [post]
+func (h *Handler) LeaveTask(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.LeaveTask(c.StdCtx, taskID, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// TransferOwner 转让任务
+// @Summary 转让任务
+// @Description 将 owner 转给已有成员，原 owner 降为 admin；API key 的等级与用量改记到新 owner 名下。
+// @Tags Task
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body TransferOwnerReq true "新 owner"
+// @Success 200 {object} engine.Response "转让成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (非 owner 或对方不是成员)"
+// @Router /app/task/{id}/transfer [post]
+func (h *Handler) TransferOwner(c *engine.Ctx) error {
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req TransferOwnerReq
+	if err := c.Bind().Body(&req); err != nil || req.UserID == 0 {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.TransferOwner(c.StdCtx, taskID, utils.GetUserID(c), &req); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
 }
@@ -1,6 +1,10 @@
 package task
 
-import "asum/pkg/models"
+import (
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"time"
+)
 
 type QueryOptions struct {
 	WithUsers bool
@@ -18,3 +22,39 @@ func DefaultQueryOptions() QueryOptions {
 		Offset:    0,
 	}
 }
+
+// 任务列表可按状态、名称筛选
+var taskListSpec = &pagination.Spec{
+	Name:  "tasks",
+	Table: "tasks",
+	Filters: map[string]pagination.Filter{
+		"status": {Column: "tasks.status", Int: true},
+		"name":   {Column: "tasks.name", Like: true},
+	},
+}
+
+// 成员列表可按角色筛选，游标基于 user_tasks
+var memberListSpec = &pagination.Spec{
+	Name:  "members",
+	Table: "user_tasks",
+	Filters: map[string]pagination.Filter{
+		"role": {Column: "user_tasks.role"},
+	},
+}
+
+// TrashTask 为回收站中的 task，PurgeAt 之后将被彻底删除
+type TrashTask struct {
+	models.Task
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+type TaskMember struct {
+	// ID 为成员关系 ID
+	ID        uint64          `json:"id"`
+	UserID    uint64          `json:"userId"`
+	Name      string          `json:"name"`
+	Email     string          `json:"email"`
+	Role      models.TaskRole `json:"role"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
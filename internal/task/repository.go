@@ -3,11 +3,15 @@ package task
 import (
 	"context"
 	"errors"
+	"time"
 
 	"asum/pkg/db"
+	"asum/pkg/errorx"
 	"asum/pkg/models"
+	"asum/pkg/pagination"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -15,16 +19,38 @@ type Repository interface {
 	Update(ctx context.Context, a *models.Task) error
 	Delete(ctx context.Context, id uint64) error
 	HardDelete(ctx context.Context, id uint64) error
+	ListTrash(ctx context.Context, userID uint64) ([]models.Task, error)
+	FindTrashed(ctx context.Context, taskID, userID uint64) (*models.Task, error)
+	Restore(ctx context.Context, id uint64) error
+	ListPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]models.Task, error)
+	ListOwned(ctx context.Context, userID uint64) ([]models.Task, error)
 	FindByID(ctx context.Context, id uint64) (*models.Task, error)
-	// FindByTaskKey(ctx context.Context, apiKey string) (*models.Task, error)
-	ExistsByTaskKey(ctx context.Context, taskKey string) (bool, error)
+	ListByUser(ctx context.Context, userID uint64, p *pagination.Params) ([]models.Task, error)
+	// FindByTaskKey(ctx context.Context, keyHash string) (*models.Task, error)
+	ExistsByTaskKey(ctx context.Context, keyHash string) (bool, error)
 
-	// ValidateTaskKey(ctx context.Context, taskKey string) (*models.Task, error)
+	// ValidateTaskKey(ctx context.Context, keyHash string) (*models.Task, error)
 
-	AddUser(ctx context.Context, taskID, userID uint64, role string) error
+	UpdateKeyPolicy(ctx context.Context, id uint64, policy *models.KeyPolicy) error
+	UpdateLookup(ctx context.Context, id uint64, d *models.LookupDefaults) error
+	IsMember(ctx context.Context, taskID, userID uint64) (bool, error)
+	RotateKey(ctx context.Context, id uint64, newPrefix, newHash string, graceUntil *time.Time) (*models.Task, error)
+	ClearExpiredPrevKeys(ctx context.Context, now time.Time) ([]string, error)
+
+	AddUser(ctx context.Context, taskID, userID uint64, role models.TaskRole) error
 	RemoveUser(ctx context.Context, taskID, userID uint64) error
 	GetUsers(ctx context.Context, taskID uint64) ([]models.UserTask, error)
 	GetUsersByTaskID(ctx context.Context, taskid int64) ([]models.UserTask, error)
+
+	GetMember(ctx context.Context, taskID, userID uint64) (*models.UserTask, error)
+	ListMembers(ctx context.Context, taskID uint64) ([]TaskMember, error)
+	PageMembers(ctx context.Context, taskID uint64, p *pagination.Params) ([]TaskMember, error)
+	TransferOwner(ctx context.Context, taskID, fromID, toID uint64) error
+
+	CreateInvite(ctx context.Context, inv *models.TaskInvite) error
+	FindInvite(ctx context.Context, tokenHash string) (*models.TaskInvite, error)
+	AcceptInvite(ctx context.Context, inv *models.TaskInvite, userID uint64) error
+	DeclineInvite(ctx context.Context, id uint64) error
 }
 
 type repository struct {
@@ -32,7 +58,7 @@ type repository struct {
 }
 
 func NewRepository(db *db.DB) Repository {
-	if err := db.AutoMigrate(&models.Task{}, &models.TaskItem{}); err != nil {
+	if err := db.AutoMigrate(&models.Task{}, &models.TaskItem{}, &models.TaskInvite{}); err != nil {
 		panic(err)
 	}
 	return &repository{db: db}
@@ -41,7 +67,7 @@ func NewRepository(db *db.DB) Repository {
 func (r *repository) Create(ctx context.Context, userID uint64, a *models.Task) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var count int64
-		if err := tx.Model(&models.Task{}).Where("task_key = ?", a.TaskKey).Count(&count).Error; err != nil {
+		if err := tx.Model(&models.Task{}).Where("key_hash = ?", a.KeyHash).Count(&count).Error; err != nil {
 			return err
 		}
 		if count > 0 {
@@ -55,6 +81,7 @@ func (r *repository) Create(ctx context.Context, userID uint64, a *models.Task)
 		userTask := models.UserTask{
 			UserID: userID,
 			TaskID: a.ID,
+			Role:   models.RoleOwner,
 		}
 
 		if err := tx.Create(&userTask).Error; err != nil {
@@ -68,7 +95,8 @@ func (r *repository) Create(ctx context.Context, userID uint64, a *models.Task)
 func (r *repository) Update(ctx context.Context, a *models.Task) error {
 	result := r.db.WithContext(ctx).
 		Model(a).
-		Select("name", "appkey", "status", "remark", "updated_at").
+		Where("deleted_at IS NULL").
+		Select("name", "status", "remark", "updated_at").
 		Updates(a)
 
 	if result.Error != nil {
@@ -80,10 +108,112 @@ func (r *repository) Update(ctx context.Context, a *models.Task) error {
 	return nil
 }
 
+func (r *repository) UpdateKeyPolicy(ctx context.Context, id uint64, policy *models.KeyPolicy) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.Task{ID: id}).
+		Where("deleted_at IS NULL").
+		Select("key_scopes", "key_expires_at", "key_allowed_cidrs", "key_allowed_origins", "key_max_batch_size", "updated_at").
+		Updates(&models.Task{KeyPolicy: *policy})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrTaskNotFound
+	}
+	return nil
+}
+
+func (r *repository) UpdateLookup(ctx context.Context, id uint64, d *models.LookupDefaults) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.Task{ID: id}).
+		Where("deleted_at IS NULL").
+		Select("lookup_lang", "lookup_fields", "lookup_format", "lookup_omit_cidr", "lookup_redact", "updated_at").
+		Updates(&models.Task{Lookup: *d})
+
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrTaskNotFound
+	}
+	return nil
+}
+
+// RotateKey 将当前 key 转为旧 key 并在 graceUntil 前保留，graceUntil 为 nil 时旧 key 立即失效；
+// 返回轮换前的 task，调用方据此清理缓存
+func (r *repository) RotateKey(ctx context.Context, id uint64, newPrefix, newHash string, graceUntil *time.Time) (*models.Task, error) {
+	var before models.Task
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deleted_at IS NULL", id).
+			First(&before).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.ErrTaskNotFound
+			}
+			return err
+		}
+
+		prevPrefix, prevHash := before.KeyPrefix, before.KeyHash
+		if graceUntil == nil {
+			prevPrefix, prevHash = "", ""
+		}
+		return tx.Model(&models.Task{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{
+				"key_prefix":          newPrefix,
+				"key_hash":            newHash,
+				"prev_key_prefix":     prevPrefix,
+				"prev_key_hash":       prevHash,
+				"prev_key_expires_at": graceUntil,
+				"updated_at":          time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &before, nil
+}
+
+// ClearExpiredPrevKeys 清除已过宽限期的旧 key，返回被清除 key 的哈希
+func (r *repository) ClearExpiredPrevKeys(ctx context.Context, now time.Time) ([]string, error) {
+	var tasks []models.Task
+	if err := r.db.WithContext(ctx).
+		Select("id", "prev_key_hash").
+		Where("prev_key_hash <> '' AND prev_key_expires_at <= ?", now).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(tasks))
+	keys := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+		keys = append(keys, t.PrevKeyHash)
+	}
+
+	if err := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Where("id IN ? AND prev_key_expires_at <= ?", ids, now).
+		Updates(map[string]interface{}{
+			"prev_key_prefix":     "",
+			"prev_key_hash":       "",
+			"prev_key_expires_at": nil,
+		}).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Delete 软删除，DeletedAt 不是 gorm.DeletedAt，需要手动写入
 func (r *repository) Delete(ctx context.Context, id uint64) error {
 	result := r.db.WithContext(ctx).
+		Model(&models.Task{}).
 		Where("id = ? AND deleted_at IS NULL", id).
-		Delete(&models.Task{})
+		Update("deleted_at", time.Now())
 
 	if result.Error != nil {
 		return result.Error
@@ -94,11 +224,25 @@ func (r *repository) Delete(ctx context.Context, id uint64) error {
 	return nil
 }
 
+// HardDelete 删除 task 及其成员关系、监控项与快照、邀请、webhook 与投递记录、task 级告警规则
 func (r *repository) HardDelete(ctx context.Context, id uint64) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("task_id = ?", id).Delete(&models.UserTask{}).Error; err != nil {
+		items := tx.Model(&models.TaskItem{}).Select("id").Where("task_id = ?", id)
+		if err := tx.Where("item_id IN (?)", items).Delete(&models.WatchSnapshot{}).Error; err != nil {
 			return err
 		}
+		for _, m := range []any{
+			&models.TaskItem{},
+			&models.TaskInvite{},
+			&models.WebhookDelivery{},
+			&models.TaskWebhook{},
+			&models.UsageAlert{},
+			&models.UserTask{},
+		} {
+			if err := tx.Where("task_id = ?", id).Delete(m).Error; err != nil {
+				return err
+			}
+		}
 
 		result := tx.Unscoped().Where("id = ?", id).Delete(&models.Task{})
 		if result.Error != nil {
@@ -112,6 +256,76 @@ func (r *repository) HardDelete(ctx context.Context, id uint64) error {
 	})
 }
 
+// ListTrash 返回用户作为 owner 的已删除 task，最近删除的在前
+func (r *repository) ListTrash(ctx context.Context, userID uint64) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Select("tasks.*").
+		Joins("JOIN user_tasks ON user_tasks.task_id = tasks.id").
+		Where("user_tasks.user_id = ? AND user_tasks.role = ?", userID, models.RoleOwner).
+		Where("tasks.deleted_at IS NOT NULL").
+		Order("tasks.deleted_at DESC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// FindTrashed 返回用户作为 owner 的某个已删除 task
+func (r *repository) FindTrashed(ctx context.Context, taskID, userID uint64) (*models.Task, error) {
+	var t models.Task
+	err := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Select("tasks.*").
+		Joins("JOIN user_tasks ON user_tasks.task_id = tasks.id").
+		Where("tasks.id = ? AND tasks.deleted_at IS NOT NULL", taskID).
+		Where("user_tasks.user_id = ? AND user_tasks.role = ?", userID, models.RoleOwner).
+		First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *repository) Restore(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrTaskNotFound
+	}
+	return nil
+}
+
+// ListPurgeable 返回删除时间早于 deletedBefore 的 task
+func (r *repository) ListPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.WithContext(ctx).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ListOwned 返回用户作为 owner 的全部 task，包括回收站中的
+func (r *repository) ListOwned(ctx context.Context, userID uint64) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Select("tasks.*").
+		Joins("JOIN user_tasks ON user_tasks.task_id = tasks.id").
+		Where("user_tasks.user_id = ? AND user_tasks.role = ?", userID, models.RoleOwner).
+		Find(&tasks).Error
+	return tasks, err
+}
+
 func (r *repository) FindByID(ctx context.Context, id uint64) (*models.Task, error) {
 	query := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", id)
 
@@ -125,8 +339,21 @@ func (r *repository) FindByID(ctx context.Context, id uint64) (*models.Task, err
 	return &a, nil
 }
 
-func (r *repository) FindByTaskKey(ctx context.Context, apiKey string) (*models.Task, error) {
-	query := r.db.WithContext(ctx).Where("task_key = ? AND deleted_at IS NULL", apiKey)
+// ListByUser 分页返回用户通过 user_tasks 关联的 task
+func (r *repository) ListByUser(ctx context.Context, userID uint64, p *pagination.Params) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Select("tasks.*").
+		Joins("JOIN user_tasks ON user_tasks.task_id = tasks.id").
+		Where("user_tasks.user_id = ? AND tasks.deleted_at IS NULL", userID).
+		Scopes(p.Scope).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *repository) FindByTaskKey(ctx context.Context, keyHash string) (*models.Task, error) {
+	query := r.db.WithContext(ctx).Where("key_hash = ? AND deleted_at IS NULL", keyHash)
 	var a models.Task
 	if err := query.First(&a).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -153,21 +380,21 @@ func (r *repository) FindByTaskKey(ctx context.Context, apiKey string) (*models.
 // 	return &a, nil
 // }
 
-func (r *repository) ExistsByTaskKey(ctx context.Context, taskKey string) (bool, error) {
+func (r *repository) ExistsByTaskKey(ctx context.Context, keyHash string) (bool, error) {
 	var count int64
 	err := r.db.WithContext(ctx).
 		Model(&models.Task{}).
-		Where("task_key = ? AND deleted_at IS NULL", taskKey).
+		Where("key_hash = ? AND deleted_at IS NULL", keyHash).
 		Count(&count).Error
 
 	return count > 0, err
 }
 
-func (r *repository) ValidateAppKey(ctx context.Context, taskKey string) (*models.Task, error) {
+func (r *repository) ValidateAppKey(ctx context.Context, keyHash string) (*models.Task, error) {
 	var a models.Task
 	err := r.db.WithContext(ctx).
-		Where("task_key = ? AND status = ? AND deleted_at IS NULL",
-			taskKey, models.StatusEnabled).
+		Where("key_hash = ? AND status = ? AND deleted_at IS NULL",
+			keyHash, models.StatusEnabled).
 		First(&a).Error
 
 	if err != nil {
@@ -179,9 +406,21 @@ func (r *repository) ValidateAppKey(ctx context.Context, taskKey string) (*model
 	return &a, nil
 }
 
-func (r *repository) AddUser(ctx context.Context, taskID, userID uint64, role string) error {
+func (r *repository) IsMember(ctx context.Context, taskID, userID uint64) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.UserTask{}).
+		Joins("JOIN tasks ON tasks.id = user_tasks.task_id").
+		Where("user_tasks.task_id = ? AND user_tasks.user_id = ?", taskID, userID).
+		Where("tasks.deleted_at IS NULL").
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+func (r *repository) AddUser(ctx context.Context, taskID, userID uint64, role models.TaskRole) error {
 	if role == "" {
-		role = "member"
+		role = models.RoleMember
 	}
 	var count int64
 	err := r.db.WithContext(ctx).
@@ -202,6 +441,7 @@ func (r *repository) AddUser(ctx context.Context, taskID, userID uint64, role st
 	ua := &models.UserTask{
 		TaskID: taskID,
 		UserID: userID,
+		Role:   role,
 	}
 	return r.db.WithContext(ctx).Create(ua).Error
 }
@@ -230,3 +470,138 @@ func (r *repository) GetUsersByTaskID(ctx context.Context, taskid int64) ([]mode
 
 	return r.GetUsers(ctx, app.ID)
 }
+
+// GetMember 返回用户在未删除 task 中的成员关系，不是成员时返回 ErrTaskForbidden
+func (r *repository) GetMember(ctx context.Context, taskID, userID uint64) (*models.UserTask, error) {
+	var m models.UserTask
+	err := r.db.WithContext(ctx).
+		Joins("JOIN tasks ON tasks.id = user_tasks.task_id").
+		Where("user_tasks.task_id = ? AND user_tasks.user_id = ?", taskID, userID).
+		Where("tasks.deleted_at IS NULL").
+		First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrTaskForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *repository) ListMembers(ctx context.Context, taskID uint64) ([]TaskMember, error) {
+	var members []TaskMember
+	err := r.db.WithContext(ctx).
+		Table("user_tasks").
+		Select("user_tasks.id, user_tasks.user_id, users.name, users.email, user_tasks.role, user_tasks.created_at").
+		Joins("JOIN users ON users.id = user_tasks.user_id").
+		Where("user_tasks.task_id = ? AND users.deleted_at IS NULL", taskID).
+		Order("user_tasks.id ASC").
+		Scan(&members).Error
+	return members, err
+}
+
+func (r *repository) PageMembers(ctx context.Context, taskID uint64, p *pagination.Params) ([]TaskMember, error) {
+	var members []TaskMember
+	err := r.db.WithContext(ctx).
+		Table("user_tasks").
+		Select("user_tasks.id, user_tasks.user_id, users.name, users.email, user_tasks.role, user_tasks.created_at").
+		Joins("JOIN users ON users.id = user_tasks.user_id").
+		Where("user_tasks.task_id = ? AND users.deleted_at IS NULL", taskID).
+		Scopes(p.Scope).
+		Scan(&members).Error
+	return members, err
+}
+
+// TransferOwner 将 owner 转给已有成员，原 owner 降为 admin
+func (r *repository) TransferOwner(ctx context.Context, taskID, fromID, toID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserTask{}).
+			Where("task_id = ? AND user_id = ? AND role <> ?", taskID, toID, models.RoleOwner).
+			Update("role", models.RoleOwner)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrNotMember
+		}
+
+		result = tx.Model(&models.UserTask{}).
+			Where("task_id = ? AND user_id = ? AND role = ?", taskID, fromID, models.RoleOwner).
+			Update("role", models.RoleAdmin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrTaskForbidden
+		}
+		return nil
+	})
+}
+
+// CreateInvite 新建邀请，同一邮箱对同一 task 未处理的旧邀请作废
+func (r *repository) CreateInvite(ctx context.Context, inv *models.TaskInvite) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.TaskInvite{}).
+			Where("task_id = ? AND email = ? AND status = ?", inv.TaskID, inv.Email, models.InvitePending).
+			Update("status", models.InviteRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Create(inv).Error
+	})
+}
+
+// FindInvite 按 token 哈希查找仍可使用的邀请
+func (r *repository) FindInvite(ctx context.Context, tokenHash string) (*models.TaskInvite, error) {
+	var inv models.TaskInvite
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND status = ? AND expires_at > ?", tokenHash, models.InvitePending, time.Now()).
+		First(&inv).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// AcceptInvite 在同一事务中核销邀请并加入成员，邀请只能被使用一次
+func (r *repository) AcceptInvite(ctx context.Context, inv *models.TaskInvite, userID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := consumeInvite(tx, inv.ID, models.InviteAccepted); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.UserTask{}).
+			Where("task_id = ? AND user_id = ?", inv.TaskID, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errorx.ErrAlreadyMember
+		}
+		return tx.Create(&models.UserTask{
+			TaskID: inv.TaskID,
+			UserID: userID,
+			Role:   inv.Role,
+		}).Error
+	})
+}
+
+func (r *repository) DeclineInvite(ctx context.Context, id uint64) error {
+	return consumeInvite(r.db.WithContext(ctx), id, models.InviteDeclined)
+}
+
+func consumeInvite(tx *gorm.DB, id uint64, status models.InviteStatus) error {
+	result := tx.Model(&models.TaskInvite{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, models.InvitePending, time.Now()).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errorx.ErrInviteInvalid
+	}
+	return nil
+}
@@ -2,18 +2,46 @@ package task
 
 import (
 	"asum/pkg/engine"
+	"asum/pkg/middleware"
+	"asum/pkg/models"
+	"asum/pkg/rbac"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-func RegisterRoutes(r fiber.Router, h *Handler) {
+func RegisterRoutes(r fiber.Router, h *Handler, perms *rbac.Store) {
+	write := middleware.Require(perms, models.PermissionTasksWrite)
 
 	task := r.Group("/task")
+	task.Use(middleware.Require(perms, models.PermissionTasksRead))
 	{
+		task.Post("/invites/accept", write, engine.H(h.AcceptInvite))
+		task.Post("/invites/decline", write, engine.H(h.DeclineInvite))
+
+		task.Get("/trash", engine.H(h.ListTrash))
+		task.Post("/:id/restore", write, engine.H(h.RestoreTask))
+
 		task.Get("/", engine.H(h.ListTask))
-		task.Post("/", engine.H(h.CreateTask))
-		task.Patch("/:id", engine.H(h.UpdateTask))
-		task.Delete("/:id", engine.H(h.DeleteTask))
+		task.Post("/", write, engine.H(h.CreateTask))
+		task.Patch("/:id", write, engine.H(h.UpdateTask))
+		task.Delete("/:id", write, engine.H(h.DeleteTask))
 		task.Get("/:id", engine.H(h.GetTask))
+		task.Put("/:id/policy", write, engine.H(h.UpdateKeyPolicy))
+		task.Put("/:id/lookup", write, engine.H(h.UpdateLookup))
+		task.Get("/:id/keys", engine.H(h.ListKeys))
+		task.Post("/:id/rotate-key", write, engine.H(h.RotateKey))
+
+		task.Get("/:id/members", engine.H(h.ListMembers))
+		task.Post("/:id/members", write, engine.H(h.InviteMember))
+		task.Patch("/:id/members/:userId", write, engine.H(h.UpdateMember))
+		task.Delete("/:id/members/:userId", write, engine.H(h.RemoveMember))
+		task.Post("/:id/leave", write, engine.H(h.LeaveTask))
+		task.Post("/:id/transfer", write, engine.H(h.TransferOwner))
 	}
 }
+
+// RegisterPublicRoutes 注册邮件链接使用的免登录接口：GET 只返回确认页，POST 才执行操作
+func RegisterPublicRoutes(r fiber.Router, h *Handler) {
+	r.Get("/task/invites/accept", engine.H(h.AcceptInvitePage))
+	r.Post("/task/invites/accept", engine.H(h.AcceptInviteLink))
+}
@@ -1,34 +1,117 @@
 package task
 
 import (
+	"asum/internal/auth"
 	"asum/internal/user"
+	"asum/pkg/apikey"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/middleware"
 	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"asum/pkg/queue"
+	"asum/pkg/rdb"
+	"asum/pkg/usage"
 	"asum/pkg/utils"
+	"asum/pkg/webhook"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
 	"strings"
+	"time"
 )
 
 type Service interface {
-	CreateTask(c context.Context, req *CreateTaskReq, userID uint64) error
+	CreateTask(c context.Context, req *CreateTaskReq, userID uint64) (*CreateTaskResp, error)
+	ListTask(c context.Context, userID uint64, p *pagination.Params) (*pagination.Page[models.Task], error)
+	GetTask(c context.Context, taskID, userID uint64) (*models.Task, error)
+	UpdateTask(c context.Context, taskID, userID uint64, req *UpdateTaskReq) (*models.Task, error)
+	DeleteTask(c context.Context, taskID, userID uint64) error
+	ListTrash(c context.Context, userID uint64) ([]TrashTask, error)
+	RestoreTask(c context.Context, taskID, userID uint64) (*models.Task, error)
+	UpdateKeyPolicy(c context.Context, taskID, userID uint64, req *KeyPolicyReq) (*models.KeyPolicy, error)
+	UpdateLookup(c context.Context, taskID, userID uint64, req *models.LookupDefaults) (*models.LookupDefaults, error)
+	RotateKey(c context.Context, taskID, userID uint64, req *RotateKeyReq) (*RotateKeyResp, error)
+	KeyUsage(c context.Context, taskID, userID uint64) ([]KeyUsage, error)
+
+	ListMembers(c context.Context, taskID, userID uint64, p *pagination.Params) (*pagination.Page[TaskMember], error)
+	InviteMember(c context.Context, taskID, userID uint64, req *InviteMemberReq) (*models.TaskInvite, error)
+	UpdateMemberRole(c context.Context, taskID, userID, memberID uint64, req *UpdateMemberReq) error
+	RemoveMember(c context.Context, taskID, userID, memberID uint64) error
+	AcceptInvite(c context.Context, userID uint64, token string) (*AcceptInviteResp, error)
+	AcceptInviteByLink(c context.Context, token string) (*AcceptInviteResp, error)
+	DeclineInvite(c context.Context, token string) error
+	LeaveTask(c context.Context, taskID, userID uint64) error
+	TransferOwner(c context.Context, taskID, userID uint64, req *TransferOwnerReq) error
+	RunKeyReaper(ctx context.Context, interval time.Duration) error
+	RunTrashPurger(ctx context.Context, interval time.Duration) error
+	PurgeOwned(ctx context.Context, userID uint64) error
 }
 
+const (
+	defaultKeyGrace = 24 * time.Hour
+	maxKeyGrace     = 30 * 24 * time.Hour
+	keyUsageDays    = 7
+	inviteExpiry    = 7 * 24 * time.Hour
+	purgeBatch      = 100
+)
+
 type service struct {
 	repo     Repository
 	userRepo user.Repository
+	cache    *rdb.Client
+	hasher   *apikey.Hasher
+	keys     *apikey.Store
+	q        *queue.RedisQueue[*auth.EmailJob]
+	hooks    *webhook.Dispatcher
+	baseURL  string
+	// retention 为删除的 task 在回收站中保留的时长
+	retention time.Duration
 }
 
-func NewService(repo Repository, userRepo user.Repository) Service {
-	return &service{repo: repo, userRepo: userRepo}
+func NewService(
+	repo Repository,
+	userRepo user.Repository,
+	cache *rdb.Client,
+	hasher *apikey.Hasher,
+	keys *apikey.Store,
+	emailQueue *queue.RedisQueue[*auth.EmailJob],
+	hooks *webhook.Dispatcher,
+	baseURL string,
+	trashRetention time.Duration,
+) Service {
+	return &service{
+		repo:     repo,
+		userRepo: userRepo,
+		cache:    cache,
+		hasher:   hasher,
+		keys:     keys,
+		q:        emailQueue,
+		hooks:    hooks,
+		baseURL:  baseURL,
+
+		retention: trashRetention,
+	}
 }
 
-func (s *service) CreateTask(c context.Context, req *CreateTaskReq, userID uint64) error {
-	if err := s.repo.Create(c, userID, &models.Task{
-		Name:    strings.Trim(req.Name, " "),
-		Remark:  strings.Trim(req.Remark, " "),
-		Status:  models.StatusEnabled,
-		TaskKey: utils.NewUUID(),
-	}); err != nil {
-		return err
+func (s *service) CreateTask(c context.Context, req *CreateTaskReq, userID uint64) (*CreateTaskResp, error) {
+	key := s.hasher.Generate()
+	t := &models.Task{
+		Name:      strings.Trim(req.Name, " "),
+		Remark:    strings.Trim(req.Remark, " "),
+		Status:    models.StatusEnabled,
+		KeyPrefix: key.Prefix,
+		KeyHash:   key.Hash,
+	}
+	if err := s.repo.Create(c, userID, t); err != nil {
+		return nil, err
+	}
+	if err := s.keys.SyncTask(c, t.ID); err != nil {
+		return nil, err
 	}
 	_ = s.userRepo.AddLog(c, &models.UserLog{
 		UserID:    userID,
@@ -37,5 +120,562 @@ func (s *service) CreateTask(c context.Context, req *CreateTaskReq, userID uint6
 		Type:      models.LogTypeCreateTask,
 	})
 
+	return &CreateTaskResp{
+		ID:        t.ID,
+		TaskKey:   key.Plain,
+		KeyPrefix: key.Prefix,
+	}, nil
+}
+
+func (s *service) ListTask(c context.Context, userID uint64, p *pagination.Params) (*pagination.Page[models.Task], error) {
+	tasks, err := s.repo.ListByUser(c, userID, p)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Cut(p, tasks, func(t *models.Task) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: t.CreatedAt, ID: t.ID}
+	}), nil
+}
+
+func (s *service) GetTask(c context.Context, taskID, userID uint64) (*models.Task, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermViewUsage); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(c, taskID)
+}
+
+func (s *service) UpdateTask(c context.Context, taskID, userID uint64, req *UpdateTaskReq) (*models.Task, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+	t, err := s.repo.FindByID(c, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.Trim(*req.Name, " ")
+		if name == "" {
+			return nil, errorx.ErrInvalidRequestBody
+		}
+		t.Name = name
+	}
+	if req.Remark != nil {
+		t.Remark = strings.Trim(*req.Remark, " ")
+	}
+	statusChanged := false
+	if req.Status != nil {
+		if *req.Status != models.StatusEnabled && *req.Status != models.StatusDisabled {
+			return nil, errorx.ErrInvalidRequestBody
+		}
+		statusChanged = *req.Status != t.Status
+		t.Status = *req.Status
+	}
+
+	if err := s.repo.Update(c, t); err != nil {
+		return nil, err
+	}
+
+	if statusChanged {
+		if err := s.keys.SyncTask(c, taskID); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (s *service) DeleteTask(c context.Context, taskID, userID uint64) error {
+	if _, err := s.authorize(c, taskID, userID, models.PermDeleteTask); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(c, taskID); err != nil {
+		return err
+	}
+	return s.keys.SyncTask(c, taskID)
+}
+
+func (s *service) ListTrash(c context.Context, userID uint64) ([]TrashTask, error) {
+	tasks, err := s.repo.ListTrash(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TrashTask, len(tasks))
+	for i, t := range tasks {
+		out[i] = TrashTask{Task: t, DeletedAt: *t.DeletedAt, PurgeAt: t.DeletedAt.Add(s.retention)}
+	}
+	return out, nil
+}
+
+// RestoreTask 从回收站恢复 task，key 缓存随之恢复
+func (s *service) RestoreTask(c context.Context, taskID, userID uint64) (*models.Task, error) {
+	t, err := s.repo.FindTrashed(c, taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(c, taskID); err != nil {
+		return nil, err
+	}
+	if err := s.keys.SyncTask(c, taskID); err != nil {
+		return nil, err
+	}
+	t.DeletedAt = nil
+	return t, nil
+}
+
+// authorize 校验用户是 task 成员且其角色拥有 perm 权限，返回其成员关系
+func (s *service) authorize(c context.Context, taskID, userID uint64, perm models.TaskPerm) (*models.UserTask, error) {
+	m, err := s.repo.GetMember(c, taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Role.Can(perm) {
+		return nil, errorx.ErrTaskForbidden
+	}
+	return m, nil
+}
+
+func (s *service) UpdateKeyPolicy(c context.Context, taskID, userID uint64, req *KeyPolicyReq) (*models.KeyPolicy, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+
+	policy, err := req.toPolicy(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateKeyPolicy(c, taskID, policy); err != nil {
+		return nil, err
+	}
+	if err := s.keys.SyncTask(c, taskID); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// toPolicy 校验并规范化访问限制：单个 IP 转为 /32 或 /128，来源站点只保留 scheme://host[:port]
+func (req *KeyPolicyReq) toPolicy(now time.Time) (*models.KeyPolicy, error) {
+	policy := &models.KeyPolicy{
+		ExpiresAt:    req.ExpiresAt,
+		MaxBatchSize: req.MaxBatchSize,
+	}
+	if policy.MaxBatchSize < 0 {
+		return nil, errorx.ErrInvalidKeyPolicy
+	}
+	if policy.ExpiresAt != nil && !policy.ExpiresAt.After(now) {
+		return nil, errorx.ErrInvalidKeyPolicy
+	}
+
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return nil, errorx.ErrInvalidKeyPolicy
+		}
+		if !slices.Contains(policy.Scopes, scope) {
+			policy.Scopes = append(policy.Scopes, scope)
+		}
+	}
+
+	for _, cidr := range req.AllowedCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			cidr = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errorx.ErrInvalidKeyPolicy
+		}
+		policy.AllowedCIDRs = append(policy.AllowedCIDRs, network.String())
+	}
+
+	for _, origin := range req.AllowedOrigins {
+		u, err := url.Parse(strings.TrimSpace(origin))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errorx.ErrInvalidKeyPolicy
+		}
+		policy.AllowedOrigins = append(policy.AllowedOrigins, u.Scheme+"://"+strings.ToLower(u.Host))
+	}
+
+	return policy, nil
+}
+
+// UpdateLookup 设置使用该 task key 查询时的默认参数，写入 key 缓存后立即生效
+func (s *service) UpdateLookup(c context.Context, taskID, userID uint64, req *models.LookupDefaults) (*models.LookupDefaults, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+	if !req.Valid() {
+		return nil, errorx.ErrInvalidLookup
+	}
+	d := *req
+	d.Fields = nil
+	for _, f := range req.Fields {
+		if !slices.Contains(d.Fields, f) {
+			d.Fields = append(d.Fields, f)
+		}
+	}
+
+	if err := s.repo.UpdateLookup(c, taskID, &d); err != nil {
+		return nil, err
+	}
+	if err := s.keys.SyncTask(c, taskID); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (s *service) RotateKey(c context.Context, taskID, userID uint64, req *RotateKeyReq) (*RotateKeyResp, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+
+	grace := defaultKeyGrace
+	if req.GraceSeconds != nil {
+		grace = time.Duration(*req.GraceSeconds) * time.Second
+	}
+	if grace < 0 || grace > maxKeyGrace {
+		return nil, errorx.ErrInvalidRequestBody
+	}
+
+	var graceUntil *time.Time
+	if grace > 0 {
+		t := time.Now().Add(grace)
+		graceUntil = &t
+	}
+
+	newKey := s.hasher.Generate()
+	before, err := s.repo.RotateKey(c, taskID, newKey.Prefix, newKey.Hash, graceUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 上一次轮换遗留的旧 key 直接作废；未设置宽限期时当前 key 也立即作废
+	revoked := []string{before.PrevKeyHash}
+	if graceUntil == nil {
+		revoked = append(revoked, before.KeyHash)
+	}
+	if err := s.keys.SyncTask(c, taskID, revoked...); err != nil {
+		return nil, err
+	}
+
+	_ = s.userRepo.AddLog(c, &models.UserLog{
+		UserID:    userID,
+		IP:        utils.GetRemoteIP(c),
+		UserAgent: utils.GetUserAgent(c),
+		Type:      models.LogTypeRotateKey,
+		Extra:     fmt.Sprintf("task %d: %s -> %s", taskID, before.KeyPrefix, newKey.Prefix),
+	})
+
+	resp := &RotateKeyResp{
+		TaskKey:   newKey.Plain,
+		KeyPrefix: newKey.Prefix,
+	}
+	if graceUntil != nil {
+		resp.PrevKeyPrefix = before.KeyPrefix
+		resp.PrevKeyExpiresAt = graceUntil
+	}
+	s.hooks.Go(taskID, models.EventKeyRotated, &webhook.KeyRotatedData{
+		KeyPrefix:        resp.KeyPrefix,
+		PrevKeyPrefix:    resp.PrevKeyPrefix,
+		PrevKeyExpiresAt: resp.PrevKeyExpiresAt,
+		RotatedBy:        userID,
+	})
+	return resp, nil
+}
+
+func (s *service) KeyUsage(c context.Context, taskID, userID uint64) ([]KeyUsage, error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermViewUsage); err != nil {
+		return nil, err
+	}
+
+	t, err := s.repo.FindByID(c, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	daily, err := usage.Days(c, s.cache, t.ID, t.KeyPrefix, keyUsageDays)
+	if err != nil {
+		return nil, err
+	}
+	out := []KeyUsage{{KeyPrefix: t.KeyPrefix, Current: true, Daily: daily}}
+
+	if t.PrevKeyActive(time.Now()) {
+		daily, err := usage.Days(c, s.cache, t.ID, t.PrevKeyPrefix, keyUsageDays)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, KeyUsage{KeyPrefix: t.PrevKeyPrefix, ExpiresAt: t.PrevKeyExpiresAt, Daily: daily})
+	}
+	return out, nil
+}
+
+func (s *service) ListMembers(c context.Context, taskID, userID uint64, p *pagination.Params) (*pagination.Page[TaskMember], error) {
+	if _, err := s.authorize(c, taskID, userID, models.PermViewUsage); err != nil {
+		return nil, err
+	}
+	members, err := s.repo.PageMembers(c, taskID, p)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Cut(p, members, func(m *TaskMember) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: m.CreatedAt, ID: m.ID}
+	}), nil
+}
+
+// InviteMember 向邮箱发送邀请，只能邀请角色低于自己的成员；邀请 7 天内有效且只能使用一次
+func (s *service) InviteMember(c context.Context, taskID, userID uint64, req *InviteMemberReq) (*models.TaskInvite, error) {
+	m, err := s.authorize(c, taskID, userID, models.PermManageMembers)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Role.Valid() || req.Role == models.RoleOwner || !m.Role.Outranks(req.Role) {
+		return nil, errorx.ErrInvalidRole
+	}
+	email := utils.SanitizeEmail(req.Email)
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	if invitee, err := s.userRepo.FindByEmail(c, email); err == nil {
+		if _, err := s.repo.GetMember(c, taskID, invitee.ID); err == nil {
+			return nil, errorx.ErrAlreadyMember
+		}
+	}
+
+	t, err := s.repo.FindByID(c, taskID)
+	if err != nil {
+		return nil, err
+	}
+	inviter, err := s.userRepo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := utils.GenerateConfirmToken()
+	inv := &models.TaskInvite{
+		TaskID:    taskID,
+		Email:     email,
+		Role:      req.Role,
+		InviterID: userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(inviteExpiry),
+	}
+	if err := s.repo.CreateInvite(c, inv); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&auth.InvitePayload{
+		TaskName: t.Name,
+		Inviter:  inviter.Name,
+		Role:     string(req.Role),
+		Link:     fmt.Sprintf("%s/v1/task/invites/accept?token=%s", s.baseURL, token),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.q.Push(c, &auth.EmailJob{
+		RequestID: utils.GetRequestID(c),
+		EmailType: auth.TypeTaskInvite,
+		To:        email,
+		Name:      email,
+		Data:      payload,
+	}); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *service) UpdateMemberRole(c context.Context, taskID, userID, memberID uint64, req *UpdateMemberReq) error {
+	m, err := s.authorize(c, taskID, userID, models.PermManageMembers)
+	if err != nil {
+		return err
+	}
+	target, err := s.repo.GetMember(c, taskID, memberID)
+	if err != nil {
+		return errorx.ErrNotMember
+	}
+	// owner 只能通过转让变更
+	if !req.Role.Valid() || req.Role == models.RoleOwner ||
+		!m.Role.Outranks(target.Role) || !m.Role.Outranks(req.Role) {
+		return errorx.ErrInvalidRole
+	}
+	return s.repo.AddUser(c, taskID, memberID, req.Role)
+}
+
+func (s *service) RemoveMember(c context.Context, taskID, userID, memberID uint64) error {
+	m, err := s.authorize(c, taskID, userID, models.PermManageMembers)
+	if err != nil {
+		return err
+	}
+	target, err := s.repo.GetMember(c, taskID, memberID)
+	if err != nil {
+		return errorx.ErrNotMember
+	}
+	if !m.Role.Outranks(target.Role) {
+		return errorx.ErrTaskForbidden
+	}
+	return s.repo.RemoveUser(c, taskID, memberID)
+}
+
+// AcceptInvite 当前登录用户的邮箱须与受邀邮箱一致
+func (s *service) AcceptInvite(c context.Context, userID uint64, token string) (*AcceptInviteResp, error) {
+	inv, err := s.repo.FindInvite(c, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Email != inv.Email {
+		return nil, errorx.ErrInviteMismatch
+	}
+	return s.acceptInvite(c, inv, u)
+}
+
+// AcceptInviteByLink 邮件中的链接，收到邮件即证明持有受邀邮箱，由 token 确定受邀用户
+func (s *service) AcceptInviteByLink(c context.Context, token string) (*AcceptInviteResp, error) {
+	inv, err := s.repo.FindInvite(c, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.FindByEmail(c, inv.Email)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return nil, errorx.ErrInviteNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != models.StatusActive {
+		return nil, errorx.ErrInviteNoAccount
+	}
+	return s.acceptInvite(c, inv, u)
+}
+
+func (s *service) acceptInvite(c context.Context, inv *models.TaskInvite, u *models.User) (*AcceptInviteResp, error) {
+	if err := s.repo.AcceptInvite(c, inv, u.ID); err != nil {
+		return nil, err
+	}
+	s.hooks.Go(inv.TaskID, models.EventMemberJoined, &webhook.MemberJoinedData{UserID: u.ID, Email: u.Email, Role: inv.Role})
+	return &AcceptInviteResp{TaskID: inv.TaskID, Role: inv.Role}, nil
+}
+
+func (s *service) DeclineInvite(c context.Context, token string) error {
+	inv, err := s.repo.FindInvite(c, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	return s.repo.DeclineInvite(c, inv.ID)
+}
+
+func (s *service) LeaveTask(c context.Context, taskID, userID uint64) error {
+	m, err := s.repo.GetMember(c, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if m.Role == models.RoleOwner {
+		return errorx.ErrOwnerCannotLeave
+	}
+	return s.repo.RemoveUser(c, taskID, userID)
+}
+
+// TransferOwner 转让后原 owner 降为 admin，key 的等级与用量改记到新 owner 名下
+func (s *service) TransferOwner(c context.Context, taskID, userID uint64, req *TransferOwnerReq) error {
+	m, err := s.repo.GetMember(c, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if m.Role != models.RoleOwner || req.UserID == userID {
+		return errorx.ErrTaskForbidden
+	}
+	if err := s.repo.TransferOwner(c, taskID, userID, req.UserID); err != nil {
+		return err
+	}
+	return s.keys.SyncTask(c, taskID)
+}
+
+// RunKeyReaper 定期清除已过宽限期的旧 key 及其缓存
+func (s *service) RunKeyReaper(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		keys, err := s.repo.ClearExpiredPrevKeys(ctx, time.Now())
+		if err != nil {
+			logx.Errorf("clear expired task keys: %v", err)
+			continue
+		}
+		if err := s.keys.Revoke(ctx, keys...); err != nil {
+			logx.Errorf("delete expired task key cache: %v", err)
+		}
+	}
+}
+
+// RunTrashPurger 定期彻底删除超过保留期的 task 及其关联数据与用量计数
+func (s *service) RunTrashPurger(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		tasks, err := s.repo.ListPurgeable(ctx, time.Now().Add(-s.retention), purgeBatch)
+		if err != nil {
+			logx.Errorf("list purgeable tasks: %v", err)
+			continue
+		}
+		for _, t := range tasks {
+			if err := s.purge(ctx, &t); err != nil {
+				logx.Errorf("purge task %d: %v", t.ID, err)
+			}
+		}
+	}
+}
+
+// PurgeOwned 彻底删除用户作为 owner 的全部 task，用于注销账号
+func (s *service) PurgeOwned(ctx context.Context, userID uint64) error {
+	tasks, err := s.repo.ListOwned(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if err := s.purge(ctx, &t); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (s *service) purge(ctx context.Context, t *models.Task) error {
+	// 多实例同时清理时另一实例可能已删除
+	if err := s.repo.HardDelete(ctx, t.ID); err != nil && !errors.Is(err, models.ErrTaskNotFound) {
+		return err
+	}
+	if err := s.keys.SyncTask(ctx, t.ID, t.KeyHash, t.PrevKeyHash); err != nil {
+		return err
+	}
+	var limits []string
+	for _, hash := range []string{t.KeyHash, t.PrevKeyHash} {
+		if hash != "" {
+			limits = append(limits, middleware.ApiKeyLimitKeys(hash)...)
+		}
+	}
+	if len(limits) > 0 {
+		if err := s.cache.Del(ctx, limits...).Err(); err != nil {
+			return err
+		}
+	}
+	return usage.DeleteTask(ctx, s.cache, t.ID)
+}
@@ -6,4 +6,6 @@ var (
 	ErrUserNotFound      = errors.New("此用户不存在")
 	ErrUserAlreadyExists = errors.New("此用户已存在")
 	ErrInvalidPassword   = errors.New("无效的密码")
+	ErrWrongPassword     = errors.New("当前密码错误")
+	ErrSamePassword      = errors.New("新密码不能与当前密码相同")
 )
@@ -1,6 +1,13 @@
 package user
 
-import "github.com/gofiber/fiber/v3"
+import (
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/pagination"
+	"asum/pkg/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
 
 type Handler struct {
 	service Service
@@ -10,26 +17,130 @@ func NewHandler(userSvc Service) *Handler {
 	return &Handler{service: userSvc}
 }
 
-func (h *Handler) CreateUser(c fiber.Ctx) error {
-	// return
-	return nil
+// GetMe 查看当前用户资料
+// @Summary 查看个人资料
+// @Description 返回当前登录用户的资料、等级(套餐)与余额。
+// @Tags User
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=Profile} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me [get]
+func (h *Handler) GetMe(c *engine.Ctx) error {
+	data, err := h.service.Profile(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusNotFound, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateMe 修改当前用户资料
+// @Summary 修改个人资料
+// @Tags User
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body UpdateProfileReq true "资料"
+// @Success 200 {object} engine.Response{data=Profile} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me [patch]
+func (h *Handler) UpdateMe(c *engine.Ctx) error {
+	var req UpdateProfileReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.UpdateProfile(c.StdCtx, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	}
+	return c.OK(data)
 }
 
-func (h *Handler) UpdateUser(c fiber.Ctx) error {
-	// return
-	return nil
+// ChangePassword 修改密码
+// @Summary 修改密码
+// @Description 需提供当前密码，新密码至少 8 位。
+// @Tags User
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body ChangePasswordReq true "密码"
+// @Success 200 {object} engine.Response "修改成功"
+// @Failure 400 {object} engine.Response "参数错误或当前密码错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "模拟登录时不能修改密码"
+// @Router /app/user/me/password [put]
+func (h *Handler) ChangePassword(c *engine.Ctx) error {
+	if utils.GetImpersonatorID(c) != 0 {
+		return c.Fail(fiber.StatusForbidden, errorx.ErrForbidden)
+	}
+	var req ChangePasswordReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.ChangePassword(c.StdCtx, utils.GetUserID(c), &req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, err.Error())
+	}
+	return c.OK(nil)
 }
 
-func (h *Handler) GetUser(c fiber.Ctx) error {
-	// return
-	return nil
+// ListLogins 查看登录记录
+// @Summary 查看登录记录
+// @Description 返回最近 20 次登录的时间、IP 与 User-Agent。
+// @Tags User
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]models.UserLog} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me/logins [get]
+func (h *Handler) ListLogins(c *engine.Ctx) error {
+	data, err := h.service.LoginHistory(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
 }
 
-func (h *Handler) DeleteUser(c fiber.Ctx) error {
-	// return
-	return nil
+// ListMyTasks 查看当前用户参与的任务
+// @Summary 查看我的任务
+// @Tags User
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} engine.Response{data=[]MyTask} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me/tasks [get]
+func (h *Handler) ListMyTasks(c *engine.Ctx) error {
+	data, err := h.service.ListTasks(c.StdCtx, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OK(data)
 }
 
-func (h *Handler) ListUser(c fiber.Ctx) error {
-	return nil
+// ListLogs 查看当前用户的操作日志
+// @Summary 查看操作日志
+// @Tags User
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param cursor query string false "上一页返回的 nextCursor"
+// @Param sort query string false "排序 created_at/-created_at，默认 -created_at"
+// @Param type query int false "按日志类型筛选"
+// @Success 200 {object} engine.Response{data=engine.CursorPage{list=[]models.UserLog}} "查询成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Router /app/user/me/logs [get]
+func (h *Handler) ListLogs(c *engine.Ctx) error {
+	p, err := pagination.Parse(c, logListSpec)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, err)
+	}
+
+	page, err := h.service.ListLogs(c.StdCtx, utils.GetUserID(c), p)
+	if err != nil {
+		return c.Fail(fiber.StatusInternalServerError, err.Error())
+	}
+	return c.OKPage(page.List, page.Next)
 }
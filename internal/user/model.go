@@ -1 +1,63 @@
 package user
+
+import (
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"time"
+)
+
+// 操作日志可按类型筛选
+var logListSpec = &pagination.Spec{
+	Name: "user_logs",
+	Filters: map[string]pagination.Filter{
+		"type": {Column: "type", Int: true},
+	},
+}
+
+// loginHistoryLimit 为登录记录返回的条数
+const loginHistoryLimit = 20
+
+type Profile struct {
+	ID     uint64            `json:"id"`
+	Name   string            `json:"name"`
+	Email  string            `json:"email"`
+	Level  models.Level      `json:"level"`
+	Plan   string            `json:"plan"`
+	Quota  int               `json:"quota"`
+	Status models.UserStatus `json:"status"`
+
+	CreatedAt time.Time  `json:"createdAt"`
+	LoginAt   *time.Time `json:"loginAt,omitempty"`
+}
+
+func newProfile(u *models.User) *Profile {
+	return &Profile{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email,
+		Level:     u.Level,
+		Plan:      u.Level.String(),
+		Quota:     u.Quota,
+		Status:    u.Status,
+		CreatedAt: u.CreatedAt,
+		LoginAt:   u.LoginAt,
+	}
+}
+
+type MyTask struct {
+	ID        uint64            `json:"id"`
+	Name      string            `json:"name"`
+	KeyPrefix string            `json:"keyPrefix"`
+	Status    models.TaskStatus `json:"status"`
+	Role      models.TaskRole   `json:"role"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type UpdateProfileReq struct {
+	Name string `json:"name"`
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
@@ -1,14 +1,15 @@
 package user
 
 import (
+	"asum/pkg/apikey"
 	"asum/pkg/db"
+	"asum/pkg/errorx"
 	"asum/pkg/models"
+	"asum/pkg/pagination"
 	"asum/pkg/rdb"
 	"asum/pkg/utils"
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -19,33 +20,43 @@ type Repository interface {
 	Update(ctx context.Context, u *models.User) error
 	UserActiveAndInit(ctx context.Context, id uint64, level models.Level) error
 	Delete(ctx context.Context, id uint64) error
+	// HardDelete 在同一事务中删除用户及其日志、成员关系、两步验证、第三方身份、用量告警、
+	// 修改邮箱记录、会话与 refresh token，以及发给该邮箱的任务邀请
 	HardDelete(ctx context.Context, id uint64) error
 
+	FindByID(ctx context.Context, id uint64) (*models.User, error)
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	ExistsByEmail(ctx context.Context, email string) (bool, error)
 
 	AddLog(ctx context.Context, log *models.UserLog) error
-	GetLogs(ctx context.Context, userID uint64, limit int) ([]models.UserLog, error)
+	GetLogs(ctx context.Context, userID uint64, limit int, types ...models.LogType) ([]models.UserLog, error)
+	ListLogs(ctx context.Context, userID uint64, p *pagination.Params) ([]models.UserLog, error)
+	AllLogs(ctx context.Context, userID uint64) ([]models.UserLog, error)
 	AddTask(ctx context.Context, userTask *models.UserTask) error
 	RemoveTask(ctx context.Context, userID, taskID uint64) error
 	GetTasks(ctx context.Context, userID uint64) ([]models.UserTask, error)
+	ListMyTasks(ctx context.Context, userID uint64) ([]MyTask, error)
 
 	GetQuotaByKey(ctx context.Context, key string) int64
+	AdjustQuota(ctx context.Context, id uint64, delta int) (int64, error)
 	UpdateLoginTime(ctx context.Context, id uint64) error
 }
 
 type repository struct {
-	db  *db.DB
-	rdb *rdb.Client
+	db     *db.DB
+	rdb    *rdb.Client
+	hasher *apikey.Hasher
+	keys   *apikey.Store
 }
 
-func NewRepository(db *db.DB, rdb *rdb.Client) Repository {
+func NewRepository(db *db.DB, rdb *rdb.Client, hasher *apikey.Hasher, keys *apikey.Store) Repository {
 	if err := db.AutoMigrate(&models.User{}, &models.UserLog{}, &models.UserTask{}); err != nil {
 		panic(err)
 	}
-	return &repository{db: db, rdb: rdb}
+	return &repository{db: db, rdb: rdb, hasher: hasher, keys: keys}
 }
 
+// GetQuotaByKey 返回 key 所属 task 的 owner 的余额，成员的余额与 task 无关
 func (r *repository) GetQuotaByKey(ctx context.Context, key string) int64 {
 	var quota int
 
@@ -54,7 +65,8 @@ func (r *repository) GetQuotaByKey(ctx context.Context, key string) int64 {
 		Select("users.quota").
 		Joins("INNER JOIN user_tasks ON user_tasks.user_id = users.id").
 		Joins("INNER JOIN tasks ON tasks.id = user_tasks.task_id").
-		Where("tasks.task_key = ?", key).
+		Where("tasks.key_hash = ? OR tasks.prev_key_hash = ?", key, key).
+		Where("user_tasks.role = ?", models.RoleOwner).
 		Where("users.deleted_at IS NULL").
 		Where("tasks.deleted_at IS NULL").
 		Limit(1).
@@ -67,6 +79,21 @@ func (r *repository) GetQuotaByKey(ctx context.Context, key string) int64 {
 	return int64(quota)
 }
 
+// AdjustQuota 原子调整用户余额并返回调整后的余额，调整后不能为负
+func (r *repository) AdjustQuota(ctx context.Context, id uint64, delta int) (int64, error) {
+	var quota int64
+	result := r.db.WithContext(ctx).
+		Raw("UPDATE users SET quota = quota + ? WHERE id = ? AND quota + ? >= 0 AND deleted_at IS NULL RETURNING quota", delta, id, delta).
+		Scan(&quota)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errorx.ErrQuota
+	}
+	return quota, nil
+}
+
 func (r *repository) Create(ctx context.Context, u *models.User) error {
 	exists, err := r.ExistsByEmail(ctx, u.Email)
 	if err != nil {
@@ -80,18 +107,19 @@ func (r *repository) Create(ctx context.Context, u *models.User) error {
 }
 
 func (r *repository) UserActiveAndInit(ctx context.Context, id uint64, lev models.Level) error {
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
 			"status": models.StatusActive,
 		}).Error; err != nil {
 			return err
 		}
-		taskKey := utils.NewUUID()
+		key := r.hasher.Generate()
 		newTask := models.Task{
-			Name:    "默认空间",
-			TaskKey: taskKey,
-			Status:  models.StatusEnabled,
-			Remark:  "用户激活自动初始化",
+			Name:      "默认空间",
+			KeyPrefix: key.Prefix,
+			KeyHash:   key.Hash,
+			Status:    models.StatusEnabled,
+			Remark:    "用户激活自动初始化",
 		}
 
 		if err := tx.Create(&newTask).Error; err != nil {
@@ -100,6 +128,7 @@ func (r *repository) UserActiveAndInit(ctx context.Context, id uint64, lev model
 		newUserTask := models.UserTask{
 			UserID: id,
 			TaskID: newTask.ID,
+			Role:   models.RoleOwner,
 		}
 
 		if err := tx.Create(&newUserTask).Error; err != nil {
@@ -113,15 +142,12 @@ func (r *repository) UserActiveAndInit(ctx context.Context, id uint64, lev model
 			Extra:     "User activated and default workspace created",
 		}
 
-		if err := tx.Create(&newLog).Error; err != nil {
-			return err
-		}
-		cache, _ := json.Marshal(models.ApiCache{UserLevel: lev, Quota: 0})
-		if err := r.rdb.Set(ctx, fmt.Sprintf("apiKey:%s", taskKey), string(cache), 0).Err(); err != nil {
-			return err
-		}
-		return nil
+		return tx.Create(&newLog).Error
 	})
+	if err != nil {
+		return err
+	}
+	return r.keys.SyncUser(ctx, id)
 }
 
 func (r *repository) Update(ctx context.Context, u *models.User) error {
@@ -136,13 +162,16 @@ func (r *repository) Update(ctx context.Context, u *models.User) error {
 	if result.RowsAffected == 0 {
 		return ErrUserNotFound
 	}
-	return nil
+	// 等级或状态（封号）变化需要同步到 key 缓存
+	return r.keys.SyncUser(ctx, u.ID)
 }
 
 func (r *repository) Delete(ctx context.Context, id uint64) error {
+	// DeletedAt 不是 gorm.DeletedAt，这里手动置位，否则会真删除
 	result := r.db.WithContext(ctx).
+		Model(&models.User{}).
 		Where("id = ? AND deleted_at IS NULL", id).
-		Delete(&models.User{})
+		Update("deleted_at", time.Now())
 
 	if result.Error != nil {
 		return result.Error
@@ -150,17 +179,46 @@ func (r *repository) Delete(ctx context.Context, id uint64) error {
 	if result.RowsAffected == 0 {
 		return ErrUserNotFound
 	}
-	return nil
+	return r.keys.SyncUser(ctx, id)
 }
 
 func (r *repository) HardDelete(ctx context.Context, id uint64) error {
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("user_id = ?", id).Delete(&models.UserLog{}).Error; err != nil {
+	// 关联删除后就无法再按用户找到这些 task，先记下来
+	var taskIDs []uint64
+	if err := r.db.WithContext(ctx).
+		Model(&models.UserTask{}).
+		Where("user_id = ?", id).
+		Pluck("task_id", &taskIDs).Error; err != nil {
+		return err
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 发给该邮箱的邀请按邮箱关联，删除用户前先取出邮箱
+		var emails []string
+		if err := tx.Model(&models.User{}).Where("id = ?", id).Pluck("email", &emails).Error; err != nil {
 			return err
 		}
+		if len(emails) > 0 && emails[0] != "" {
+			if err := tx.Where("email = ?", emails[0]).Delete(&models.TaskInvite{}).Error; err != nil {
+				return err
+			}
+		}
 
-		if err := tx.Where("user_id = ?", id).Delete(&models.UserTask{}).Error; err != nil {
-			return err
+		// 以下各表都以 user_id 关联，其中会话与 refresh token 含 IP、UA 与位置，修改邮箱记录含新旧邮箱
+		for _, model := range []any{
+			&models.UserLog{},
+			&models.UserTask{},
+			&models.MFARecoveryCode{},
+			&models.UserMFA{},
+			&models.UserIdentity{},
+			&models.UsageAlert{},
+			&models.EmailChange{},
+			&models.RefreshToken{},
+			&models.Session{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
 		}
 
 		result := tx.Unscoped().Where("id = ?", id).Delete(&models.User{})
@@ -173,6 +231,26 @@ func (r *repository) HardDelete(ctx context.Context, id uint64) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	for _, taskID := range taskIDs {
+		if err := r.keys.SyncTask(ctx, taskID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repository) FindByID(ctx context.Context, id uint64) (*models.User, error) {
+	var u models.User
+	if err := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", id).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
 }
 
 func (r *repository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
@@ -202,14 +280,19 @@ func (r *repository) AddLog(ctx context.Context, log *models.UserLog) error {
 	return r.db.WithContext(ctx).Create(log).Error
 }
 
-func (r *repository) GetLogs(ctx context.Context, userID uint64, limit int) ([]models.UserLog, error) {
+// GetLogs 返回最近的日志，types 不为空时只返回这些类型
+func (r *repository) GetLogs(ctx context.Context, userID uint64, limit int, types ...models.LogType) ([]models.UserLog, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+
 	var logs []models.UserLog
-	err := r.db.WithContext(ctx).
-		Where("user_id = ?", userID).
+	err := query.
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&logs).Error
@@ -217,6 +300,25 @@ func (r *repository) GetLogs(ctx context.Context, userID uint64, limit int) ([]m
 	return logs, err
 }
 
+func (r *repository) ListLogs(ctx context.Context, userID uint64, p *pagination.Params) ([]models.UserLog, error) {
+	var logs []models.UserLog
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Scopes(p.Scope).
+		Find(&logs).Error
+	return logs, err
+}
+
+// AllLogs 返回用户的全部日志，按时间升序，用于导出
+func (r *repository) AllLogs(ctx context.Context, userID uint64) ([]models.UserLog, error) {
+	var logs []models.UserLog
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&logs).Error
+	return logs, err
+}
+
 func (r *repository) AddTask(ctx context.Context, userApp *models.UserTask) error {
 	var count int64
 	err := r.db.WithContext(ctx).
@@ -250,6 +352,19 @@ func (r *repository) GetTasks(ctx context.Context, userID uint64) ([]models.User
 	return tasks, err
 }
 
+// ListMyTasks 返回用户参与的未删除 task 及其角色
+func (r *repository) ListMyTasks(ctx context.Context, userID uint64) ([]MyTask, error) {
+	var tasks []MyTask
+	err := r.db.WithContext(ctx).
+		Table("user_tasks").
+		Select("tasks.id, tasks.name, tasks.key_prefix, tasks.status, user_tasks.role, tasks.created_at").
+		Joins("JOIN tasks ON tasks.id = user_tasks.task_id").
+		Where("user_tasks.user_id = ? AND tasks.deleted_at IS NULL", userID).
+		Order("tasks.created_at DESC").
+		Scan(&tasks).Error
+	return tasks, err
+}
+
 func (r *repository) UpdateLoginTime(ctx context.Context, id uint64) error {
 	now := time.Now()
 	if err := r.db.WithContext(ctx).
@@ -259,41 +374,5 @@ func (r *repository) UpdateLoginTime(ctx context.Context, id uint64) error {
 		return err
 	}
 
-	var user models.User
-	if err := r.db.WithContext(ctx).
-		Select("level", "quota").
-		First(&user, id).Error; err != nil {
-		return err
-	}
-	var taskKeys []string
-	if err := r.db.WithContext(ctx).
-		Model(&models.Task{}).
-		Joins("JOIN user_tasks ON user_tasks.task_id = tasks.id").
-		Where("user_tasks.user_id = ?", id).
-		Pluck("tasks.task_key", &taskKeys).Error; err != nil {
-		return err
-	}
-
-	if len(taskKeys) == 0 {
-		return nil
-	}
-
-	cacheData := models.ApiCache{
-		UserLevel: models.Level(user.Level),
-		Quota:     user.Quota,
-	}
-	cacheBytes, err := json.Marshal(cacheData)
-	if err != nil {
-		return err
-	}
-	cacheStr := string(cacheBytes)
-
-	pipe := r.rdb.Pipeline()
-	for _, key := range taskKeys {
-		redisKey := fmt.Sprintf("apiKey:%s", key)
-		pipe.Set(ctx, redisKey, cacheStr, 0)
-	}
-
-	_, err = pipe.Exec(ctx)
-	return err
+	return r.keys.SyncUser(ctx, id)
 }
@@ -1,16 +1,20 @@
 package user
 
 import (
+	"asum/pkg/engine"
+
 	"github.com/gofiber/fiber/v3"
 )
 
 func RegisterRoutes(r fiber.Router, h *Handler) {
 	user := r.Group("/user")
 	{
-		user.Get("/", h.ListUser)
-		user.Post("/", h.CreateUser)
-		user.Patch("/:id", h.UpdateUser)
-		user.Delete("/:id", h.DeleteUser)
-		user.Get("/:id", h.GetUser)
+		me := user.Group("/me")
+		me.Get("/", engine.H(h.GetMe))
+		me.Patch("/", engine.H(h.UpdateMe))
+		me.Put("/password", engine.H(h.ChangePassword))
+		me.Get("/logins", engine.H(h.ListLogins))
+		me.Get("/logs", engine.H(h.ListLogs))
+		me.Get("/tasks", engine.H(h.ListMyTasks))
 	}
 }
@@ -1,6 +1,19 @@
 package user
 
+import (
+	"asum/pkg/models"
+	"asum/pkg/pagination"
+	"asum/pkg/utils"
+	"context"
+)
+
 type Service interface {
+	Profile(c context.Context, userID uint64) (*Profile, error)
+	UpdateProfile(c context.Context, userID uint64, req *UpdateProfileReq) (*Profile, error)
+	ChangePassword(c context.Context, userID uint64, req *ChangePasswordReq) error
+	LoginHistory(c context.Context, userID uint64) ([]models.UserLog, error)
+	ListLogs(c context.Context, userID uint64, p *pagination.Params) (*pagination.Page[models.UserLog], error)
+	ListTasks(c context.Context, userID uint64) ([]MyTask, error)
 }
 
 type service struct {
@@ -10,3 +23,78 @@ type service struct {
 func NewService(repo Repository) Service {
 	return &service{repo: repo}
 }
+
+func (s *service) Profile(c context.Context, userID uint64) (*Profile, error) {
+	u, err := s.repo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newProfile(u), nil
+}
+
+func (s *service) UpdateProfile(c context.Context, userID uint64, req *UpdateProfileReq) (*Profile, error) {
+	if err := utils.ValidateName(req.Name); err != nil {
+		return nil, err
+	}
+	u, err := s.repo.FindByID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	u.Name = utils.SanitizeName(req.Name)
+	if err := s.repo.Update(c, u); err != nil {
+		return nil, err
+	}
+	return newProfile(u), nil
+}
+
+// ChangePassword 需校验当前密码，成功后记录日志
+func (s *service) ChangePassword(c context.Context, userID uint64, req *ChangePasswordReq) error {
+	u, err := s.repo.FindByID(c, userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPassword(req.CurrentPassword, u.Password) {
+		return ErrWrongPassword
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return ErrSamePassword
+	}
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		return err
+	}
+
+	hashed, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	u.Password = hashed
+	if err := s.repo.Update(c, u); err != nil {
+		return err
+	}
+
+	_ = s.repo.AddLog(c, &models.UserLog{
+		UserID:    userID,
+		Type:      models.LogTypeChangePassword,
+		IP:        utils.GetRemoteIP(c),
+		UserAgent: utils.GetUserAgent(c),
+	})
+	return nil
+}
+
+func (s *service) LoginHistory(c context.Context, userID uint64) ([]models.UserLog, error) {
+	return s.repo.GetLogs(c, userID, loginHistoryLimit, models.LogTypeLogin)
+}
+
+func (s *service) ListLogs(c context.Context, userID uint64, p *pagination.Params) (*pagination.Page[models.UserLog], error) {
+	logs, err := s.repo.ListLogs(c, userID, p)
+	if err != nil {
+		return nil, err
+	}
+	return pagination.Cut(p, logs, func(l *models.UserLog) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: l.CreatedAt, ID: l.ID}
+	}), nil
+}
+
+func (s *service) ListTasks(c context.Context, userID uint64) ([]MyTask, error) {
+	return s.repo.ListMyTasks(c, userID)
+}
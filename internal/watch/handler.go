@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{service: svc}
+}
+
+type WatchReq struct {
+	Name string `json:"name"`
+	// Targets 为 IP 或 CIDR，CIDR 按 IP 库的网段边界切分后每段解析一个地址，最多 256 段
+	Targets []string `json:"targets"`
+	// Fields 可选 country、asn、anonymous
+	Fields []string `json:"fields"`
+	// Schedule 为 5 段 cron 表达式（UTC），为空时只在 IP 库更新后解析
+	Schedule string `json:"schedule"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func parseIDs(c *engine.Ctx) (taskID, itemID uint64, err error) {
+	taskID, err = strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if raw := c.Params("itemId"); raw != "" {
+		itemID, err = strconv.ParseUint(raw, 10, 64)
+	}
+	return taskID, itemID, err
+}
+
+// ListWatch 查看任务的 IP 监控项
+// @Summary 查看 IP 监控项
+// @Tags Watch
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response{data=[]models.TaskItem} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id}/watch [get]
+func (h *Handler) ListWatch(c *engine.Ctx) error {
+	taskID, _, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.List(c.StdCtx, taskID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// CreateWatch 新增 IP 监控项
+// @Summary 新增 IP 监控项
+// @Description 按 cron 或在 IP 库更新后重新解析目标 IP/CIDR，关注的属性变化时通知任务成员。
+// @Tags Watch
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body WatchReq true "监控项"
+// @Success 200 {object} engine.Response{data=models.TaskItem} "创建成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或监控项无效)"
+// @Router /app/task/{id}/watch [post]
+func (h *Handler) CreateWatch(c *engine.Ctx) error {
+	taskID, _, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req WatchReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Create(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateWatch 修改 IP 监控项
+// @Summary 修改 IP 监控项
+// @Description 修改后会尽快重新解析一次。
+// @Tags Watch
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param itemId path int true "监控项 ID"
+// @Param request body WatchReq true "监控项"
+// @Success 200 {object} engine.Response{data=models.TaskItem} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或监控项无效)"
+// @Router /app/task/{id}/watch/{itemId} [put]
+func (h *Handler) UpdateWatch(c *engine.Ctx) error {
+	taskID, itemID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req WatchReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Update(c.StdCtx, taskID, itemID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// DeleteWatch 删除 IP 监控项
+// @Summary 删除 IP 监控项
+// @Tags Watch
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param itemId path int true "监控项 ID"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或监控项不存在)"
+// @Router /app/task/{id}/watch/{itemId} [delete]
+func (h *Handler) DeleteWatch(c *engine.Ctx) error {
+	taskID, itemID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.Delete(c.StdCtx, taskID, itemID, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// ListSnapshots 查看监控项的解析快照
+// @Summary 查看监控项快照
+// @Description 只在属性变化时保存新快照，返回最近 100 条。
+// @Tags Watch
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param itemId path int true "监控项 ID"
+// @Success 200 {object} engine.Response{data=[]models.WatchSnapshot} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或监控项不存在)"
+// @Router /app/task/{id}/watch/{itemId}/snapshots [get]
+func (h *Handler) ListSnapshots(c *engine.Ctx) error {
+	taskID, itemID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Snapshots(c.StdCtx, taskID, itemID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
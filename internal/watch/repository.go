@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(ctx context.Context, item *models.TaskItem) error
+	Update(ctx context.Context, item *models.TaskItem) error
+	Delete(ctx context.Context, taskID, id uint64) error
+	FindByID(ctx context.Context, taskID, id uint64) (*models.TaskItem, error)
+	ListByTask(ctx context.Context, taskID uint64) ([]models.TaskItem, error)
+
+	Due(ctx context.Context, now time.Time, build uint64) ([]models.TaskItem, error)
+	SaveRun(ctx context.Context, item *models.TaskItem) error
+
+	LatestSnapshots(ctx context.Context, itemID uint64) (map[string]models.WatchSnapshot, error)
+	AddSnapshots(ctx context.Context, snaps []models.WatchSnapshot) error
+	ListSnapshots(ctx context.Context, itemID uint64, limit int) ([]models.WatchSnapshot, error)
+}
+
+type repository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	if err := db.AutoMigrate(&models.TaskItem{}, &models.WatchSnapshot{}); err != nil {
+		panic(err)
+	}
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, item *models.TaskItem) error {
+	return r.db.WithContext(ctx).Create(item).Error
+}
+
+func (r *repository) Update(ctx context.Context, item *models.TaskItem) error {
+	return r.db.WithContext(ctx).
+		Model(item).
+		Select("name", "targets", "fields", "schedule", "enabled", "next_run_at", "updated_at").
+		Updates(item).Error
+}
+
+func (r *repository) Delete(ctx context.Context, taskID, id uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND task_id = ? AND task_type = ?", id, taskID, models.TaskItemWatch).
+			Delete(&models.TaskItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrWatchNotFound
+		}
+		return tx.Where("item_id = ?", id).Delete(&models.WatchSnapshot{}).Error
+	})
+}
+
+func (r *repository) FindByID(ctx context.Context, taskID, id uint64) (*models.TaskItem, error) {
+	var item models.TaskItem
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND task_id = ? AND task_type = ?", id, taskID, models.TaskItemWatch).
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrWatchNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *repository) ListByTask(ctx context.Context, taskID uint64) ([]models.TaskItem, error) {
+	var items []models.TaskItem
+	err := r.db.WithContext(ctx).
+		Where("task_id = ? AND task_type = ?", taskID, models.TaskItemWatch).
+		Order("id ASC").
+		Find(&items).Error
+	return items, err
+}
+
+// Due 返回到期或尚未使用当前 IP 库解析过的监控项，已停用或删除的 task 不再解析
+func (r *repository) Due(ctx context.Context, now time.Time, build uint64) ([]models.TaskItem, error) {
+	var items []models.TaskItem
+	err := r.db.WithContext(ctx).
+		Model(&models.TaskItem{}).
+		Select("task_items.*").
+		Joins("JOIN tasks ON tasks.id = task_items.task_id").
+		Where("task_items.task_type = ? AND task_items.enabled = ?", models.TaskItemWatch, true).
+		Where("tasks.status = ? AND tasks.deleted_at IS NULL", models.StatusEnabled).
+		Where("(task_items.next_run_at <= ? OR task_items.db_build <> ?)", now, build).
+		Order("task_items.id ASC").
+		Find(&items).Error
+	return items, err
+}
+
+func (r *repository) SaveRun(ctx context.Context, item *models.TaskItem) error {
+	return r.db.WithContext(ctx).
+		Model(&models.TaskItem{}).
+		Where("id = ?", item.ID).
+		Updates(map[string]any{
+			"db_build":    item.DBBuild,
+			"last_run_at": item.LastRunAt,
+			"next_run_at": item.NextRunAt,
+		}).Error
+}
+
+// LatestSnapshots 返回监控项各地址最近一次的快照
+func (r *repository) LatestSnapshots(ctx context.Context, itemID uint64) (map[string]models.WatchSnapshot, error) {
+	var snaps []models.WatchSnapshot
+	err := r.db.WithContext(ctx).
+		Raw(`SELECT DISTINCT ON (ip) * FROM watch_snapshots WHERE item_id = ? ORDER BY ip, id DESC`, itemID).
+		Scan(&snaps).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]models.WatchSnapshot, len(snaps))
+	for _, s := range snaps {
+		out[s.IP] = s
+	}
+	return out, nil
+}
+
+func (r *repository) AddSnapshots(ctx context.Context, snaps []models.WatchSnapshot) error {
+	if len(snaps) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&snaps).Error
+}
+
+func (r *repository) ListSnapshots(ctx context.Context, itemID uint64, limit int) ([]models.WatchSnapshot, error) {
+	var snaps []models.WatchSnapshot
+	err := r.db.WithContext(ctx).
+		Where("item_id = ?", itemID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&snaps).Error
+	return snaps, err
+}
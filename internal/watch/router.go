@@ -0,0 +1,18 @@
+package watch
+
+import (
+	"asum/pkg/engine"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler) {
+	watch := r.Group("/task/:id/watch")
+	{
+		watch.Get("/", engine.H(h.ListWatch))
+		watch.Post("/", engine.H(h.CreateWatch))
+		watch.Put("/:itemId", engine.H(h.UpdateWatch))
+		watch.Delete("/:itemId", engine.H(h.DeleteWatch))
+		watch.Get("/:itemId/snapshots", engine.H(h.ListSnapshots))
+	}
+}
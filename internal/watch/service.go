@@ -0,0 +1,433 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"asum/internal/ip2"
+	"asum/internal/notify"
+	"asum/internal/task"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/maxmind"
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+	"asum/pkg/schedule"
+	"asum/pkg/webhook"
+)
+
+type Service interface {
+	List(c context.Context, taskID, userID uint64) ([]models.TaskItem, error)
+	Create(c context.Context, taskID, userID uint64, req *WatchReq) (*models.TaskItem, error)
+	Update(c context.Context, taskID, id, userID uint64, req *WatchReq) (*models.TaskItem, error)
+	Delete(c context.Context, taskID, id, userID uint64) error
+	Snapshots(c context.Context, taskID, id, userID uint64) ([]models.WatchSnapshot, error)
+	RunScheduler(ctx context.Context, interval time.Duration) error
+}
+
+const (
+	maxTargets     = 64
+	maxItemsOfTask = 20
+	snapshotLimit  = 100
+	// maxNetworksPerTarget 为单个 CIDR 目标在 IP 库中最多覆盖的网段数，每段每次解析一个地址
+	maxNetworksPerTarget = 256
+	// runLockTTL 多实例同时调度时同一监控项只由一个实例解析
+	runLockTTL = 5 * time.Minute
+)
+
+type service struct {
+	repo     Repository
+	taskRepo task.Repository
+	lookup   ip2.Repository
+	mm       *maxmind.DB
+	cache    *rdb.Client
+	hooks    *webhook.Dispatcher
+}
+
+func NewService(repo Repository, taskRepo task.Repository, lookup ip2.Repository, mm *maxmind.DB, cache *rdb.Client, hooks *webhook.Dispatcher) Service {
+	return &service{
+		repo:     repo,
+		taskRepo: taskRepo,
+		lookup:   lookup,
+		mm:       mm,
+		cache:    cache,
+		hooks:    hooks,
+	}
+}
+
+func (s *service) authorize(c context.Context, taskID, userID uint64, perm models.TaskPerm) error {
+	m, err := s.taskRepo.GetMember(c, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if !m.Role.Can(perm) {
+		return errorx.ErrTaskForbidden
+	}
+	return nil
+}
+
+func (s *service) List(c context.Context, taskID, userID uint64) ([]models.TaskItem, error) {
+	if err := s.authorize(c, taskID, userID, models.PermViewUsage); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByTask(c, taskID)
+}
+
+func (s *service) Create(c context.Context, taskID, userID uint64, req *WatchReq) (*models.TaskItem, error) {
+	if err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.ListByTask(c, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) >= maxItemsOfTask {
+		return nil, errorx.ErrInvalidWatch
+	}
+
+	item := &models.TaskItem{
+		TaskID:   taskID,
+		TaskType: models.TaskItemWatch,
+		Enabled:  true,
+	}
+	if err := req.apply(item); err != nil {
+		return nil, err
+	}
+	if err := s.checkTargets(item.Targets); err != nil {
+		return nil, err
+	}
+	// 新建后尽快解析一次作为基线
+	now := time.Now()
+	item.NextRunAt = &now
+	if err := s.repo.Create(c, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *service) Update(c context.Context, taskID, id, userID uint64, req *WatchReq) (*models.TaskItem, error) {
+	if err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return nil, err
+	}
+	item, err := s.repo.FindByID(c, taskID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.apply(item); err != nil {
+		return nil, err
+	}
+	if err := s.checkTargets(item.Targets); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	item.NextRunAt = &now
+	if err := s.repo.Update(c, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *service) Delete(c context.Context, taskID, id, userID uint64) error {
+	if err := s.authorize(c, taskID, userID, models.PermManageKeys); err != nil {
+		return err
+	}
+	return s.repo.Delete(c, taskID, id)
+}
+
+func (s *service) Snapshots(c context.Context, taskID, id, userID uint64) ([]models.WatchSnapshot, error) {
+	if err := s.authorize(c, taskID, userID, models.PermViewUsage); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindByID(c, taskID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSnapshots(c, id, snapshotLimit)
+}
+
+// apply 校验并规范化请求：单个 IP 原样保留，CIDR 转为网络地址形式
+func (req *WatchReq) apply(item *models.TaskItem) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return errorx.ErrInvalidWatch
+	}
+	if len(req.Targets) == 0 || len(req.Targets) > maxTargets || len(req.Fields) == 0 {
+		return errorx.ErrInvalidWatch
+	}
+
+	targets := make([]string, 0, len(req.Targets))
+	for _, t := range req.Targets {
+		t = strings.TrimSpace(t)
+		if ip := net.ParseIP(t); ip != nil {
+			t = ip.String()
+		} else if _, network, err := net.ParseCIDR(t); err == nil {
+			t = network.String()
+		} else {
+			return errorx.ErrInvalidWatch
+		}
+		if !slices.Contains(targets, t) {
+			targets = append(targets, t)
+		}
+	}
+
+	fields := make([]string, 0, len(req.Fields))
+	for _, f := range req.Fields {
+		if !slices.Contains(models.WatchFields, f) {
+			return errorx.ErrInvalidWatch
+		}
+		if !slices.Contains(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+
+	sched := strings.TrimSpace(req.Schedule)
+	if sched != "" {
+		if _, err := schedule.Parse(sched); err != nil {
+			return errorx.ErrInvalidWatch
+		}
+	}
+
+	item.Name = name
+	item.Targets = targets
+	item.Fields = fields
+	item.Schedule = sched
+	if req.Enabled != nil {
+		item.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// RunScheduler 定期解析到期的监控项；IP 库更新（构建时间变化）后全部监控项都会重新解析一次
+func (s *service) RunScheduler(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		build := s.mm.BuildEpoch()
+		items, err := s.repo.Due(ctx, time.Now(), build)
+		if err != nil {
+			logx.Errorf("list due watch items: %v", err)
+			continue
+		}
+		for i := range items {
+			if err := s.run(ctx, &items[i], build); err != nil {
+				logx.Errorf("run watch item %d: %v", items[i].ID, err)
+			}
+		}
+	}
+}
+
+type WatchChange struct {
+	IP    string `json:"ip"`
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type WatchEvent struct {
+	Type     string        `json:"type"`
+	TaskID   uint64        `json:"taskId"`
+	ItemID   uint64        `json:"itemId"`
+	ItemName string        `json:"itemName"`
+	Changes  []WatchChange `json:"changes"`
+}
+
+func (s *service) run(ctx context.Context, item *models.TaskItem, build uint64) error {
+	lockKey := fmt.Sprintf("watch:lock:%d", item.ID)
+	ok, err := s.cache.SetNX(ctx, lockKey, 1, runLockTTL).Result()
+	if err != nil || !ok {
+		return err
+	}
+	defer s.cache.Del(ctx, lockKey)
+
+	prev, err := s.repo.LatestSnapshots(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+
+	var snaps []models.WatchSnapshot
+	var changes []WatchChange
+	for _, target := range item.Targets {
+		addrs, err := s.addresses(target)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			ip := net.IP(addr.AsSlice())
+			data, err := s.lookup.Lookup(ctx, ip, "en")
+			if err != nil {
+				return err
+			}
+			values := watchValues(data)
+
+			old, seen := prev[ip.String()]
+			if seen && maps.Equal(old.Values, values) {
+				continue
+			}
+			if !seen {
+				// IP 库拆分网段后新出现的段，与拆分前代表它的地址比较
+				old, seen = covering(prev, target, addr)
+			}
+			snaps = append(snaps, models.WatchSnapshot{
+				ItemID:  item.ID,
+				IP:      ip.String(),
+				Values:  values,
+				DBBuild: build,
+			})
+			// 首次解析只保存基线
+			if !seen {
+				continue
+			}
+			for _, f := range item.Fields {
+				if old.Values[f] != values[f] {
+					changes = append(changes, WatchChange{IP: ip.String(), Field: f, From: old.Values[f], To: values[f]})
+				}
+			}
+		}
+	}
+	if err := s.repo.AddSnapshots(ctx, snaps); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	item.LastRunAt = &now
+	item.DBBuild = build
+	item.NextRunAt = nil
+	if item.Schedule != "" {
+		if sched, err := schedule.Parse(item.Schedule); err == nil {
+			if next := sched.Next(now.UTC()); !next.IsZero() {
+				item.NextRunAt = &next
+			}
+		}
+	}
+	if err := s.repo.SaveRun(ctx, item); err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		s.notifyMembers(ctx, item, changes)
+		if err := s.hooks.Publish(ctx, item.TaskID, models.EventWatchChanged, &webhook.WatchChangedData{
+			ItemID:   item.ID,
+			ItemName: item.Name,
+			Changes:  changes,
+		}); err != nil {
+			logx.Errorf("publish watch webhook %d: %v", item.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *service) notifyMembers(ctx context.Context, item *models.TaskItem, changes []WatchChange) {
+	members, err := s.taskRepo.ListMembers(ctx, item.TaskID)
+	if err != nil {
+		logx.Errorf("list members of task %d: %v", item.TaskID, err)
+		return
+	}
+	ev := WatchEvent{
+		Type:     "watch_change",
+		TaskID:   item.TaskID,
+		ItemID:   item.ID,
+		ItemName: item.Name,
+		Changes:  changes,
+	}
+	for _, m := range members {
+		if _, err := notify.IncUnread(ctx, s.cache, m.UserID, 1); err != nil {
+			logx.Errorf("inc unread %d: %v", m.UserID, err)
+		}
+		if err := notify.PublishUser(ctx, s.cache, notify.StreamKeyDefault, m.UserID, ev); err != nil {
+			logx.Errorf("publish watch change %d: %v", item.ID, err)
+		}
+	}
+}
+
+// checkTargets 确认每个 CIDR 目标覆盖的网段数不超过 maxNetworksPerTarget
+func (s *service) checkTargets(targets []string) error {
+	for _, t := range targets {
+		if _, err := s.addresses(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addresses 返回监控目标需要解析的地址：单个 IP 为其本身；CIDR 按 IP 库的网段边界切分，
+// 每段解析首地址，网段内任意位置的变化都能发现
+func (s *service) addresses(target string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return nil, errorx.ErrInvalidWatch
+	}
+	addrs, err := s.mm.Networks(prefix, maxNetworksPerTarget)
+	if errors.Is(err, maxmind.ErrTooManyNetworks) {
+		return nil, errorx.ErrWatchTooBroad
+	}
+	return addrs, err
+}
+
+// covering 返回 target 内不晚于 addr 的最近一个地址的快照，即此前代表 addr 所在网段的快照
+func covering(prev map[string]models.WatchSnapshot, target string, addr netip.Addr) (models.WatchSnapshot, bool) {
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return models.WatchSnapshot{}, false
+	}
+	var (
+		best  models.WatchSnapshot
+		bestA netip.Addr
+		found bool
+	)
+	for ip, snap := range prev {
+		a, err := netip.ParseAddr(ip)
+		if err != nil || !prefix.Contains(a) || addr.Less(a) {
+			continue
+		}
+		if !found || bestA.Less(a) {
+			best, bestA, found = snap, a, true
+		}
+	}
+	return best, found
+}
+
+// watchValues 提取可监控的属性，始终保存全部属性，便于之后新增关注字段时比较
+func watchValues(data *ip2.GetIP) map[string]string {
+	values := map[string]string{
+		models.WatchCountry:   "",
+		models.WatchASN:       "",
+		models.WatchAnonymous: "",
+	}
+	if data.Country != nil && data.Country.Iso2 != nil {
+		values[models.WatchCountry] = *data.Country.Iso2
+	}
+	if data.Asn != nil && data.Asn.Number != nil {
+		asn := fmt.Sprintf("AS%d", *data.Asn.Number)
+		if data.Asn.Org != nil && *data.Asn.Org != "" {
+			asn += " " + *data.Asn.Org
+		}
+		values[models.WatchASN] = asn
+	}
+	if data.Traits != nil {
+		var flags []string
+		if data.Traits.IsAnonymousProxy != nil && *data.Traits.IsAnonymousProxy {
+			flags = append(flags, "anonymous_proxy")
+		}
+		if data.Traits.IsSatelliteProvider != nil && *data.Traits.IsSatelliteProvider {
+			flags = append(flags, "satellite_provider")
+		}
+		values[models.WatchAnonymous] = strings.Join(flags, ",")
+	}
+	return values
+}
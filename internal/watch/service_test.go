@@ -0,0 +1,30 @@
+package watch
+
+import (
+	"net/netip"
+	"testing"
+
+	"asum/pkg/models"
+)
+
+func TestCovering(t *testing.T) {
+	prev := map[string]models.WatchSnapshot{
+		"10.0.0.0":   {IP: "10.0.0.0"},
+		"10.0.0.128": {IP: "10.0.0.128"},
+		"10.0.1.0":   {IP: "10.0.1.0"},
+		"192.0.2.1":  {IP: "192.0.2.1"},
+	}
+	for addr, want := range map[string]string{
+		"10.0.0.64":  "10.0.0.0",
+		"10.0.0.192": "10.0.0.128",
+		"10.0.0.128": "10.0.0.128",
+	} {
+		snap, ok := covering(prev, "10.0.0.0/24", netip.MustParseAddr(addr))
+		if !ok || snap.IP != want {
+			t.Errorf("covering(%s) = %q, %v, want %q", addr, snap.IP, ok, want)
+		}
+	}
+	if snap, ok := covering(prev, "10.0.2.0/24", netip.MustParseAddr("10.0.2.5")); ok {
+		t.Errorf("covering outside of prev = %q, want none", snap.IP)
+	}
+}
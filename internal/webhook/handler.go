@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{service: svc}
+}
+
+type WebhookReq struct {
+	// URL 为 http(s) 地址，接收 POST 的 JSON 事件
+	URL string `json:"url"`
+	// Events 可选 key.rotated、quota.low、bulk.finished、watch.changed、member.joined
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type CreateWebhookResp struct {
+	models.TaskWebhook
+	// Secret 用于校验 X-Asum-Signature，只在创建时返回
+	Secret string `json:"secret"`
+}
+
+func parseIDs(c *engine.Ctx) (taskID, hookID uint64, err error) {
+	taskID, err = strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if raw := c.Params("hookId"); raw != "" {
+		hookID, err = strconv.ParseUint(raw, 10, 64)
+	}
+	return taskID, hookID, err
+}
+
+// ListWebhook 查看任务的 webhook
+// @Summary 查看 webhook
+// @Tags Webhook
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Success 200 {object} engine.Response{data=[]models.TaskWebhook} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务)"
+// @Router /app/task/{id}/webhooks [get]
+func (h *Handler) ListWebhook(c *engine.Ctx) error {
+	taskID, _, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.List(c.StdCtx, taskID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// CreateWebhook 新增 webhook
+// @Summary 新增 webhook
+// @Description 事件以 POST JSON 推送，X-Asum-Signature 为 HMAC-SHA256("<X-Asum-Timestamp>.<body>")；非 2xx 响应按指数退避重试。
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param request body WebhookReq true "webhook"
+// @Success 200 {object} engine.Response{data=CreateWebhookResp} "创建成功，secret 只返回一次"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或 webhook 无效)"
+// @Router /app/task/{id}/webhooks [post]
+func (h *Handler) CreateWebhook(c *engine.Ctx) error {
+	taskID, _, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req WebhookReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Create(c.StdCtx, taskID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// UpdateWebhook 修改 webhook
+// @Summary 修改 webhook
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param hookId path int true "webhook ID"
+// @Param request body WebhookReq true "webhook"
+// @Success 200 {object} engine.Response{data=models.TaskWebhook} "修改成功"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或 webhook 无效)"
+// @Router /app/task/{id}/webhooks/{hookId} [put]
+func (h *Handler) UpdateWebhook(c *engine.Ctx) error {
+	taskID, hookID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	var req WebhookReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Update(c.StdCtx, taskID, hookID, utils.GetUserID(c), &req)
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// DeleteWebhook 删除 webhook
+// @Summary 删除 webhook
+// @Description 同时删除其投递记录。
+// @Tags Webhook
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param hookId path int true "webhook ID"
+// @Success 200 {object} engine.Response "删除成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或 webhook 不存在)"
+// @Router /app/task/{id}/webhooks/{hookId} [delete]
+func (h *Handler) DeleteWebhook(c *engine.Ctx) error {
+	taskID, hookID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	if err := h.service.Delete(c.StdCtx, taskID, hookID, utils.GetUserID(c)); err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(nil)
+}
+
+// ListDeliveries 查看 webhook 投递记录
+// @Summary 查看投递记录
+// @Description 返回最近 100 条，含尝试次数与最近一次响应码。
+// @Tags Webhook
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param hookId path int true "webhook ID"
+// @Success 200 {object} engine.Response{data=[]models.WebhookDelivery} "查询成功"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或 webhook 不存在)"
+// @Router /app/task/{id}/webhooks/{hookId}/deliveries [get]
+func (h *Handler) ListDeliveries(c *engine.Ctx) error {
+	taskID, hookID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Deliveries(c.StdCtx, taskID, hookID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
+
+// ReplayDelivery 重放投递
+// @Summary 重放投递
+// @Description 以原请求体生成一条新的投递并立即入队，replayOf 指向原记录。
+// @Tags Webhook
+// @Produce json
+// @Security Bearer
+// @Param id path int true "任务 ID"
+// @Param hookId path int true "webhook ID"
+// @Param deliveryId path int true "投递 ID"
+// @Success 200 {object} engine.Response{data=models.WebhookDelivery} "已入队"
+// @Failure 400 {object} engine.Response "参数错误"
+// @Failure 401 {object} engine.Response "未授权 (Token 缺失或无效)"
+// @Failure 403 {object} engine.Response "禁止操作 (无权操作此任务或投递记录不存在)"
+// @Router /app/task/{id}/webhooks/{hookId}/deliveries/{deliveryId}/replay [post]
+func (h *Handler) ReplayDelivery(c *engine.Ctx) error {
+	taskID, hookID, err := parseIDs(c)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+	deliveryID, err := strconv.ParseUint(c.Params("deliveryId"), 10, 64)
+	if err != nil {
+		return c.Fail(fiber.StatusBadRequest, errorx.ErrInvalidRequestBody)
+	}
+
+	data, err := h.service.Replay(c.StdCtx, taskID, hookID, deliveryID, utils.GetUserID(c))
+	if err != nil {
+		return c.Fail(fiber.StatusForbidden, err.Error())
+	}
+	return c.OK(data)
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+type Repository interface {
+	Create(ctx context.Context, hook *models.TaskWebhook) error
+	Update(ctx context.Context, hook *models.TaskWebhook) error
+	Delete(ctx context.Context, taskID, id uint64) error
+	FindByID(ctx context.Context, taskID, id uint64) (*models.TaskWebhook, error)
+	ListByTask(ctx context.Context, taskID uint64) ([]models.TaskWebhook, error)
+
+	ListDeliveries(ctx context.Context, hookID uint64, limit int) ([]models.WebhookDelivery, error)
+	FindDelivery(ctx context.Context, hookID, id uint64) (*models.WebhookDelivery, error)
+}
+
+type repository struct {
+	db *db.DB
+}
+
+func NewRepository(db *db.DB) Repository {
+	if err := db.AutoMigrate(&models.TaskWebhook{}, &models.WebhookDelivery{}); err != nil {
+		panic(err)
+	}
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, hook *models.TaskWebhook) error {
+	return r.db.WithContext(ctx).Create(hook).Error
+}
+
+func (r *repository) Update(ctx context.Context, hook *models.TaskWebhook) error {
+	return r.db.WithContext(ctx).
+		Model(hook).
+		Select("url", "events", "enabled", "updated_at").
+		Updates(hook).Error
+}
+
+func (r *repository) Delete(ctx context.Context, taskID, id uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND task_id = ?", id, taskID).Delete(&models.TaskWebhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorx.ErrWebhookNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+func (r *repository) FindByID(ctx context.Context, taskID, id uint64) (*models.TaskWebhook, error) {
+	var hook models.TaskWebhook
+	err := r.db.WithContext(ctx).Where("id = ? AND task_id = ?", id, taskID).First(&hook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (r *repository) ListByTask(ctx context.Context, taskID uint64) ([]models.TaskWebhook, error) {
+	var hooks []models.TaskWebhook
+	err := r.db.WithContext(ctx).
+		Where("task_id = ?", taskID).
+		Order("id ASC").
+		Find(&hooks).Error
+	return hooks, err
+}
+
+func (r *repository) ListDeliveries(ctx context.Context, hookID uint64, limit int) ([]models.WebhookDelivery, error) {
+	var list []models.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("webhook_id = ?", hookID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *repository) FindDelivery(ctx context.Context, hookID, id uint64) (*models.WebhookDelivery, error) {
+	var dl models.WebhookDelivery
+	err := r.db.WithContext(ctx).Where("id = ? AND webhook_id = ?", id, hookID).First(&dl).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errorx.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
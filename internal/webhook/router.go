@@ -0,0 +1,19 @@
+package webhook
+
+import (
+	"asum/pkg/engine"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func RegisterRoutes(r fiber.Router, h *Handler) {
+	hooks := r.Group("/task/:id/webhooks")
+	{
+		hooks.Get("/", engine.H(h.ListWebhook))
+		hooks.Post("/", engine.H(h.CreateWebhook))
+		hooks.Put("/:hookId", engine.H(h.UpdateWebhook))
+		hooks.Delete("/:hookId", engine.H(h.DeleteWebhook))
+		hooks.Get("/:hookId/deliveries", engine.H(h.ListDeliveries))
+		hooks.Post("/:hookId/deliveries/:deliveryId/replay", engine.H(h.ReplayDelivery))
+	}
+}
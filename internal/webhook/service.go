@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"asum/internal/task"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/utils"
+	hook "asum/pkg/webhook"
+)
+
+type Service interface {
+	List(c context.Context, taskID, userID uint64) ([]models.TaskWebhook, error)
+	Create(c context.Context, taskID, userID uint64, req *WebhookReq) (*CreateWebhookResp, error)
+	Update(c context.Context, taskID, id, userID uint64, req *WebhookReq) (*models.TaskWebhook, error)
+	Delete(c context.Context, taskID, id, userID uint64) error
+	Deliveries(c context.Context, taskID, id, userID uint64) ([]models.WebhookDelivery, error)
+	Replay(c context.Context, taskID, id, deliveryID, userID uint64) (*models.WebhookDelivery, error)
+}
+
+const (
+	maxHooksOfTask = 10
+	deliveryLimit  = 100
+)
+
+type service struct {
+	repo       Repository
+	taskRepo   task.Repository
+	dispatcher *hook.Dispatcher
+}
+
+func NewService(repo Repository, taskRepo task.Repository, dispatcher *hook.Dispatcher) Service {
+	return &service{
+		repo:       repo,
+		taskRepo:   taskRepo,
+		dispatcher: dispatcher,
+	}
+}
+
+// authorize webhook 含签名密钥，查看与修改都需要管理 key 的权限
+func (s *service) authorize(c context.Context, taskID, userID uint64) error {
+	m, err := s.taskRepo.GetMember(c, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if !m.Role.Can(models.PermManageKeys) {
+		return errorx.ErrTaskForbidden
+	}
+	return nil
+}
+
+func (s *service) List(c context.Context, taskID, userID uint64) ([]models.TaskWebhook, error) {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByTask(c, taskID)
+}
+
+func (s *service) Create(c context.Context, taskID, userID uint64, req *WebhookReq) (*CreateWebhookResp, error) {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return nil, err
+	}
+	hooks, err := s.repo.ListByTask(c, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if len(hooks) >= maxHooksOfTask {
+		return nil, errorx.ErrInvalidWebhook
+	}
+
+	h := &models.TaskWebhook{
+		TaskID:  taskID,
+		Secret:  "whsec_" + utils.GenerateRandomKey(24),
+		Enabled: true,
+	}
+	if err := req.apply(c, h); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(c, h); err != nil {
+		return nil, err
+	}
+	return &CreateWebhookResp{TaskWebhook: *h, Secret: h.Secret}, nil
+}
+
+func (s *service) Update(c context.Context, taskID, id, userID uint64, req *WebhookReq) (*models.TaskWebhook, error) {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return nil, err
+	}
+	h, err := s.repo.FindByID(c, taskID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.apply(c, h); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(c, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (s *service) Delete(c context.Context, taskID, id, userID uint64) error {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return err
+	}
+	return s.repo.Delete(c, taskID, id)
+}
+
+func (s *service) Deliveries(c context.Context, taskID, id, userID uint64) ([]models.WebhookDelivery, error) {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindByID(c, taskID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(c, id, deliveryLimit)
+}
+
+// Replay 手动重放一条投递，按原内容生成新的投递记录
+func (s *service) Replay(c context.Context, taskID, id, deliveryID, userID uint64) (*models.WebhookDelivery, error) {
+	if err := s.authorize(c, taskID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindByID(c, taskID, id); err != nil {
+		return nil, err
+	}
+	dl, err := s.repo.FindDelivery(c, id, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return s.dispatcher.Replay(c, dl)
+}
+
+// apply 校验并写入请求，URL 的域名须解析到公网地址
+func (req *WebhookReq) apply(c context.Context, h *models.TaskWebhook) error {
+	raw := strings.TrimSpace(req.URL)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > 500 {
+		return errorx.ErrInvalidWebhook
+	}
+	if err := hook.CheckURL(c, raw); err != nil {
+		if errors.Is(err, hook.ErrPrivateAddress) {
+			return errorx.ErrWebhookPrivate
+		}
+		return errorx.ErrInvalidWebhook
+	}
+	if len(req.Events) == 0 {
+		return errorx.ErrInvalidWebhook
+	}
+	events := make([]string, 0, len(req.Events))
+	for _, e := range req.Events {
+		if !slices.Contains(models.WebhookEvents, e) {
+			return errorx.ErrInvalidWebhook
+		}
+		if !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+
+	h.URL = raw
+	h.Events = events
+	if req.Enabled != nil {
+		h.Enabled = *req.Enabled
+	}
+	return nil
+}
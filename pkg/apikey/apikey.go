@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"asum/pkg/utils"
+)
+
+// key 格式为 ak_<8位公开前缀>_<40位密钥>，库里只保存前缀与 HMAC 哈希
+const (
+	keyScheme    = "ak"
+	prefixBytes  = 4
+	secretBytes  = 20
+	legacyPrefix = 8
+)
+
+var ErrEmptyPepper = errors.New("apikey: pepper is empty")
+
+// Key 为新生成的 key，Plain 只在生成时返回给用户一次
+type Key struct {
+	Plain  string
+	Prefix string
+	Hash   string
+}
+
+type Hasher struct {
+	pepper []byte
+}
+
+func NewHasher(cfg Config) (*Hasher, error) {
+	if cfg.Pepper == "" {
+		return nil, ErrEmptyPepper
+	}
+	return &Hasher{pepper: []byte(cfg.Pepper)}, nil
+}
+
+// Hash 返回 key 的 HMAC-SHA256 十六进制摘要
+func (h *Hasher) Hash(key string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Hasher) Generate() Key {
+	prefix := fmt.Sprintf("%s_%s", keyScheme, utils.GenerateRandomKey(prefixBytes))
+	plain := fmt.Sprintf("%s_%s", prefix, utils.GenerateRandomKey(secretBytes))
+	return Key{
+		Plain:  plain,
+		Prefix: prefix,
+		Hash:   h.Hash(plain),
+	}
+}
+
+// Prefix 返回 key 的公开前缀；旧版 UUID key 取前 8 位
+func Prefix(key string) string {
+	if strings.HasPrefix(key, keyScheme+"_") {
+		if i := strings.LastIndex(key, "_"); i > len(keyScheme) {
+			return key[:i]
+		}
+	}
+	if len(key) <= legacyPrefix {
+		return key
+	}
+	return key[:legacyPrefix]
+}
+
+// CacheKey 返回 key 哈希在 Redis 中的缓存键
+func CacheKey(hash string) string {
+	return "apiKey:" + hash
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAndHash(t *testing.T) {
+	h, err := NewHasher(Config{Pepper: "pepper"})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+
+	key := h.Generate()
+	if !strings.HasPrefix(key.Plain, key.Prefix+"_") {
+		t.Fatalf("plain key %q does not start with prefix %q", key.Plain, key.Prefix)
+	}
+	if got := Prefix(key.Plain); got != key.Prefix {
+		t.Fatalf("Prefix(%q) = %q, want %q", key.Plain, got, key.Prefix)
+	}
+	if h.Hash(key.Plain) != key.Hash {
+		t.Fatal("hash of generated key is not stable")
+	}
+
+	other, _ := NewHasher(Config{Pepper: "another"})
+	if other.Hash(key.Plain) == key.Hash {
+		t.Fatal("hash does not depend on pepper")
+	}
+}
+
+func TestPrefixLegacyKey(t *testing.T) {
+	if got := Prefix("0f8e2a7c9d5b4e1f8a6c3b2d1e0f9a8b"); got != "0f8e2a7c" {
+		t.Fatalf("Prefix(legacy) = %q", got)
+	}
+}
+
+func TestNewHasherRequiresPepper(t *testing.T) {
+	if _, err := NewHasher(Config{}); err != ErrEmptyPepper {
+		t.Fatalf("NewHasher(empty) err = %v, want ErrEmptyPepper", err)
+	}
+}
+
+func TestSameCache(t *testing.T) {
+	current := []byte(`{"taskId":1,"keyId":"ak_1a2b3c4d","userId":2,"userLevel":1,"policy":{"scopes":["ip:lookup"]}}`)
+
+	// 旧版缓存多出的 quota 字段不影响比较
+	legacy := []byte(`{"quota":10,"policy":{"scopes":["ip:lookup"]},"userLevel":1,"userId":2,"keyId":"ak_1a2b3c4d","taskId":1}`)
+	if !sameCache(legacy, current) {
+		t.Fatal("equivalent cache entries reported as different")
+	}
+
+	downgraded := []byte(`{"taskId":1,"keyId":"ak_1a2b3c4d","userId":2,"userLevel":0,"policy":{"scopes":["ip:lookup"]}}`)
+	if sameCache(downgraded, current) {
+		t.Fatal("level change not detected")
+	}
+	if sameCache([]byte("not json"), current) {
+		t.Fatal("invalid cache entry reported as equal")
+	}
+}
@@ -0,0 +1,6 @@
+package apikey
+
+type Config struct {
+	// Pepper 为计算 key 哈希的服务端密钥，修改后所有已发放的 key 都会失效
+	Pepper string `yaml:"pepper"`
+}
@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+
+	"asum/pkg/db"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+)
+
+type legacyTask struct {
+	ID          uint64
+	TaskKey     string
+	PrevTaskKey string
+}
+
+// MigratePlaintext 将旧版 tasks.task_key / prev_task_key 中的明文 key 改为前缀 + 哈希保存，
+// 全部完成后删除明文列。Redis 中的 apiKey:<明文> 缓存先于数据库更新删除，更新后由 store.SyncTask
+// 按数据库重建 apiKey:<哈希>，中途退出时重新执行即可，不会留下明文缓存。
+// 需在 tasks 表 AutoMigrate 之后调用，可重复执行。
+func MigratePlaintext(ctx context.Context, pg *db.DB, store *Store, h *Hasher) error {
+	m := pg.Migrator()
+	if !m.HasColumn(&models.Task{}, "task_key") {
+		return nil
+	}
+	hasPrev := m.HasColumn(&models.Task{}, "prev_task_key")
+
+	cols := []string{"id", "task_key"}
+	if hasPrev {
+		cols = append(cols, "prev_task_key")
+	}
+
+	var rows []legacyTask
+	if err := pg.WithContext(ctx).
+		Table("tasks").
+		Select(cols).
+		Where("key_hash IS NULL OR key_hash = ''").
+		Scan(&rows).Error; err != nil {
+		return fmt.Errorf("load plaintext keys: %w", err)
+	}
+
+	for _, row := range rows {
+		updates := map[string]interface{}{
+			"key_prefix": Prefix(row.TaskKey),
+			"key_hash":   h.Hash(row.TaskKey),
+		}
+		plain := []string{CacheKey(row.TaskKey)}
+
+		if row.PrevTaskKey != "" {
+			updates["prev_key_prefix"] = Prefix(row.PrevTaskKey)
+			updates["prev_key_hash"] = h.Hash(row.PrevTaskKey)
+			plain = append(plain, CacheKey(row.PrevTaskKey))
+		}
+
+		if err := store.rdb.Del(ctx, plain...).Err(); err != nil {
+			return fmt.Errorf("drop plaintext key cache of task %d: %w", row.ID, err)
+		}
+		if err := pg.WithContext(ctx).
+			Table("tasks").
+			Where("id = ?", row.ID).
+			Updates(updates).Error; err != nil {
+			return fmt.Errorf("migrate key of task %d: %w", row.ID, err)
+		}
+		if err := store.SyncTask(ctx, row.ID); err != nil {
+			return fmt.Errorf("rebuild key cache of task %d: %w", row.ID, err)
+		}
+	}
+
+	if err := m.DropColumn(&models.Task{}, "task_key"); err != nil {
+		return fmt.Errorf("drop tasks.task_key: %w", err)
+	}
+	if hasPrev {
+		if err := m.DropColumn(&models.Task{}, "prev_task_key"); err != nil {
+			return fmt.Errorf("drop tasks.prev_task_key: %w", err)
+		}
+	}
+
+	logx.Infof("migrated %d plaintext task keys to hashed storage", len(rows))
+	return nil
+}
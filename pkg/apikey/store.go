@@ -0,0 +1,376 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 是 apiKey:<hash> 缓存唯一的写入与失效入口。
+// task 或用户状态变化（停用、删除、封号、等级变化、轮换、访问限制变化、转让）后调用 SyncTask/SyncUser，
+// 按 Postgres 中的当前状态重写或删除对应缓存；只有启用中、未删除且所属用户为正常状态的 task 才保留缓存。
+type Store struct {
+	db  *db.DB
+	rdb *rdb.Client
+}
+
+func NewStore(pg *db.DB, cache *rdb.Client) *Store {
+	return &Store{db: pg, rdb: cache}
+}
+
+// entry 为某个缓存键应有的内容，value 为空表示应当删除
+type entry struct {
+	taskID uint64
+	value  []byte
+	ttl    time.Duration
+}
+
+// SyncTask 按 task 当前状态重写其 key 缓存，revoked 为需要一并删除的旧 key 哈希
+func (s *Store) SyncTask(ctx context.Context, taskID uint64, revoked ...string) error {
+	want, err := s.desired(ctx, "id = ?", taskID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range revoked {
+		if hash == "" {
+			continue
+		}
+		if _, ok := want[CacheKey(hash)]; !ok {
+			want[CacheKey(hash)] = entry{}
+		}
+	}
+	return s.apply(ctx, want)
+}
+
+// SyncUser 重写用户关联的全部 task 的 key 缓存
+func (s *Store) SyncUser(ctx context.Context, userID uint64) error {
+	want, err := s.desired(ctx, "id IN (?)",
+		s.db.WithContext(ctx).Model(&models.UserTask{}).Select("task_id").Where("user_id = ?", userID))
+	if err != nil {
+		return err
+	}
+	return s.apply(ctx, want)
+}
+
+// Revoke 直接删除指定 key 哈希的缓存
+func (s *Store) Revoke(ctx context.Context, hashes ...string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	keys := make([]string, len(hashes))
+	for i, h := range hashes {
+		keys[i] = CacheKey(h)
+	}
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+// desired 计算满足条件的 task（含已停用、已删除）各 key 应有的缓存内容
+func (s *Store) desired(ctx context.Context, query string, args ...any) (map[string]entry, error) {
+	var tasks []models.Task
+	if err := s.db.WithContext(ctx).Where(query, args...).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]entry, len(tasks))
+	if len(tasks) == 0 {
+		return out, nil
+	}
+
+	owners, err := s.owners(ctx, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range tasks {
+		t := &tasks[i]
+		out[CacheKey(t.KeyHash)] = entry{taskID: t.ID}
+		if t.PrevKeyHash != "" {
+			out[CacheKey(t.PrevKeyHash)] = entry{taskID: t.ID}
+		}
+
+		owner, ok := owners[t.ID]
+		if !ok || t.Status != models.StatusEnabled || t.DeletedAt != nil ||
+			owner.Status != models.StatusActive || owner.DeletedAt != nil {
+			continue
+		}
+
+		cacheData := models.NewApiCache(t, owner.ID, owner.Level)
+		b, err := json.Marshal(cacheData)
+		if err != nil {
+			return nil, err
+		}
+		out[CacheKey(t.KeyHash)] = entry{taskID: t.ID, value: b}
+
+		// 轮换宽限期内的旧 key 随宽限期一起过期
+		if t.PrevKeyActive(now) {
+			cacheData.KeyID = t.PrevKeyPrefix
+			b, err := json.Marshal(cacheData)
+			if err != nil {
+				return nil, err
+			}
+			out[CacheKey(t.PrevKeyHash)] = entry{taskID: t.ID, value: b, ttl: t.PrevKeyExpiresAt.Sub(now)}
+		}
+	}
+	return out, nil
+}
+
+// owners 返回各 task 的 owner，key 的等级与用量都记在 owner 名下
+func (s *Store) owners(ctx context.Context, tasks []models.Task) (map[uint64]*models.User, error) {
+	ids := make([]uint64, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+
+	var links []models.UserTask
+	if err := s.db.WithContext(ctx).
+		Where("task_id IN ? AND role = ?", ids, models.RoleOwner).
+		Order("id ASC").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+	ownerOf := make(map[uint64]uint64, len(links))
+	userIDs := make([]uint64, 0, len(links))
+	for _, l := range links {
+		if _, ok := ownerOf[l.TaskID]; ok {
+			continue
+		}
+		ownerOf[l.TaskID] = l.UserID
+		userIDs = append(userIDs, l.UserID)
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	var users []models.User
+	if err := s.db.WithContext(ctx).
+		Select("id", "level", "status", "deleted_at").
+		Where("id IN ?", userIDs).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint64]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	out := make(map[uint64]*models.User, len(ownerOf))
+	for taskID, userID := range ownerOf {
+		if u, ok := byID[userID]; ok {
+			out[taskID] = u
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) apply(ctx context.Context, want map[string]entry) error {
+	if len(want) == 0 {
+		return nil
+	}
+	pipe := s.rdb.Pipeline()
+	for key, e := range want {
+		if e.value == nil {
+			pipe.Del(ctx, key)
+			continue
+		}
+		pipe.Set(ctx, key, e.value, e.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Report 为一次一致性检查的结果
+type Report struct {
+	Checked    int
+	Missing    int
+	Mismatched int
+	Stale      int
+}
+
+func (r Report) Dirty() bool {
+	return r.Missing+r.Mismatched+r.Stale > 0
+}
+
+const checkBatch = 500
+
+// Check 对照 Postgres 检查全部 apiKey 缓存：缺失或内容不一致的重新写入，
+// 已不对应任何可用 key 的删除；fix 为 false 时只统计不修改
+func (s *Store) Check(ctx context.Context, fix bool) (Report, error) {
+	var report Report
+	known := make(map[string]bool)
+
+	var lastID uint64
+	for {
+		want, nextID, err := s.desiredPage(ctx, lastID)
+		if err != nil {
+			return report, err
+		}
+		if nextID == 0 {
+			break
+		}
+		lastID = nextID
+
+		var fixes []uint64
+		for key, e := range want {
+			known[key] = e.value != nil
+			if e.value == nil {
+				continue
+			}
+			report.Checked++
+			actual, err := s.rdb.Get(ctx, key).Bytes()
+			if errors.Is(err, redis.Nil) {
+				report.Missing++
+				fixes = append(fixes, e.taskID)
+				continue
+			}
+			if err != nil {
+				return report, err
+			}
+			if !sameCache(actual, e.value) {
+				report.Mismatched++
+				fixes = append(fixes, e.taskID)
+			}
+		}
+		// 修复时按最新状态重新计算，避免覆盖检查期间发生的变更
+		if fix && len(fixes) > 0 {
+			if err := s.syncTasks(ctx, fixes); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := s.rdb.Scan(ctx, cursor, CacheKey("*"), checkBatch).Result()
+		if err != nil {
+			return report, err
+		}
+		var stale []string
+		for _, key := range keys {
+			if !known[key] {
+				stale = append(stale, key)
+			}
+		}
+		if len(stale) > 0 {
+			n, err := s.dropStale(ctx, stale, fix)
+			if err != nil {
+				return report, err
+			}
+			report.Stale += n
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	return report, nil
+}
+
+// desiredPage 按 id 分页计算 task 的应有缓存，返回本页最大的 task id，没有更多数据时返回 0
+func (s *Store) desiredPage(ctx context.Context, afterID uint64) (map[string]entry, uint64, error) {
+	var ids []uint64
+	if err := s.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(checkBatch).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return nil, 0, nil
+	}
+	want, err := s.desired(ctx, "id IN ?", ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	return want, ids[len(ids)-1], nil
+}
+
+func (s *Store) syncTasks(ctx context.Context, ids []uint64) error {
+	want, err := s.desired(ctx, "id IN ?", ids)
+	if err != nil {
+		return err
+	}
+	return s.apply(ctx, want)
+}
+
+// dropStale 处理 Postgres 中找不到对应可用 key 的缓存；检查开始后新建或轮换出的 key
+// 也会出现在这里，因此删除前再按哈希查一次库，能查到的交给 SyncTask 处理
+func (s *Store) dropStale(ctx context.Context, keys []string, fix bool) (int, error) {
+	hashes := make([]string, len(keys))
+	for i, key := range keys {
+		hashes[i] = strings.TrimPrefix(key, CacheKey(""))
+	}
+
+	var ids []uint64
+	if err := s.db.WithContext(ctx).
+		Model(&models.Task{}).
+		Where("key_hash IN ? OR prev_key_hash IN ?", hashes, hashes).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	want, err := s.desired(ctx, "id IN ?", ids)
+	if err != nil {
+		return 0, err
+	}
+
+	var stale []string
+	for _, key := range keys {
+		if e, ok := want[key]; ok && e.value != nil {
+			continue
+		}
+		stale = append(stale, key)
+	}
+	if fix && len(stale) > 0 {
+		if err := s.rdb.Del(ctx, stale...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+func sameCache(a, b []byte) bool {
+	var x, y models.ApiCache
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// RunChecker 定期执行一致性检查并修复
+func (s *Store) RunChecker(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		report, err := s.Check(ctx, true)
+		if err != nil {
+			logx.Errorf("check api key cache: %v", err)
+			continue
+		}
+		if report.Dirty() {
+			logx.Infof("api key cache repaired: %s", report)
+		}
+	}
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("checked=%d missing=%d mismatched=%d stale=%d", r.Checked, r.Missing, r.Mismatched, r.Stale)
+}
@@ -1,25 +1,68 @@
 package config
 
 import (
+	"asum/pkg/apikey"
 	"asum/pkg/db"
 	"asum/pkg/engine"
 	"asum/pkg/mailer"
 	"asum/pkg/maxmind"
+	"asum/pkg/oidc"
+	"asum/pkg/pagination"
 	"asum/pkg/rdb"
 	"asum/pkg/token"
+	"asum/pkg/totp"
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	BaseURL  string         `mapstructure:"baseURL" yaml:"baseURL"`
-	Engine   engine.Config  `mapstructure:"engine" yaml:"engine"`
-	Email    mailer.Config  `mapstructure:"mail" yaml:"mail"`
-	MaxMind  maxmind.Config `mapstructure:"maxmind" yaml:"maxmind"`
-	JWT      token.Config   `mapstructure:"jwt" yaml:"jwt"`
-	Redis    rdb.Config     `mapstructure:"redis" yaml:"redis"`
-	Postgres db.Config      `mapstructure:"postgres" yaml:"postgres"`
+	BaseURL  string            `mapstructure:"baseURL" yaml:"baseURL"`
+	Engine   engine.Config     `mapstructure:"engine" yaml:"engine"`
+	Email    mailer.Config     `mapstructure:"mail" yaml:"mail"`
+	MaxMind  maxmind.Config    `mapstructure:"maxmind" yaml:"maxmind"`
+	JWT      token.Config      `mapstructure:"jwt" yaml:"jwt"`
+	Redis    rdb.Config        `mapstructure:"redis" yaml:"redis"`
+	Postgres db.Config         `mapstructure:"postgres" yaml:"postgres"`
+	ApiKey   apikey.Config     `mapstructure:"apiKey" yaml:"apiKey"`
+	Cursor   pagination.Config `mapstructure:"cursor" yaml:"cursor"`
+	Trash    TrashConfig       `mapstructure:"trash" yaml:"trash"`
+	Admin    AdminConfig       `mapstructure:"admin" yaml:"admin"`
+	Deletion DeletionConfig    `mapstructure:"deletion" yaml:"deletion"`
+	MFA      totp.Config       `mapstructure:"mfa" yaml:"mfa"`
+	OAuth    oidc.Config       `mapstructure:"oauth" yaml:"oauth"`
+}
+
+type DeletionConfig struct {
+	// CoolingOffDays 为确认注销到彻底删除之间的天数，未配置时为 14 天
+	CoolingOffDays int `mapstructure:"coolingOffDays" yaml:"coolingOffDays"`
+}
+
+func (c DeletionConfig) CoolingOff() time.Duration {
+	days := c.CoolingOffDays
+	if days <= 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type AdminConfig struct {
+	// Emails 中的账号在启动时被设为管理员，用于引导出第一个管理员
+	Emails []string `mapstructure:"emails" yaml:"emails"`
+}
+
+type TrashConfig struct {
+	// RetentionDays 为删除的任务在回收站中保留的天数，未配置时为 30 天
+	RetentionDays int `mapstructure:"retentionDays" yaml:"retentionDays"`
+}
+
+func (c TrashConfig) Retention() time.Duration {
+	days := c.RetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
 }
 
 func Load(path string) (Config, error) {
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"html/template"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// confirmPage 为邮件链接打开的确认页。表单不带 action，点击后以 POST 提交到当前地址（含 query 中的 token），
+// 由对应的 POST 接口执行操作；邮件扫描、链接预取等只会发 GET，不会改变任何状态
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+<form method="post">
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmPage 返回确认页。链接中带有 token，页面禁止缓存、被嵌入和通过 Referer 外泄
+func (c *Ctx) ConfirmPage(title, message, button string) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	return confirmPage.Execute(c.Response().BodyWriter(), map[string]string{
+		"Title":   title,
+		"Message": message,
+		"Button":  button,
+	})
+}
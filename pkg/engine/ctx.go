@@ -16,6 +16,15 @@ func (c *Ctx) OK(data any) error {
 	})
 }
 
+// OKPage 以 CursorPage 返回一页列表
+func (c *Ctx) OKPage(list any, nextCursor string) error {
+	return c.OK(CursorPage{
+		List:       list,
+		NextCursor: nextCursor,
+		HasMore:    nextCursor != "",
+	})
+}
+
 func (c *Ctx) Fail(code int, msg any) error {
 	var message string
 	switch v := msg.(type) {
@@ -11,3 +11,10 @@ type Response struct {
 	Msg  string `json:"msg" example:"ok"`
 	Data any    `json:"data,omitempty"`
 }
+
+// CursorPage 为游标分页列表的标准响应，nextCursor 为空表示没有更多数据
+type CursorPage struct {
+	List       any    `json:"list"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
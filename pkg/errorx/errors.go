@@ -11,6 +11,13 @@ var (
 	ErrInvalidRequestBody = errors.New("无效的请求参数")
 	ErrUnauthorized       = errors.New("未授权")
 	ErrTokenExpired       = errors.New("令牌已过期")
+	ErrForbidden          = errors.New("无权访问")
+)
+
+// pagination
+var (
+	ErrInvalidCursor = errors.New("无效的分页游标")
+	ErrInvalidFilter = errors.New("无效的筛选或排序条件")
 )
 
 // task
@@ -18,6 +25,20 @@ var (
 	ErrTaskNotFound      = errors.New("任务不存在")
 	ErrTaskAlreadyExists = errors.New("任务已存在")
 	ErrInvalidTaskKey    = errors.New("无效的API")
+	ErrTaskForbidden     = errors.New("无权操作此任务")
+	ErrInvalidKeyPolicy  = errors.New("无效的API访问限制")
+	ErrApiKeyExpired     = errors.New("API已过期")
+	ErrApiKeyScope       = errors.New("API无权访问此接口")
+	ErrApiKeySourceIP    = errors.New("来源IP不在API允许范围内")
+	ErrApiKeyOrigin      = errors.New("来源站点不在API允许范围内")
+	ErrBatchTooLarge     = errors.New("批量查询数量超过API上限")
+	ErrInvalidRole       = errors.New("无效的成员角色")
+	ErrAlreadyMember     = errors.New("该用户已是任务成员")
+	ErrNotMember         = errors.New("该用户不是任务成员")
+	ErrOwnerCannotLeave  = errors.New("所有者需先转让任务")
+	ErrInviteInvalid     = errors.New("邀请已失效")
+	ErrInviteMismatch    = errors.New("邀请不属于当前账号")
+	ErrInviteNoAccount   = errors.New("受邀邮箱尚未注册或激活，请先注册后再打开邀请链接")
 )
 
 // auth
@@ -39,11 +60,79 @@ var (
 var (
 	ErrQuota = errors.New("余额不足")
 )
+
+// account
+var (
+	ErrDeletionNotFound  = errors.New("没有进行中的注销申请")
+	ErrDeletionScheduled = errors.New("账号已确认注销，请先撤销")
+	ErrExportTooFrequent = errors.New("导出过于频繁，请稍后再试")
+	ErrEmailTaken        = errors.New("该邮箱已被使用")
+	ErrSameEmail         = errors.New("新邮箱不能与当前邮箱相同")
+	ErrEmailChangeStale  = errors.New("账号邮箱已变化，请重新申请")
+)
+
+// session
+var (
+	ErrSessionNotFound = errors.New("会话不存在或已失效")
+	ErrSessionRevoked  = errors.New("会话已失效，请重新登录")
+	ErrRefreshReused   = errors.New("refresh token 已被使用，该会话已退出")
+)
+
+// mfa
+var (
+	ErrMFAEnabled      = errors.New("已启用两步验证")
+	ErrMFANotEnabled   = errors.New("未启用两步验证")
+	ErrMFANotEnrolled  = errors.New("请先获取两步验证密钥")
+	ErrMFACodeInvalid  = errors.New("验证码或恢复码无效")
+	ErrMFATokenExpired = errors.New("两步验证已超时，请重新登录")
+	ErrMFALocked       = errors.New("两步验证失败次数过多，请稍后再试")
+)
+
+// oauth
+var (
+	ErrOAuthProvider        = errors.New("不支持的登录方式")
+	ErrOAuthState           = errors.New("登录已超时或状态无效，请重新发起")
+	ErrOAuthFailed          = errors.New("第三方登录失败")
+	ErrOAuthEmailUnverified = errors.New("第三方账号的邮箱未验证，无法登录")
+)
+
+// rbac
+var (
+	ErrRoleNotFound      = errors.New("角色不存在")
+	ErrInvalidRoleName   = errors.New("无效的角色名")
+	ErrInvalidPermission = errors.New("无效的权限")
+	ErrRoleBuiltIn       = errors.New("内置角色不能删除")
+	ErrRoleInUse         = errors.New("仍有用户使用该角色")
+)
+
+// watch
+var (
+	ErrWatchNotFound = errors.New("监控项不存在")
+	ErrInvalidWatch  = errors.New("无效的监控项")
+	ErrWatchTooBroad = errors.New("网段在 IP 库中包含的子网过多，请拆分为更小的网段")
+)
+
+// webhook
+var (
+	ErrWebhookNotFound  = errors.New("webhook 不存在")
+	ErrInvalidWebhook   = errors.New("无效的 webhook")
+	ErrWebhookPrivate   = errors.New("webhook 地址不能指向本机或内网")
+	ErrDeliveryNotFound = errors.New("投递记录不存在")
+)
+
+// alert
+var (
+	ErrAlertNotFound = errors.New("告警规则不存在")
+	ErrInvalidAlert  = errors.New("无效的告警规则")
+)
 var (
-	ErrInvalidIP = errors.New("无效的IP")
+	ErrInvalidIP     = errors.New("无效的IP")
+	ErrInvalidLookup = errors.New("无效的查询参数")
 )
 
 var (
 	ErrRateLimited       = errors.New("限制访问")
 	ErrRateLimitServeice = errors.New("限流计数错误")
+	ErrRequestTooCostly  = errors.New("单次请求消耗超过限额")
+	ErrTooManyInFlight   = errors.New("并发请求过多")
 )
@@ -133,6 +133,52 @@ func (m *Mailer) SendPasswordResetEmail(ctx context.Context, to, name, link stri
 	return m.SendMail(ctx, to, subject, html, text)
 }
 
+func (m *Mailer) SendUsageAlertEmail(ctx context.Context, to, name, title, detail string) error {
+	subject := "用量提醒：" + title
+	html := RenderUsageAlertEmail(name, title, detail)
+	text := fmt.Sprintf("您好 %s，%s\n%s", name, title, detail)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
+func (m *Mailer) SendTaskInviteEmail(ctx context.Context, to, inviter, taskName, role, link string) error {
+	subject := fmt.Sprintf("%s 邀请您加入任务「%s」", inviter, taskName)
+	html := RenderTaskInviteEmail(inviter, taskName, role, link)
+	text := fmt.Sprintf("%s 邀请您以 %s 身份加入任务「%s」，请点击以下链接接受邀请：%s", inviter, role, taskName, link)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
+func (m *Mailer) SendAccountDeletionEmail(ctx context.Context, to, name, link string, coolingOffDays int) error {
+	subject := "确认注销账号"
+	html := RenderAccountDeletionEmail(name, link, coolingOffDays)
+	text := fmt.Sprintf("您好 %s，请点击以下链接确认注销账号，确认后账号将在 %d 天后彻底删除：%s", name, coolingOffDays, link)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
+func (m *Mailer) SendEmailChangeConfirmEmail(ctx context.Context, to, name, link string) error {
+	subject := "确认新的登录邮箱"
+	html := RenderEmailChangeConfirmEmail(name, link)
+	text := fmt.Sprintf("您好 %s，请点击以下链接确认将此邮箱设为登录邮箱：%s", name, link)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
+func (m *Mailer) SendEmailChangeNoticeEmail(ctx context.Context, to, name, newEmail, link string) error {
+	subject := "您的登录邮箱正在被修改"
+	html := RenderEmailChangeNoticeEmail(name, newEmail, link)
+	text := fmt.Sprintf("您好 %s，您的账号申请将登录邮箱修改为 %s。如果这不是您的操作，请点击以下链接撤销：%s", name, newEmail, link)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
+func (m *Mailer) SendMFAChangedEmail(ctx context.Context, to, name string, enabled bool, ip, at string) error {
+	action := "关闭"
+	if enabled {
+		action = "开启"
+	}
+	subject := fmt.Sprintf("您的账号已%s两步验证", action)
+	html := RenderMFAChangedEmail(name, action, ip, at)
+	text := fmt.Sprintf("您好 %s，您的账号于 %s（IP %s）%s了两步验证。如果这不是您的操作，请立即重置密码。", name, at, ip, action)
+	return m.SendMail(ctx, to, subject, html, text)
+}
+
 func (m *Mailer) Close() error {
 	return m.client.Close()
 }
@@ -158,3 +158,240 @@ func RenderPasswordResetEmail(name, link string) string {
 </html>
 `, name, link, link)
 }
+
+// RenderUsageAlertEmail 渲染用量告警邮件
+func RenderUsageAlertEmail(name, title, detail string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #F59E0B; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>用量提醒</h1>
+        </div>
+        <div class="content">
+            <p>您好 <strong>%s</strong>，</p>
+            <p><strong>%s</strong></p>
+            <p>%s</p>
+            <p>您可以在控制台调整告警规则或充值余额。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, name, title, detail)
+}
+
+// RenderTaskInviteEmail 渲染任务成员邀请邮件
+func RenderTaskInviteEmail(inviter, taskName, role, link string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .button { display: inline-block; background: #4F46E5; color: white; padding: 14px 30px;
+                  text-decoration: none; border-radius: 6px; font-weight: bold; margin: 20px 0; }
+        .link { word-break: break-all; color: #666; font-size: 12px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>任务邀请</h1>
+        </div>
+        <div class="content">
+            <p><strong>%s</strong> 邀请您以 <strong>%s</strong> 身份加入任务「%s」。</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">接受邀请</a>
+            </p>
+            <p>或者复制以下链接到浏览器：</p>
+            <p class="link">%s</p>
+            <p>邀请有效期为 <strong>7 天</strong>，只能使用一次；如果还没有账号，请先使用本邮箱注册并激活。如果您不认识邀请人，请忽略此邮件。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, inviter, role, taskName, link, link)
+}
+
+// RenderAccountDeletionEmail 渲染注销账号确认邮件
+func RenderAccountDeletionEmail(name, link string, coolingOffDays int) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #EF4444; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .button { display: inline-block; background: #EF4444; color: white; padding: 14px 30px;
+                  text-decoration: none; border-radius: 6px; font-weight: bold; margin: 20px 0; }
+        .link { word-break: break-all; color: #666; font-size: 12px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>注销账号</h1>
+        </div>
+        <div class="content">
+            <p>您好 <strong>%s</strong>，</p>
+            <p>您申请注销账号，请点击下方按钮确认：</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">确认注销</a>
+            </p>
+            <p>或者复制以下链接到浏览器：</p>
+            <p class="link">%s</p>
+            <p>确认后账号将在 <strong>%d 天</strong>后彻底删除，包括您作为所有者的全部任务与 API key，期间可随时撤销。链接有效期为 <strong>24 小时</strong>。如果这不是您的操作，请忽略此邮件并尽快修改密码。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, name, link, link, coolingOffDays)
+}
+
+// RenderEmailChangeConfirmEmail 渲染发往新邮箱的确认邮件
+func RenderEmailChangeConfirmEmail(name, link string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .button { display: inline-block; background: #4F46E5; color: white; padding: 14px 30px;
+                  text-decoration: none; border-radius: 6px; font-weight: bold; margin: 20px 0; }
+        .link { word-break: break-all; color: #666; font-size: 12px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>确认新邮箱</h1>
+        </div>
+        <div class="content">
+            <p>您好 <strong>%s</strong>，</p>
+            <p>您申请将此邮箱设为账号的登录邮箱，请点击下方按钮确认：</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">确认修改</a>
+            </p>
+            <p>或者复制以下链接到浏览器：</p>
+            <p class="link">%s</p>
+            <p>链接有效期为 <strong>24 小时</strong>。确认后所有设备需要使用新邮箱重新登录。如果这不是您的操作，请忽略此邮件。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, name, link, link)
+}
+
+// RenderEmailChangeNoticeEmail 渲染发往旧邮箱的修改通知，附撤销链接
+func RenderEmailChangeNoticeEmail(name, newEmail, link string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #F59E0B; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .button { display: inline-block; background: #EF4444; color: white; padding: 14px 30px;
+                  text-decoration: none; border-radius: 6px; font-weight: bold; margin: 20px 0; }
+        .link { word-break: break-all; color: #666; font-size: 12px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>登录邮箱修改通知</h1>
+        </div>
+        <div class="content">
+            <p>您好 <strong>%s</strong>，</p>
+            <p>您的账号申请将登录邮箱修改为 <strong>%s</strong>，新邮箱确认后生效。</p>
+            <p>如果这不是您的操作，请点击下方按钮撤销，已生效的修改也会恢复为本邮箱，并使所有设备退出登录：</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">这不是我的操作</a>
+            </p>
+            <p>或者复制以下链接到浏览器：</p>
+            <p class="link">%s</p>
+            <p>链接有效期为 <strong>7 天</strong>。撤销后请尽快重置密码。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, name, newEmail, link, link)
+}
+
+// RenderMFAChangedEmail 渲染开启或关闭两步验证的通知，action 为 "开启" 或 "关闭"
+func RenderMFAChangedEmail(name, action, ip, at string) string {
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: #4F46E5; color: white; padding: 20px; text-align: center; border-radius: 8px 8px 0 0; }
+        .content { background: #f9fafb; padding: 30px; border-radius: 0 0 8px 8px; }
+        .footer { text-align: center; color: #666; font-size: 12px; margin-top: 20px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>两步验证已%s</h1>
+        </div>
+        <div class="content">
+            <p>您好 <strong>%s</strong>，</p>
+            <p>您的账号于 <strong>%s</strong> 从 IP <strong>%s</strong> %s了两步验证。</p>
+            <p>如果这不是您的操作，您的密码可能已经泄露，请立即重置密码。</p>
+        </div>
+        <div class="footer">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+        </div>
+    </div>
+</body>
+</html>
+`, action, name, at, ip, action)
+}
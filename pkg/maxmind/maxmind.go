@@ -233,6 +233,20 @@ func (db *DB) HasASN() bool {
 	return db.asnDB != nil
 }
 
+// BuildEpoch 返回已打开的各数据库中最新的构建时间，用于判断 IP 库是否已更新
+func (db *DB) BuildEpoch() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var epoch uint
+	for _, r := range []*maxminddb.Reader{db.cityDB, db.countryDB, db.asnDB} {
+		if r != nil && r.Metadata.BuildEpoch > epoch {
+			epoch = r.Metadata.BuildEpoch
+		}
+	}
+	return uint64(epoch)
+}
+
 func (db *DB) Close() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -0,0 +1,87 @@
+package maxmind
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var ErrTooManyNetworks = errors.New("too many networks")
+
+// Networks 按已打开的各数据库的网段边界切分 prefix，返回每一段的首地址。
+// 同一段内的地址在每个数据库中命中同一条记录，解析段内任一地址即可代表整段；
+// 段数超过 limit 时返回 ErrTooManyNetworks
+func (db *DB) Networks(prefix netip.Prefix, limit int) ([]netip.Addr, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrNoDB
+	}
+	var readers []*maxminddb.Reader
+	for _, r := range []*maxminddb.Reader{db.cityDB, db.countryDB, db.asnDB} {
+		if r != nil {
+			readers = append(readers, r)
+		}
+	}
+
+	return split(prefix, limit, func(addr netip.Addr) (netip.Addr, error) {
+		end := lastAddr(netip.PrefixFrom(addr, addr.BitLen()))
+		first := true
+		for _, r := range readers {
+			network, _, err := r.LookupNetwork(net.IP(addr.AsSlice()), &struct{}{})
+			if err != nil {
+				return netip.Addr{}, err
+			}
+			last := lastAddr(toPrefix(network))
+			if first || last.Less(end) {
+				end, first = last, false
+			}
+		}
+		return end, nil
+	})
+}
+
+// split 从 prefix 的首地址开始，按 networkEnd 给出的所在网段末地址逐段前进
+func split(prefix netip.Prefix, limit int, networkEnd func(netip.Addr) (netip.Addr, error)) ([]netip.Addr, error) {
+	prefix = prefix.Masked()
+	last := lastAddr(prefix)
+
+	var out []netip.Addr
+	for addr := prefix.Addr(); ; {
+		if len(out) == limit {
+			return nil, ErrTooManyNetworks
+		}
+		out = append(out, addr)
+
+		end, err := networkEnd(addr)
+		if err != nil {
+			return nil, err
+		}
+		if !end.Less(last) {
+			return out, nil
+		}
+		addr = end.Next()
+	}
+}
+
+func toPrefix(network *net.IPNet) netip.Prefix {
+	addr, _ := netip.AddrFromSlice(network.IP)
+	ones, _ := network.Mask.Size()
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+		ones -= 96
+	}
+	return netip.PrefixFrom(addr, ones)
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,60 @@
+package maxmind
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	// 10.0.0.0/24 在库中被切分为 /25、/26、/26 三段
+	nets := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/25"),
+		netip.MustParsePrefix("10.0.0.128/26"),
+		netip.MustParsePrefix("10.0.0.192/26"),
+	}
+	end := func(addr netip.Addr) (netip.Addr, error) {
+		for _, n := range nets {
+			if n.Contains(addr) {
+				return lastAddr(n), nil
+			}
+		}
+		t.Fatalf("lookup outside of prefix: %s", addr)
+		return netip.Addr{}, nil
+	}
+
+	got, err := split(netip.MustParsePrefix("10.0.0.0/24"), 10, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Addr{
+		netip.MustParseAddr("10.0.0.0"),
+		netip.MustParseAddr("10.0.0.128"),
+		netip.MustParseAddr("10.0.0.192"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("split = %v, want %v", got, want)
+	}
+
+	// 库中网段比 prefix 大时只解析一次
+	got, _ = split(netip.MustParsePrefix("10.0.0.16/28"), 10, end)
+	if len(got) != 1 || got[0] != netip.MustParseAddr("10.0.0.16") {
+		t.Errorf("split /28 = %v", got)
+	}
+
+	if _, err := split(netip.MustParsePrefix("10.0.0.0/24"), 2, end); err != ErrTooManyNetworks {
+		t.Errorf("split with limit 2: err = %v, want ErrTooManyNetworks", err)
+	}
+}
+
+func TestLastAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"10.1.2.3/16":   "10.1.255.255",
+		"10.1.2.3/32":   "10.1.2.3",
+		"2001:db8::/32": "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+	} {
+		if got := lastAddr(netip.MustParsePrefix(in)); got.String() != want {
+			t.Errorf("lastAddr(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"asum/pkg/apikey"
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ApiKeyHeader = "X-API-Key"
+	ApiKeyScheme = "ApiKey"
+	ApiKeyQuery  = "key"
+)
+
+type RequestPayload struct {
+	ApiKey string `json:"apiKey"`
+}
+
+// ResolveApiKey 依次从 X-API-Key、Authorization: ApiKey、?key= 以及 JSON body 的 apiKey 中读取
+func ResolveApiKey(c fiber.Ctx) (string, error) {
+	if key := strings.TrimSpace(c.Get(ApiKeyHeader)); key != "" {
+		return key, nil
+	}
+
+	if authHeader := c.Get("Authorization"); authHeader != "" {
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], ApiKeyScheme) && strings.TrimSpace(parts[1]) != "" {
+			return strings.TrimSpace(parts[1]), nil
+		}
+	}
+
+	if key := strings.TrimSpace(c.Query(ApiKeyQuery)); key != "" {
+		return key, nil
+	}
+
+	var payload RequestPayload
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &payload); err != nil {
+			return "", errorx.ErrInvalidPayload
+		}
+	}
+	return strings.TrimSpace(payload.ApiKey), nil
+}
+
+// ApiKeyAuth 解析并校验 API key，将 key 哈希与缓存的 task/用户/等级信息写入 locals；
+// 未携带 key 的请求按匿名处理，由 RateLimit 按来源 IP 限流
+func ApiKeyAuth(ctx context.Context, rdb *rdb.Client, hasher *apikey.Hasher) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		apiKey, err := ResolveApiKey(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  err.Error(),
+			})
+		}
+
+		currentLevel := models.LevelBasic
+		var apiCache *models.ApiCache
+
+		// 缓存与限流只使用 key 的哈希，明文不落地
+		if apiKey != "" {
+			apiKey = hasher.Hash(apiKey)
+			redisKey := apikey.CacheKey(apiKey)
+			levelStr, err := rdb.Get(ctx, redisKey).Result()
+			if err == redis.Nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrInvalidTaskKey.Error(),
+				})
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrRateLimitServeice.Error(),
+				})
+			}
+
+			apiCache = &models.ApiCache{}
+			err = json.Unmarshal([]byte(levelStr), apiCache)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrInvalidTaskKey.Error(),
+				})
+			}
+			apiCache.Key = apiKey
+
+			if err := checkKeyPolicy(c, &apiCache.Policy); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  err.Error(),
+				})
+			}
+			currentLevel = apiCache.UserLevel
+		}
+
+		c.Locals("userLevel", currentLevel)
+		c.Locals("apiKey", apiKey)
+		if apiCache != nil {
+			c.Locals("apiCache", apiCache)
+		}
+
+		return c.Next()
+	}
+}
+
+func checkKeyPolicy(c fiber.Ctx, policy *models.KeyPolicy) error {
+	if policy.Expired(time.Now()) {
+		return errorx.ErrApiKeyExpired
+	}
+	if !policy.AllowsIP(c.IP()) {
+		return errorx.ErrApiKeySourceIP
+	}
+	if !policy.AllowsOrigin(c.Get("Origin")) {
+		return errorx.ErrApiKeyOrigin
+	}
+	return nil
+}
+
+// RequireScope 校验 API key 是否允许访问当前接口，批量接口同时校验单次数量上限；
+// 未携带 key 的匿名请求交由后续 handler 处理
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		apiCache, ok := c.Locals("apiCache").(*models.ApiCache)
+		if !ok || apiCache == nil {
+			return c.Next()
+		}
+
+		if !apiCache.Policy.AllowsScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrApiKeyScope.Error(),
+			})
+		}
+
+		if scope == models.ScopeBatch && apiCache.Policy.MaxBatchSize > 0 {
+			if !apiCache.Policy.AllowsBatch(batchSize(c)) {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrBatchTooLarge.Error(),
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// batchSize 返回请求体中 ips 的数量
+func batchSize(c fiber.Ctx) int {
+	var payload struct {
+		IPs []string `json:"ips"`
+	}
+	_ = json.Unmarshal(c.Body(), &payload)
+	return len(payload.IPs)
+}
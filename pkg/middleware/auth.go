@@ -1,17 +1,36 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
 
 	"asum/pkg/engine"
 	"asum/pkg/errorx"
+	"asum/pkg/rdb"
+	"asum/pkg/session"
 	"asum/pkg/token"
 
 	"github.com/gofiber/fiber/v3"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func Auth(secret string) fiber.Handler {
+var (
+	sessions *session.Store
+	denylist *token.Denylist
+)
+
+// UseSessions 在启动时设置 Auth 使用的会话存储
+func UseSessions(s *session.Store) {
+	sessions = s
+}
+
+// UseDenylist 在启动时设置 Auth 使用的 jti 黑名单
+func UseDenylist(d *token.Denylist) {
+	denylist = d
+}
+
+// Auth 由 jwtMgr 校验 access token，并拒绝已登出（jti 在黑名单中）、签发于 token.RevokeUser 之前或所属会话已撤销的令牌；
+// 没有会话的令牌只接受管理员模拟登录签发的
+func Auth(jwtMgr *token.Manager, cache *rdb.Client) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		tokenString := ""
 
@@ -37,16 +56,9 @@ func Auth(secret string) fiber.Handler {
 			})
 		}
 
-		claims := &token.Claims{}
-		tk, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errorx.ErrUnauthorized
-			}
-			return []byte(secret), nil
-		})
-
-		if err != nil || !tk.Valid {
-			if err != nil && strings.Contains(err.Error(), "expired") {
+		claims, err := jwtMgr.ParseToken(c.Context(), tokenString)
+		if err != nil {
+			if errors.Is(err, token.ErrExpiredToken) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 					"code": engine.CodeFail,
 					"msg":  errorx.ErrTokenExpired.Error(),
@@ -58,9 +70,75 @@ func Auth(secret string) fiber.Handler {
 			})
 		}
 
+		if denylist != nil {
+			denied, err := denylist.Denied(c.Context(), claims.ID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrInternal.Error(),
+				})
+			}
+			if denied {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrSessionRevoked.Error(),
+				})
+			}
+		}
+
+		revoked, err := token.Revoked(c.Context(), cache, claims)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrInternal.Error(),
+			})
+		}
+		if revoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrTokenExpired.Error(),
+			})
+		}
+
+		if claims.SessionID == "" && claims.Impersonator == 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrSessionRevoked.Error(),
+			})
+		}
+		if claims.SessionID != "" {
+			if sessions == nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrInternal.Error(),
+				})
+			}
+			active, err := sessions.Active(c.Context(), claims.UserID, claims.SessionID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrInternal.Error(),
+				})
+			}
+			if !active {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"code": engine.CodeFail,
+					"msg":  errorx.ErrSessionRevoked.Error(),
+				})
+			}
+			c.Locals("sessionID", claims.SessionID)
+		}
+
+		c.Locals("tokenID", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
 		c.Locals("userID", claims.UserID)
 		c.Locals("email", claims.Email)
 		c.Locals("userLevel", claims.Level)
+		if claims.Impersonator != 0 {
+			c.Locals("impersonatorID", claims.Impersonator)
+		}
 
 		return c.Next()
 	}
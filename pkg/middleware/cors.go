@@ -8,6 +8,6 @@ import (
 func Cors() fiber.Handler {
 	return cors.New(cors.Config{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", ApiKeyHeader},
 	})
 }
@@ -3,107 +3,191 @@ package middleware
 import (
 	"asum/pkg/engine"
 	"asum/pkg/errorx"
+	"asum/pkg/logx"
 	"asum/pkg/models"
 	"asum/pkg/rdb"
+	"asum/pkg/usage"
+	"asum/pkg/utils"
 	"context"
-	"encoding/json"
-	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/redis/go-redis/v9"
 )
 
-type RequestPayload struct {
-	ApiKey string `json:"apiKey"`
-}
-
+// LimitConfig 令牌桶以 Rate 个/秒的速度回填，最多累积 Burst 个；
+// MaxInFlight 为同一 key（匿名时为同一 IP）同时处理中的请求上限
 type LimitConfig struct {
-	Max        int
-	Expiration time.Duration
+	Rate        float64
+	Burst       int
+	MaxInFlight int
 }
 
 var levelRules = map[models.Level]LimitConfig{
-	models.LevelBasic:   {Max: 1, Expiration: 1 * time.Second},
-	models.LevelPlus:    {Max: 100, Expiration: 1 * time.Second},
-	models.LevelPremium: {Max: 1000, Expiration: 1 * time.Second},
-	models.LevelTop:     {Max: 5000, Expiration: 1 * time.Second},
+	models.LevelBasic:   {Rate: 1, Burst: 1, MaxInFlight: 2},
+	models.LevelPlus:    {Rate: 100, Burst: 100, MaxInFlight: 10},
+	models.LevelPremium: {Rate: 1000, Burst: 1000, MaxInFlight: 50},
+	models.LevelTop:     {Rate: 5000, Burst: 5000, MaxInFlight: 200},
 }
 
-func RateLimitAndAuthMiddleware(ctx context.Context, rdb *rdb.Client) fiber.Handler {
-	return func(c fiber.Ctx) error {
-		var payload RequestPayload
-		if len(c.Body()) > 0 {
-			if err := json.Unmarshal(c.Body(), &payload); err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"code": engine.CodeFail,
-					"msg":  errorx.ErrInvalidPayload.Error(),
-				})
-			}
-		}
+// inFlightLease 为并发占位的租约时长，进程异常退出未释放的占位到期后自动回收
+const inFlightLease = 60 * time.Second
+
+// CostFunc 计算一次请求消耗的令牌数
+type CostFunc func(c fiber.Ctx) int
+
+// FixedCost 每次请求固定消耗 n 个令牌
+func FixedCost(n int) CostFunc {
+	return func(fiber.Ctx) int {
+		return n
+	}
+}
+
+// PerIPCost 批量接口按请求体中 ips 的数量计费，每个 IP 消耗 perIP 个令牌，至少按 1 个 IP 计
+func PerIPCost(perIP int) CostFunc {
+	return func(c fiber.Ctx) int {
+		return max(batchSize(c), 1) * perIP
+	}
+}
 
-		currentLevel := models.LevelBasic
+// ApiKeyLimitKeys 返回某个 key 哈希的限流与并发计数键，key 删除后用于清理
+func ApiKeyLimitKeys(keyHash string) []string {
+	subject := "apikey:" + keyHash
+	return []string{"ratelimit:" + subject, "inflight:" + subject}
+}
+
+// tokenBucketScript 原子地回填并扣减令牌，返回 {是否放行, 剩余令牌}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+  tokens = burst
+  ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens)}
+`)
+
+// acquireScript 回收过期租约后尝试占用一个并发名额
+var acquireScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local lease = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= limit then
+  return 0
+end
+redis.call("ZADD", KEYS[1], now + lease, ARGV[4])
+redis.call("PEXPIRE", KEYS[1], lease)
+return 1
+`)
+
+// Limiter 为 IP 查询接口的限流器，各路由通过 Cost 指定各自的令牌消耗
+type Limiter struct {
+	ctx context.Context
+	rdb *rdb.Client
+}
+
+func NewLimiter(ctx context.Context, rdb *rdb.Client) *Limiter {
+	return &Limiter{ctx: ctx, rdb: rdb}
+}
+
+// Cost 限制同一 key 同时处理中的请求数，并按 cost 从令牌桶中扣减令牌，请求成功后按同样的 cost 记录用量；
+// 需挂在 ApiKeyAuth 之后
+func (l *Limiter) Cost(cost CostFunc) fiber.Handler {
+	ctx, rdb := l.ctx, l.rdb
+	return func(c fiber.Ctx) error {
 		limitConfig := levelRules[models.LevelBasic]
-		limiterKey := "ratelimit:ip:" + c.IP()
+		subject := "ip:" + c.IP()
 
-		if payload.ApiKey != "" {
-			redisKey := fmt.Sprintf("apiKey:%s", payload.ApiKey)
-			levelStr, err := rdb.Get(ctx, redisKey).Result()
-			if err == redis.Nil {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"code": engine.CodeFail,
-					"msg":  errorx.ErrInvalidTaskKey.Error(),
-				})
-			} else if err != nil {
+		apiCache, _ := c.Locals("apiCache").(*models.ApiCache)
+		if apiCache != nil {
+			rule, ok := levelRules[apiCache.UserLevel]
+			if !ok {
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 					"code": engine.CodeFail,
 					"msg":  errorx.ErrRateLimitServeice.Error(),
 				})
 			}
+			limitConfig = rule
+			subject = "apikey:" + apiCache.Key
+		}
 
-			apiCache := models.ApiCache{}
-			err = json.Unmarshal([]byte(levelStr), &apiCache)
-			if err != nil {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"code": engine.CodeFail,
-					"msg":  errorx.ErrInvalidTaskKey.Error(),
-				})
-			}
-			userLevel := apiCache.UserLevel
-			if rule, ok := levelRules[userLevel]; ok {
-				currentLevel = userLevel
-				limitConfig = rule
-				limiterKey = "ratelimit:apikey:" + payload.ApiKey
-			} else {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"code": engine.CodeFail,
-					"msg":  errorx.ErrRateLimitServeice.Error(),
-				})
-			}
+		n := cost(c)
+		if n > limitConfig.Burst {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrRequestTooCostly.Error(),
+			})
 		}
 
-		count, err := rdb.Incr(ctx, limiterKey).Result()
+		// 先占并发名额再扣令牌，因并发超限被拒的请求不消耗令牌
+		inFlightKey := "inflight:" + subject
+		member := utils.GenerateRandomKey(8)
+		acquired, err := acquireScript.Run(ctx, rdb, []string{inFlightKey},
+			time.Now().UnixMilli(), inFlightLease.Milliseconds(), limitConfig.MaxInFlight, member).Int()
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"code": engine.CodeFail,
 				"msg":  errorx.ErrRateLimitServeice.Error(),
 			})
 		}
-
-		if count == 1 {
-			rdb.Expire(ctx, limiterKey, limitConfig.Expiration)
+		if acquired == 0 {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrTooManyInFlight.Error(),
+			})
 		}
+		defer func() {
+			if err := rdb.ZRem(ctx, inFlightKey, member).Err(); err != nil {
+				logx.Errorf("release in-flight slot %s: %v", inFlightKey, err)
+			}
+		}()
 
-		if count > int64(limitConfig.Max) {
+		res, err := tokenBucketScript.Run(ctx, rdb, []string{"ratelimit:" + subject},
+			limitConfig.Rate, limitConfig.Burst, time.Now().UnixMilli(), n).Int64Slice()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrRateLimitServeice.Error(),
+			})
+		}
+		c.Set("X-RateLimit-Remaining", strconv.FormatInt(res[1], 10))
+		if res[0] == 0 {
+			retryAfter := int64(math.Ceil(float64(n) / limitConfig.Rate))
+			c.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
 			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
 				"code": engine.CodeFail,
 				"msg":  errorx.ErrRateLimited.Error(),
 			})
 		}
-		c.Locals("userLevel", currentLevel)
-		c.Locals("apiKey", payload.ApiKey)
 
-		return c.Next()
+		if err := c.Next(); err != nil {
+			return err
+		}
+		// 只有处理成功的请求计入用量，参数错误等失败的请求只消耗令牌
+		if apiCache != nil && c.Response().StatusCode() < fiber.StatusBadRequest {
+			_ = usage.Incr(ctx, rdb, apiCache.TaskID, apiCache.UserID, apiCache.KeyID, int64(n))
+		}
+		return nil
 	}
 }
 
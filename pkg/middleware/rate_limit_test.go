@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+	"asum/pkg/usage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *rdb.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return &rdb.Client{Client: client}
+}
+
+func TestTokenBucketScript(t *testing.T) {
+	ctx, r := context.Background(), newTestRedis(t)
+	take := func(now, cost int64) (bool, int64) {
+		t.Helper()
+		res, err := tokenBucketScript.Run(ctx, r, []string{"ratelimit:test"}, 2, 5, now, cost).Int64Slice()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res[0] == 1, res[1]
+	}
+
+	// 新桶装满 burst 个令牌，按 cost 扣减
+	if ok, left := take(0, 3); !ok || left != 2 {
+		t.Errorf("first take = %v, %d, want true, 2", ok, left)
+	}
+	if ok, left := take(0, 3); ok || left != 2 {
+		t.Errorf("over budget = %v, %d, want false, 2", ok, left)
+	}
+	// 每秒回填 rate 个，不超过 burst
+	if ok, left := take(500, 3); !ok || left != 0 {
+		t.Errorf("after 500ms = %v, %d, want true, 0", ok, left)
+	}
+	if ok, left := take(60_000, 0); !ok || left != 5 {
+		t.Errorf("after a minute = %v, %d, want true, 5", ok, left)
+	}
+}
+
+func TestAcquireScript(t *testing.T) {
+	ctx, r := context.Background(), newTestRedis(t)
+	acquire := func(now int64, member string) int {
+		t.Helper()
+		n, err := acquireScript.Run(ctx, r, []string{"inflight:test"}, now, 1000, 2, member).Int()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if acquire(0, "a") != 1 || acquire(0, "b") != 1 {
+		t.Fatal("slots below the limit refused")
+	}
+	if acquire(0, "c") != 0 {
+		t.Error("slot above the limit granted")
+	}
+	if err := r.ZRem(ctx, "inflight:test", "a").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if acquire(0, "c") != 1 {
+		t.Error("released slot not reused")
+	}
+	// 未释放的占位在租约到期后回收
+	if acquire(1001, "d") != 1 || acquire(1001, "e") != 1 {
+		t.Error("expired leases not reclaimed")
+	}
+}
+
+func TestCostRecordsUsageOnSuccess(t *testing.T) {
+	ctx, r := context.Background(), newTestRedis(t)
+	apiCache := &models.ApiCache{TaskID: 1, KeyID: "k1", UserID: 2, UserLevel: models.LevelPlus, Key: "hash"}
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("apiCache", apiCache)
+		return c.Next()
+	})
+	app.Post("/batch", NewLimiter(ctx, r).Cost(PerIPCost(1)), func(c fiber.Ctx) error {
+		if c.Query("fail") != "" {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	call := func(query string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/batch"+query, strings.NewReader(`{"ips":["1.1.1.1","8.8.8.8","9.9.9.9"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	recorded := func() int64 {
+		t.Helper()
+		days, err := usage.Days(ctx, r, apiCache.TaskID, apiCache.KeyID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return days[0].Count
+	}
+
+	if code := call("?fail=1"); code != fiber.StatusBadRequest {
+		t.Fatalf("status = %d", code)
+	}
+	if n := recorded(); n != 0 {
+		t.Errorf("failed request recorded %d calls, want 0", n)
+	}
+	if code := call(""); code != fiber.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if n := recorded(); n != 3 {
+		t.Errorf("successful batch recorded %d calls, want 3", n)
+	}
+	if n, _ := r.ZCard(ctx, "inflight:apikey:hash").Result(); n != 0 {
+		t.Errorf("%d in-flight slots left after the requests", n)
+	}
+}
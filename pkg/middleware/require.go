@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"asum/pkg/engine"
+	"asum/pkg/errorx"
+	"asum/pkg/models"
+	"asum/pkg/rbac"
+	"asum/pkg/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Require 须放在 Auth 之后，要求当前用户的角色拥有全部 perms，如 Require(store, "tasks:write")。
+// 角色按请求从 store 解析，撤销权限或封号后不必等令牌过期；模拟登录的令牌不能使用管理类权限
+func Require(store *rbac.Store, perms ...models.Permission) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		userID := utils.GetUserID(c)
+		if userID == 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrUnauthorized.Error(),
+			})
+		}
+		if utils.GetImpersonatorID(c) != 0 {
+			for _, p := range perms {
+				if p.Privileged() {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"code": engine.CodeFail,
+						"msg":  errorx.ErrForbidden.Error(),
+					})
+				}
+			}
+		}
+
+		ok, err := store.Allowed(c.Context(), userID, perms...)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrInternal.Error(),
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"code": engine.CodeFail,
+				"msg":  errorx.ErrForbidden.Error(),
+			})
+		}
+		return c.Next()
+	}
+}
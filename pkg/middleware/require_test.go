@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"asum/pkg/db"
+	"asum/pkg/models"
+	"asum/pkg/rbac"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T, users ...models.User) *rbac.Store {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &db.DB{DB: gdb}
+	if err := pg.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range users {
+		if err := pg.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := rbac.NewStore(pg, newTestRedis(t))
+	// support 只有 users:read，同样属于管理类权限
+	if err := store.SaveRole(context.Background(), &models.Role{
+		Name:        "support",
+		Permissions: []models.Permission{models.PermissionUsersRead},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestRequire(t *testing.T) {
+	store := newTestStore(t,
+		models.User{ID: 1, Name: "admin", Email: "admin@example.com", Role: models.UserRoleAdmin, Status: models.StatusActive},
+		models.User{ID: 2, Name: "user", Email: "user@example.com", Role: models.UserRoleUser, Status: models.StatusActive},
+		models.User{ID: 3, Name: "banned", Email: "banned@example.com", Role: models.UserRoleAdmin, Status: models.StatusBanned},
+		models.User{ID: 4, Name: "support", Email: "support@example.com", Role: "support", Status: models.StatusActive},
+	)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		if id := fiber.Query[uint64](c, "uid"); id != 0 {
+			c.Locals("userID", id)
+		}
+		if id := fiber.Query[uint64](c, "imp"); id != 0 {
+			c.Locals("impersonatorID", id)
+		}
+		return c.Next()
+	})
+	ok := func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/users", Require(store, models.PermissionUsersRead), ok)
+	app.Post("/users", Require(store, models.PermissionUsersRead, models.PermissionUsersWrite), ok)
+	app.Get("/tasks", Require(store, models.PermissionTasksRead), ok)
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"anonymous", "GET", "/users", fiber.StatusUnauthorized},
+		{"admin", "GET", "/users?uid=1", fiber.StatusOK},
+		{"admin needs every perm", "POST", "/users?uid=1", fiber.StatusOK},
+		{"user on admin route", "GET", "/users?uid=2", fiber.StatusForbidden},
+		{"user on task route", "GET", "/tasks?uid=2", fiber.StatusOK},
+		{"banned admin", "GET", "/users?uid=3", fiber.StatusForbidden},
+		{"unknown user", "GET", "/tasks?uid=99", fiber.StatusForbidden},
+		{"support read", "GET", "/users?uid=4", fiber.StatusOK},
+		{"support lacks write", "POST", "/users?uid=4", fiber.StatusForbidden},
+		{"impersonated admin on admin route", "GET", "/users?uid=1&imp=4", fiber.StatusForbidden},
+		{"impersonated user on task route", "GET", "/tasks?uid=2&imp=1", fiber.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(tc.method, tc.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
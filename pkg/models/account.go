@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+type DeletionStatus int
+
+const (
+	// DeletionPending 已申请，等待邮件确认
+	DeletionPending DeletionStatus = iota
+	// DeletionScheduled 已确认，冷静期结束后彻底删除
+	DeletionScheduled
+	DeletionCanceled
+	DeletionCompleted
+)
+
+// AccountDeletion 为注销账号申请；账号删除后只保留用户 ID 与时间，作为已执行删除的凭据
+type AccountDeletion struct {
+	ID             uint64         `gorm:"primaryKey" json:"id"`
+	UserID         uint64         `gorm:"index;not null" json:"userId"`
+	Status         DeletionStatus `gorm:"not null;default:0" json:"status"`
+	TokenHash      string         `gorm:"size:64;index" json:"-"`
+	TokenExpiresAt time.Time      `json:"-"`
+	ConfirmedAt    *time.Time     `json:"confirmedAt,omitempty"`
+	PurgeAt        *time.Time     `gorm:"index" json:"purgeAt,omitempty"`
+	CompletedAt    *time.Time     `json:"completedAt,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (AccountDeletion) TableName() string {
+	return "account_deletions"
+}
+
+type EmailChangeStatus int
+
+const (
+	EmailChangePending EmailChangeStatus = iota
+	EmailChangeConfirmed
+	EmailChangeReverted
+	EmailChangeCanceled
+)
+
+// EmailChange 为修改邮箱申请：确认链接发往新邮箱，撤销链接发往旧邮箱
+type EmailChange struct {
+	ID          uint64            `gorm:"primaryKey" json:"id"`
+	UserID      uint64            `gorm:"index;not null" json:"userId"`
+	OldEmail    string            `gorm:"size:255;not null" json:"oldEmail"`
+	NewEmail    string            `gorm:"size:255;not null" json:"newEmail"`
+	Status      EmailChangeStatus `gorm:"not null;default:0" json:"status"`
+	ConfirmHash string            `gorm:"size:64;index" json:"-"`
+	RevertHash  string            `gorm:"size:64;index" json:"-"`
+	// ExpiresAt 之前可以确认，RevertExpiresAt 之前旧邮箱可以撤销（含已确认的修改）
+	ExpiresAt       time.Time  `json:"expiresAt"`
+	RevertExpiresAt time.Time  `json:"revertExpiresAt"`
+	ConfirmedAt     *time.Time `json:"confirmedAt,omitempty"`
+	RevertedAt      *time.Time `json:"revertedAt,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (EmailChange) TableName() string {
+	return "email_changes"
+}
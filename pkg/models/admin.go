@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// AdminAction 为管理员操作类型
+type AdminAction string
+
+const (
+	AdminActionBan           AdminAction = "user.ban"
+	AdminActionUnban         AdminAction = "user.unban"
+	AdminActionSetLevel      AdminAction = "user.level"
+	AdminActionAdjustQuota   AdminAction = "user.quota"
+	AdminActionResetPassword AdminAction = "user.reset_password"
+	AdminActionDelete        AdminAction = "user.delete"
+	AdminActionHardDelete    AdminAction = "user.hard_delete"
+	AdminActionImpersonate   AdminAction = "user.impersonate"
+	AdminActionSetRole       AdminAction = "user.role"
+	AdminActionSaveRole      AdminAction = "role.save"
+	AdminActionDeleteRole    AdminAction = "role.delete"
+)
+
+// AdminAudit 记录管理员的每一次操作，用户被彻底删除后仍保留；角色操作的 TargetID 为 0
+type AdminAudit struct {
+	ID       uint64      `gorm:"primaryKey" json:"id"`
+	AdminID  uint64      `gorm:"index;not null" json:"adminId"`
+	TargetID uint64      `gorm:"index;not null" json:"targetId"`
+	Action   AdminAction `gorm:"size:32;not null" json:"action"`
+	// Detail 为操作参数，如调整的额度、等级或模拟登录的原因
+	Detail    string    `gorm:"type:text" json:"detail,omitempty"`
+	IP        string    `gorm:"size:45" json:"ip,omitempty"`
+	UserAgent string    `gorm:"size:500" json:"userAgent,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (AdminAudit) TableName() string {
+	return "admin_audits"
+}
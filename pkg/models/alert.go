@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// 用量告警指标
+const (
+	// AlertQuotaRemainingPct 账户剩余余额低于最近一次充值后余额的 Threshold%
+	AlertQuotaRemainingPct = "quota_remaining_pct"
+	// AlertDailyUsage 当日调用量超过 Threshold，TaskID 为 0 时统计账户下全部 task
+	AlertDailyUsage = "daily_usage"
+)
+
+var AlertMetrics = []string{AlertQuotaRemainingPct, AlertDailyUsage}
+
+type UsageAlert struct {
+	ID        uint64 `gorm:"primaryKey" json:"id"`
+	UserID    uint64 `gorm:"index;not null" json:"userId"`
+	TaskID    uint64 `gorm:"index;default:0" json:"taskId"`
+	Metric    string `gorm:"size:32;not null" json:"metric"`
+	Threshold int64  `gorm:"not null" json:"threshold"`
+	Enabled   bool   `gorm:"default:true" json:"enabled"`
+
+	// Baseline 为最近一次充值后的余额，余额上涨时随之更新并重新布防
+	Baseline int64 `gorm:"default:0" json:"-"`
+	// Triggered 表示当前处于越线状态，回落到阈值以内后复位
+	Triggered   bool       `gorm:"default:false" json:"triggered"`
+	LastPeriod  string     `gorm:"size:16" json:"-"`
+	LastFiredAt *time.Time `json:"lastFiredAt,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (UsageAlert) TableName() string {
+	return "usage_alerts"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UserIdentity 关联第三方登录账号，Provider 为配置中的名称，Subject 为对方的用户 ID
+type UserIdentity struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	UserID    uint64    `gorm:"index;not null" json:"-"`
+	Provider  string    `gorm:"size:32;not null;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"-"`
+	Email     string    `gorm:"size:255" json:"email"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
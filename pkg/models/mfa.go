@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserMFA 为用户的 TOTP 两步验证，Secret 为加密后的密钥；确认首个验证码前 Enabled 为 false
+type UserMFA struct {
+	UserID    uint64     `gorm:"primaryKey" json:"-"`
+	Secret    string     `gorm:"size:255;not null" json:"-"`
+	Enabled   bool       `gorm:"not null;default:false" json:"enabled"`
+	LastStep  int64      `gorm:"not null;default:0" json:"-"`
+	EnabledAt *time.Time `json:"enabledAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode 为一次性恢复码，库里只保存摘要
+type MFARecoveryCode struct {
+	ID        uint64 `gorm:"primaryKey"`
+	UserID    uint64 `gorm:"index;not null"`
+	Hash      string `gorm:"size:64;uniqueIndex;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Permission 为系统级权限，格式为 资源:动作；与 TaskPerm（任务内成员权限）无关
+type Permission string
+
+const (
+	// PermissionAll 拥有全部权限
+	PermissionAll Permission = "*"
+
+	PermissionTasksRead        Permission = "tasks:read"
+	PermissionTasksWrite       Permission = "tasks:write"
+	PermissionUsersRead        Permission = "users:read"
+	PermissionUsersWrite       Permission = "users:write"
+	PermissionUsersImpersonate Permission = "users:impersonate"
+	PermissionAuditsRead       Permission = "audits:read"
+	PermissionRolesManage      Permission = "roles:manage"
+)
+
+var Permissions = []Permission{
+	PermissionAll,
+	PermissionTasksRead,
+	PermissionTasksWrite,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersImpersonate,
+	PermissionAuditsRead,
+	PermissionRolesManage,
+}
+
+func (p Permission) Valid() bool {
+	return slices.Contains(Permissions, p)
+}
+
+// Privileged 为 tasks 以外的管理类权限
+func (p Permission) Privileged() bool {
+	return p != PermissionTasksRead && p != PermissionTasksWrite
+}
+
+// Role 为系统角色及其权限，User.Role 引用 Name；内置角色不能删除
+type Role struct {
+	Name        UserRole     `gorm:"primaryKey;size:16" json:"name"`
+	Description string       `gorm:"size:255" json:"description"`
+	Permissions []Permission `gorm:"serializer:json;type:jsonb" json:"permissions"`
+	BuiltIn     bool         `gorm:"not null;default:false" json:"builtIn"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+func (r *Role) Has(p Permission) bool {
+	return slices.Contains(r.Permissions, PermissionAll) || slices.Contains(r.Permissions, p)
+}
+
+// Privileged 拥有任一管理类权限的角色视为管理人员，不能被其他管理员封禁、删除或模拟登录
+func (r *Role) Privileged() bool {
+	return slices.ContainsFunc(r.Permissions, Permission.Privileged)
+}
+
+// BuiltInRoles 在首次启动时写入，之后可修改权限但不能删除
+var BuiltInRoles = []Role{
+	{
+		Name:        UserRoleUser,
+		Description: "普通用户",
+		Permissions: []Permission{PermissionTasksRead, PermissionTasksWrite},
+		BuiltIn:     true,
+	},
+	{
+		Name:        UserRoleAdmin,
+		Description: "管理员",
+		Permissions: []Permission{PermissionAll},
+		BuiltIn:     true,
+	},
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Session 对应一次登录，access/refresh token 通过 sid 声明引用它；撤销后令牌立即失效
+type Session struct {
+	ID         string     `gorm:"primaryKey;size:32" json:"id"`
+	UserID     uint64     `gorm:"index;not null" json:"-"`
+	Device     string     `gorm:"size:128" json:"device"`
+	UserAgent  string     `gorm:"size:500" json:"userAgent,omitempty"`
+	IP         string     `gorm:"size:45" json:"ip,omitempty"`
+	Location   string     `gorm:"size:128" json:"location,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+
+	// Current 标记发起请求的会话，不入库
+	Current bool `gorm:"-" json:"current"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// RefreshToken 为不透明的一次性 refresh token，库里只保存摘要。
+// 同一会话内轮换产生的 token 属于同一个家族（FamilyID 即会话 ID），旧 token 被重复使用时整个家族失效
+type RefreshToken struct {
+	Hash      string    `gorm:"primaryKey;size:64"`
+	FamilyID  string    `gorm:"index;size:32;not null"`
+	UserID    uint64    `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
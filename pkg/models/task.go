@@ -2,6 +2,9 @@ package models
 
 import (
 	"errors"
+	"net"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -13,15 +16,27 @@ const (
 )
 
 type Task struct {
-	ID        uint64     `gorm:"primaryKey" json:"id"`
-	Name      string     `gorm:"size:100;not null" json:"name"`
-	TaskKey   string     `gorm:"size:128;uniqueIndex;not null" json:"-"`
+	ID   uint64 `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"size:100;not null" json:"name"`
+
+	// key 只保存公开前缀与 HMAC 哈希，明文仅在生成时返回一次
+	KeyPrefix string `gorm:"size:32" json:"keyPrefix"`
+	KeyHash   string `gorm:"size:64;uniqueIndex" json:"-"`
+
+	// 轮换后旧 key 在 PrevKeyExpiresAt 之前仍然可用
+	PrevKeyPrefix    string     `gorm:"size:32" json:"prevKeyPrefix,omitempty"`
+	PrevKeyHash      string     `gorm:"size:64;index" json:"-"`
+	PrevKeyExpiresAt *time.Time `json:"prevKeyExpiresAt,omitempty"`
+
 	Status    TaskStatus `gorm:"default:1" json:"status"`
 	Remark    string     `gorm:"size:500" json:"remark,omitempty"`
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt *time.Time `gorm:"index" json:"-"`
 
+	KeyPolicy KeyPolicy      `gorm:"embedded;embeddedPrefix:key_" json:"keyPolicy"`
+	Lookup    LookupDefaults `gorm:"embedded;embeddedPrefix:lookup_" json:"lookup"`
+
 	Users []UserTask `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"users,omitempty"`
 	Items []TaskItem `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE" json:"task_items,omitempty"`
 }
@@ -30,16 +45,268 @@ func (Task) TableName() string {
 	return "tasks"
 }
 
+// PrevKeyActive 旧 key 是否仍处于轮换宽限期内
+func (t *Task) PrevKeyActive(now time.Time) bool {
+	return t.PrevKeyHash != "" && t.PrevKeyExpiresAt != nil && now.Before(*t.PrevKeyExpiresAt)
+}
+
+// API key 可访问的接口范围
+const (
+	ScopeLookup = "ip:lookup"
+	ScopeBatch  = "ip:batch"
+	ScopeCheck  = "ip:check"
+)
+
+var Scopes = []string{ScopeLookup, ScopeBatch, ScopeCheck}
+
+// KeyPolicy 为 task key 的访问限制，各字段为空时表示不限制
+type KeyPolicy struct {
+	Scopes         []string   `gorm:"serializer:json;type:jsonb" json:"scopes,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	AllowedCIDRs   []string   `gorm:"serializer:json;type:jsonb" json:"allowedCidrs,omitempty"`
+	AllowedOrigins []string   `gorm:"serializer:json;type:jsonb" json:"allowedOrigins,omitempty"`
+	MaxBatchSize   int        `gorm:"default:0" json:"maxBatchSize,omitempty"`
+}
+
+func (p KeyPolicy) Expired(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt)
+}
+
+func (p KeyPolicy) AllowsScope(scope string) bool {
+	if len(p.Scopes) == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (p KeyPolicy) AllowsIP(ip string) bool {
+	if len(p.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range p.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin 配置了 AllowedOrigins 后，key 只能在这些来源的浏览器页面中使用；
+// 支持 https://*.example.com 形式的子域名通配
+func (p KeyPolicy) AllowsOrigin(origin string) bool {
+	if len(p.AllowedOrigins) == 0 {
+		return true
+	}
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, allowed := range p.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		if allowed == origin {
+			return true
+		}
+		if i := strings.Index(allowed, "://*."); i >= 0 {
+			scheme, suffix := allowed[:i+3], allowed[i+4:]
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p KeyPolicy) AllowsBatch(n int) bool {
+	return p.MaxBatchSize <= 0 || n <= p.MaxBatchSize
+}
+
+// 查询结果可选的输出格式
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// LookupLangs 为 IP 库提供的地名语言
+var LookupLangs = []string{"en", "zh-CN", "de", "es", "fr", "ja", "pt-BR", "ru"}
+
+// LookupFields 为查询结果中可按需返回的字段，ip 与 err 总是返回
+var LookupFields = []string{"network", "continent", "country", "region", "city", "postal", "location", "timezone", "asn", "traits"}
+
+// LookupDefaults 为使用 task key 查询时的默认参数，请求中的参数优先；
+// 各字段零值即为未设置时的行为，因此旧缓存与新增列无需迁移
+type LookupDefaults struct {
+	// Lang 为地名语言，为空时为 en
+	Lang string `gorm:"size:8" json:"lang,omitempty"`
+	// Fields 为返回的字段，为空时全部返回
+	Fields []string `gorm:"serializer:json;type:jsonb" json:"fields,omitempty"`
+	// Format 为 json 或 csv，为空时为 json
+	Format string `gorm:"size:8" json:"format,omitempty"`
+	// OmitCIDR 为 true 时不返回 IP 所在网段的 CIDR
+	OmitCIDR bool `gorm:"default:false" json:"omitCidr"`
+	// Redact 为 true 时将经纬度降到城市级精度
+	Redact bool `gorm:"default:false" json:"redact"`
+}
+
+func (d LookupDefaults) Valid() bool {
+	if d.Lang != "" && !slices.Contains(LookupLangs, d.Lang) {
+		return false
+	}
+	if d.Format != "" && d.Format != FormatJSON && d.Format != FormatCSV {
+		return false
+	}
+	for _, f := range d.Fields {
+		if !slices.Contains(LookupFields, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// TaskRole 为成员在 task 中的角色，每个 task 有且只有一个 owner
+type TaskRole string
+
+const (
+	RoleOwner  TaskRole = "owner"
+	RoleAdmin  TaskRole = "admin"
+	RoleMember TaskRole = "member"
+	RoleViewer TaskRole = "viewer"
+)
+
+type TaskPerm int
+
+const (
+	PermViewUsage TaskPerm = iota
+	PermManageKeys
+	PermManageMembers
+	PermDeleteTask
+)
+
+var rolePerms = map[TaskRole][]TaskPerm{
+	RoleOwner:  {PermViewUsage, PermManageKeys, PermManageMembers, PermDeleteTask},
+	RoleAdmin:  {PermViewUsage, PermManageKeys, PermManageMembers},
+	RoleMember: {PermViewUsage, PermManageKeys},
+	RoleViewer: {PermViewUsage},
+}
+
+var roleRank = map[TaskRole]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func (r TaskRole) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+func (r TaskRole) Can(p TaskPerm) bool {
+	for _, perm := range rolePerms[r] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks 成员只能邀请、调整或移除角色低于自己的成员
+func (r TaskRole) Outranks(other TaskRole) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+type InviteStatus int
+
+const (
+	InvitePending InviteStatus = iota
+	InviteAccepted
+	InviteDeclined
+	InviteRevoked
+)
+
+// TaskInvite 为邮件邀请，token 只保存哈希且只能使用一次
+type TaskInvite struct {
+	ID        uint64       `gorm:"primaryKey" json:"id"`
+	TaskID    uint64       `gorm:"index;not null" json:"taskId"`
+	Email     string       `gorm:"size:255;index;not null" json:"email"`
+	Role      TaskRole     `gorm:"size:16;not null" json:"role"`
+	InviterID uint64       `gorm:"not null" json:"inviterId"`
+	TokenHash string       `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Status    InviteStatus `gorm:"default:0" json:"status"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	CreatedAt time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time    `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (TaskInvite) TableName() string {
+	return "task_invites"
+}
+
+// TaskItem 类型
+const (
+	TaskItemWatch = 1
+)
+
+// 监控项可关注的 IP 属性
+const (
+	WatchCountry   = "country"
+	WatchASN       = "asn"
+	WatchAnonymous = "anonymous"
+)
+
+var WatchFields = []string{WatchCountry, WatchASN, WatchAnonymous}
+
+// TaskItem 为 task 下的 IP 监控项：按 Schedule 或在 IP 库更新后重新解析 Targets，
+// Fields 中的属性发生变化时通知 task 成员
 type TaskItem struct {
-	ID       uint64 `gorm:"primaryKey" json:"id"`
-	TaskID   int
-	TaskType int `gorm:"default:1" json:"task_type"`
+	ID       uint64   `gorm:"primaryKey" json:"id"`
+	TaskID   uint64   `gorm:"index;not null" json:"taskId"`
+	TaskType int      `gorm:"default:1" json:"task_type"`
+	Name     string   `gorm:"size:100" json:"name"`
+	Targets  []string `gorm:"serializer:json;type:jsonb" json:"targets"`
+	Fields   []string `gorm:"serializer:json;type:jsonb" json:"fields"`
+	// Schedule 为 5 段 cron 表达式（UTC），为空时只在 IP 库更新后解析
+	Schedule string `gorm:"size:64" json:"schedule,omitempty"`
+	Enabled  bool   `gorm:"default:true" json:"enabled"`
+
+	// DBBuild 为最近一次解析所用 IP 库的构建时间
+	DBBuild   uint64     `gorm:"default:0" json:"-"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	NextRunAt *time.Time `gorm:"index" json:"nextRunAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 }
 
 func (TaskItem) TableName() string {
 	return "task_items"
 }
 
+// WatchSnapshot 为监控项某个地址的解析结果，只在属性变化时保存新的一条
+type WatchSnapshot struct {
+	ID        uint64            `gorm:"primaryKey" json:"id"`
+	ItemID    uint64            `gorm:"index:idx_watch_item_ip;not null" json:"itemId"`
+	IP        string            `gorm:"size:45;index:idx_watch_item_ip;not null" json:"ip"`
+	Values    map[string]string `gorm:"serializer:json;type:jsonb" json:"values"`
+	DBBuild   uint64            `json:"dbBuild"`
+	CreatedAt time.Time         `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (WatchSnapshot) TableName() string {
+	return "watch_snapshots"
+}
+
 var (
 	ErrTaskNotFound      = errors.New("task not found")
 	ErrTaskAlreadyExists = errors.New("task already exists")
@@ -26,9 +26,33 @@ func (l Level) String() string {
 	}
 }
 
+func (l Level) Valid() bool {
+	return l >= LevelBasic && l <= LevelTop
+}
+
+// ApiCache 为 apiKey:<hash> 缓存内容，只由 apikey.Store 写入；
+// 余额变化频繁，不进缓存，始终以数据库为准
 type ApiCache struct {
-	UserLevel Level `json:"userLevel"`
-	Quota     int   `json:"quota"`
+	TaskID    uint64         `json:"taskId,omitempty"`
+	KeyID     string         `json:"keyId,omitempty"`
+	UserID    uint64         `json:"userId,omitempty"`
+	UserLevel Level          `json:"userLevel"`
+	Policy    KeyPolicy      `json:"policy"`
+	Lookup    LookupDefaults `json:"lookup"`
+
+	// Key 为本次请求 API key 的哈希，不写入缓存
+	Key string `json:"-"`
+}
+
+func NewApiCache(t *Task, userID uint64, level Level) ApiCache {
+	return ApiCache{
+		TaskID:    t.ID,
+		KeyID:     t.KeyPrefix,
+		UserID:    userID,
+		UserLevel: level,
+		Policy:    t.KeyPolicy,
+		Lookup:    t.Lookup,
+	}
 }
 
 type UserStatus int
@@ -39,6 +63,14 @@ const (
 	StatusBanned
 )
 
+// UserRole 为账号在系统中的角色，与 task 成员角色无关
+type UserRole string
+
+const (
+	UserRoleUser  UserRole = "user"
+	UserRoleAdmin UserRole = "admin"
+)
+
 type LogType int
 
 const (
@@ -48,6 +80,13 @@ const (
 	LogTypeLogout
 	LogTypeResetPassword
 	LogTypeCreateTask
+	LogTypeRotateKey
+	LogTypeChangePassword
+	LogTypeChangeEmail
+	LogTypeRevertEmail
+	LogTypeEnableMFA
+	LogTypeDisableMFA
+	LogTypeLinkIdentity
 )
 
 type User struct {
@@ -58,6 +97,7 @@ type User struct {
 	Level     Level      `gorm:"default:0" json:"level"`
 	Quota     int        `gorm:"default:0" json:"quota"`
 	Status    UserStatus `gorm:"default:0" json:"status"`
+	Role      UserRole   `gorm:"size:16;not null;default:user" json:"role"`
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 	DeletedAt *time.Time `gorm:"index" json:"-"`
@@ -85,9 +125,11 @@ func (UserLog) TableName() string {
 }
 
 type UserTask struct {
-	ID        uint64    `gorm:"primaryKey" json:"id"`
-	UserID    uint64    `gorm:"index;not null" json:"userId"`
-	TaskID    uint64    `gorm:"index;not null" json:"taskId"`
+	ID     uint64 `gorm:"primaryKey" json:"id"`
+	UserID uint64 `gorm:"index;not null" json:"userId"`
+	TaskID uint64 `gorm:"index;not null" json:"taskId"`
+	// 已有的关联都是创建者，迁移时默认为 owner
+	Role      TaskRole  `gorm:"size:16;not null;default:owner" json:"role"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
 }
 
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// webhook 事件
+const (
+	EventKeyRotated   = "key.rotated"
+	EventQuotaLow     = "quota.low"
+	EventBulkFinished = "bulk.finished"
+	EventWatchChanged = "watch.changed"
+	EventMemberJoined = "member.joined"
+)
+
+var WebhookEvents = []string{EventKeyRotated, EventQuotaLow, EventBulkFinished, EventWatchChanged, EventMemberJoined}
+
+type TaskWebhook struct {
+	ID     uint64   `gorm:"primaryKey" json:"id"`
+	TaskID uint64   `gorm:"index;not null" json:"taskId"`
+	URL    string   `gorm:"size:500;not null" json:"url"`
+	Events []string `gorm:"serializer:json;type:jsonb" json:"events"`
+	// Secret 用于签名，只在创建时返回一次
+	Secret    string    `gorm:"size:64;not null" json:"-"`
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (TaskWebhook) TableName() string {
+	return "task_webhooks"
+}
+
+func (w *TaskWebhook) Subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus int
+
+const (
+	DeliveryPending DeliveryStatus = iota
+	DeliverySucceeded
+	DeliveryFailed
+)
+
+// WebhookDelivery 为一次投递及其最近一次尝试的结果，Payload 在创建时固定，重试与重放发送相同内容
+type WebhookDelivery struct {
+	ID           uint64         `gorm:"primaryKey" json:"id"`
+	WebhookID    uint64         `gorm:"index;not null" json:"webhookId"`
+	TaskID       uint64         `gorm:"index;not null" json:"taskId"`
+	Event        string         `gorm:"size:32;not null" json:"event"`
+	Payload      string         `gorm:"type:text" json:"payload"`
+	Status       DeliveryStatus `gorm:"default:0" json:"status"`
+	Attempts     int            `gorm:"default:0" json:"attempts"`
+	ResponseCode int            `gorm:"default:0" json:"responseCode"`
+	Error        string         `gorm:"size:500" json:"error,omitempty"`
+	ReplayOf     uint64         `gorm:"default:0" json:"replayOf,omitempty"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime;index" json:"createdAt"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
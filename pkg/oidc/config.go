@@ -0,0 +1,23 @@
+package oidc
+
+type Config struct {
+	Providers []ProviderConfig `yaml:"providers"`
+}
+
+type ProviderConfig struct {
+	// Name 出现在登录地址中，如 /v1/auth/oauth/google
+	Name string `yaml:"name"`
+	// Kind 为 oidc、google 或 github，未配置时为 oidc
+	Kind         string   `yaml:"kind"`
+	ClientID     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+
+	// Issuer 为 OIDC 发行方，据此读取 /.well-known/openid-configuration；google 可不填
+	Issuer string `yaml:"issuer"`
+
+	// 以下地址用于 github 或覆盖默认值，通常不需要配置
+	AuthURL  string `yaml:"authUrl"`
+	TokenURL string `yaml:"tokenUrl"`
+	APIURL   string `yaml:"apiUrl"`
+}
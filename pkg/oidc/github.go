@@ -0,0 +1,110 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	githubAPIURL   = "https://api.github.com"
+)
+
+// githubProvider 使用 GitHub OAuth2；GitHub 不签发 ID token，身份与已验证邮箱来自 REST API
+type githubProvider struct {
+	cfg         ProviderConfig
+	redirectURI string
+	client      *http.Client
+}
+
+func newGitHub(cfg ProviderConfig, redirectURI string, client *http.Client) *githubProvider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = githubAuthURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = githubTokenURL
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = githubAPIURL
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	return &githubProvider{cfg: cfg, redirectURI: redirectURI, client: client}
+}
+
+func (p *githubProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *githubProvider) AuthCodeURL(_ context.Context, req *AuthRequest) (string, error) {
+	q := url.Values{
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.redirectURI},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {req.State},
+		"code_challenge":        {Challenge(req.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return withQuery(p.cfg.AuthURL, q), nil
+}
+
+func (p *githubProvider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Identity, error) {
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	form := url.Values{
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {req.Verifier},
+	}
+	if err := exchangeCode(ctx, p.client, p.cfg.TokenURL, form, &tok); err != nil {
+		return nil, err
+	}
+	// GitHub 出错时也返回 200，错误放在 error 字段
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%w: %s", ErrExchange, tok.Error)
+	}
+	header := http.Header{"Authorization": {"Bearer " + tok.AccessToken}}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.client, p.cfg.APIURL+"/user", header, &user); err != nil {
+		return nil, fmt.Errorf("github user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: missing github user id", ErrExchange)
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client, p.cfg.APIURL+"/user/emails", header, &emails); err != nil {
+		return nil, fmt.Errorf("github emails: %w", err)
+	}
+
+	id := &Identity{Provider: p.cfg.Name, Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if id.Name == "" {
+		id.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			id.Email, id.EmailVerified = e.Email, e.Verified
+			break
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type discovery struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// oidcProvider 为标准 OIDC 发行方，端点来自 discovery 文档
+type oidcProvider struct {
+	cfg         ProviderConfig
+	redirectURI string
+	client      *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys *keySet
+}
+
+func newOIDC(cfg ProviderConfig, redirectURI string, client *http.Client) *oidcProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &oidcProvider{cfg: cfg, redirectURI: redirectURI, client: client}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+// discover 首次使用时读取 discovery 文档，失败时下次重试
+func (p *oidcProvider) discover(ctx context.Context) (*discovery, *keySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.keys, nil
+	}
+
+	var meta discovery
+	if err := getJSON(ctx, p.client, p.cfg.Issuer+"/.well-known/openid-configuration", nil, &meta); err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("oidc discovery: issuer mismatch %q", meta.Issuer)
+	}
+	if p.cfg.AuthURL != "" {
+		meta.AuthURL = p.cfg.AuthURL
+	}
+	if p.cfg.TokenURL != "" {
+		meta.TokenURL = p.cfg.TokenURL
+	}
+	if meta.AuthURL == "" || meta.TokenURL == "" || meta.JWKSURL == "" {
+		return nil, nil, fmt.Errorf("oidc discovery: missing endpoints")
+	}
+	p.meta = &meta
+	p.keys = newKeySet(meta.JWKSURL, p.client)
+	return p.meta, p.keys, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.redirectURI},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {Challenge(req.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return withQuery(meta.AuthURL, q), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Identity, error) {
+	meta, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURI},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {req.Verifier},
+	}
+	if err := exchangeCode(ctx, p.client, meta.TokenURL, form, &tok); err != nil {
+		return nil, err
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing id_token", ErrExchange)
+	}
+	return p.verify(ctx, keys, tok.IDToken, req.Nonce)
+}
+
+type idClaims struct {
+	Email         string          `json:"email"`
+	EmailVerified json.RawMessage `json:"email_verified"`
+	Name          string          `json:"name"`
+	Nonce         string          `json:"nonce"`
+	AuthorizedBy  string          `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// verify 校验签名、iss、aud、exp 与 nonce
+func (p *oidcProvider) verify(ctx context.Context, keys *keySet, raw, nonce string) (*Identity, error) {
+	var claims idClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(idTokenMethods),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	return &Identity{
+		Provider:      p.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: parseBool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// parseBool 兼容部分发行方把 email_verified 写成字符串
+func parseBool(raw json.RawMessage) bool {
+	s := strings.Trim(string(raw), `"`)
+	return s == "true"
+}
+
+func withQuery(base string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + q.Encode()
+}
@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer 为本地的 OIDC 发行方：discovery、JWKS 与 token 端点，token 端点校验 PKCE
+type mockIssuer struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// claims 覆盖签发的 ID token 中的声明
+	claims jwt.MapClaims
+	// signWith 不为空时用它签名，模拟不在 JWKS 中的密钥
+	signWith *rsa.PrivateKey
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		pub := m.key.PublicKey
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("code") != "good-code" ||
+			r.FormValue("client_id") != "client" || r.FormValue("client_secret") != "secret" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if Challenge(r.FormValue("code_verifier")) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant","error_description":"pkce"}`, http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            m.srv.URL,
+			"aud":            "client",
+			"sub":            "user-1",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice",
+			"nonce":          m.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		signer := m.key
+		if m.signWith != nil {
+			signer = m.signWith
+		}
+		raw, err := tok.SignedString(signer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": raw})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// authorize 模拟浏览器跳转：从授权地址中取出 challenge 与 nonce，交给 token 端点校验
+func (m *mockIssuer) authorize(t *testing.T, p Provider, req *AuthRequest) {
+	t.Helper()
+	raw, err := p.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != req.State || q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != "https://app.test/cb" {
+		t.Fatalf("unexpected auth url %s", raw)
+	}
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+}
+
+func newTestProvider(t *testing.T, m *mockIssuer) Provider {
+	t.Helper()
+	p, err := New(ProviderConfig{Name: "mock", ClientID: "client", ClientSecret: "secret", Issuer: m.srv.URL}, "https://app.test/cb", m.srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	p := newTestProvider(t, m)
+	req := NewAuthRequest()
+	m.authorize(t, p, req)
+
+	id, err := p.Exchange(context.Background(), "good-code", req)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "mock", Subject: "user-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *id != want {
+		t.Errorf("Exchange = %+v, want %+v", *id, want)
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cases := []struct {
+		name    string
+		setup   func(m *mockIssuer, req *AuthRequest)
+		wantErr error
+	}{
+		{"wrong pkce verifier", func(m *mockIssuer, req *AuthRequest) { req.Verifier = "tampered" }, ErrExchange},
+		{"nonce mismatch", func(m *mockIssuer, req *AuthRequest) { req.Nonce = "other" }, ErrInvalidIDToken},
+		{"wrong audience", func(m *mockIssuer, req *AuthRequest) { m.claims = jwt.MapClaims{"aud": "someone-else"} }, ErrInvalidIDToken},
+		{"wrong issuer", func(m *mockIssuer, req *AuthRequest) { m.claims = jwt.MapClaims{"iss": "https://evil.test"} }, ErrInvalidIDToken},
+		{"expired", func(m *mockIssuer, req *AuthRequest) {
+			m.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+		}, ErrInvalidIDToken},
+		{"unknown signing key", func(m *mockIssuer, req *AuthRequest) { m.signWith = other }, ErrInvalidIDToken},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			p := newTestProvider(t, m)
+			req := NewAuthRequest()
+			m.authorize(t, p, req)
+			tc.setup(m, req)
+
+			if _, err := p.Exchange(context.Background(), "good-code", req); !errors.Is(err, tc.wantErr) {
+				t.Errorf("Exchange err = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitHubExchange(t *testing.T) {
+	var challenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || Challenge(r.FormValue("code_verifier")) != challenge {
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_test"})
+	})
+	mux.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 42, "login": "octocat"})
+	})
+	mux.HandleFunc("/api/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "octo@example.com", "primary": true, "verified": true},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p, err := New(ProviderConfig{
+		Name: "github", Kind: "github", ClientID: "client", ClientSecret: "secret",
+		AuthURL: srv.URL + "/login/oauth/authorize", TokenURL: srv.URL + "/login/oauth/access_token", APIURL: srv.URL + "/api",
+	}, "https://app.test/cb", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := NewAuthRequest()
+	raw, _ := p.AuthCodeURL(context.Background(), req)
+	u, _ := url.Parse(raw)
+	challenge = u.Query().Get("code_challenge")
+
+	id, err := p.Exchange(context.Background(), "good-code", req)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "github", Subject: "42", Email: "octo@example.com", EmailVerified: true, Name: "octocat"}
+	if *id != want {
+		t.Errorf("Exchange = %+v, want %+v", *id, want)
+	}
+
+	if _, err := p.Exchange(context.Background(), "bad-code", req); !errors.Is(err, ErrExchange) {
+		t.Errorf("Exchange(bad code) err = %v, want ErrExchange", err)
+	}
+}
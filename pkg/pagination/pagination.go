@@ -0,0 +1,224 @@
+// Package pagination 提供基于 (created_at, id) 的游标分页。
+// 游标对客户端不透明并带 HMAC 签名，筛选与排序只接受列表声明的白名单。
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"asum/pkg/errorx"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Config struct {
+	// Secret 为游标签名密钥，多实例部署须一致；为空时使用进程内随机密钥，重启后旧游标失效
+	Secret string `yaml:"secret"`
+}
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 100
+	maxFilterValue = 100
+
+	cursorBody = 17
+	macSize    = 12
+)
+
+var signKey = func() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// Configure 在启动时设置签名密钥
+func Configure(conf Config) {
+	if conf.Secret == "" {
+		return
+	}
+	sum := sha256.Sum256([]byte("pagination:" + conf.Secret))
+	signKey = sum[:]
+}
+
+// Cursor 指向上一页最后一条记录
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint64
+}
+
+// Filter 为一个可筛选的查询参数
+type Filter struct {
+	Column string
+	// Like 为不区分大小写的包含匹配
+	Like bool
+	// Int 要求参数为整数
+	Int bool
+}
+
+// Spec 描述一个列表可接受的参数
+type Spec struct {
+	// Name 参与签名，一个列表的游标不能用于另一个列表
+	Name string
+	// Table 用于连表查询时限定 created_at 与 id 的表名
+	Table   string
+	Filters map[string]Filter
+}
+
+type Params struct {
+	Limit   int
+	Desc    bool
+	After   *Cursor
+	Filters map[string]any
+
+	spec *Spec
+}
+
+// Page 为一页结果，Next 为空表示没有更多数据
+type Page[T any] struct {
+	List []T
+	Next string
+}
+
+// Parse 读取 limit、cursor、sort 以及 spec 中声明的筛选参数；
+// sort 只接受 created_at 与 -created_at（默认），未声明的参数忽略
+func Parse(c fiber.Ctx, spec *Spec) (*Params, error) {
+	p := &Params{
+		Limit:   fiber.Query[int](c, "limit", defaultLimit),
+		Desc:    true,
+		Filters: map[string]any{},
+		spec:    spec,
+	}
+	if p.Limit < 1 || p.Limit > maxLimit {
+		return nil, errorx.ErrInvalidFilter
+	}
+
+	switch c.Query("sort") {
+	case "", "-created_at":
+	case "created_at":
+		p.Desc = false
+	default:
+		return nil, errorx.ErrInvalidFilter
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cur, desc, err := decode(spec.Name, raw)
+		if err != nil || desc != p.Desc {
+			return nil, errorx.ErrInvalidCursor
+		}
+		p.After = &cur
+	}
+
+	for param, f := range spec.Filters {
+		raw := strings.TrimSpace(c.Query(param))
+		if raw == "" {
+			continue
+		}
+		if len(raw) > maxFilterValue {
+			return nil, errorx.ErrInvalidFilter
+		}
+		if f.Int {
+			v, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, errorx.ErrInvalidFilter
+			}
+			p.Filters[param] = v
+			continue
+		}
+		p.Filters[param] = raw
+	}
+	return p, nil
+}
+
+// Scope 为 gorm 查询加上筛选、游标条件、排序与 limit+1（多取一条用于判断是否还有下一页）
+func (p *Params) Scope(tx *gorm.DB) *gorm.DB {
+	for param, v := range p.Filters {
+		f := p.spec.Filters[param]
+		if f.Like {
+			tx = tx.Where(f.Column+" ILIKE ?", "%"+EscapeLike(v.(string))+"%")
+			continue
+		}
+		tx = tx.Where(f.Column+" = ?", v)
+	}
+
+	createdAt, id := p.column("created_at"), p.column("id")
+	dir, op := "ASC", ">"
+	if p.Desc {
+		dir, op = "DESC", "<"
+	}
+	if p.After != nil {
+		tx = tx.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", createdAt, id, op), p.After.CreatedAt, p.After.ID)
+	}
+	return tx.Order(createdAt + " " + dir).Order(id + " " + dir).Limit(p.Limit + 1)
+}
+
+func (p *Params) column(name string) string {
+	if p.spec.Table == "" {
+		return name
+	}
+	return p.spec.Table + "." + name
+}
+
+// Filter 返回字符串筛选值，供不走 SQL 的列表自行筛选
+func (p *Params) Filter(param string) string {
+	v, _ := p.Filters[param].(string)
+	return v
+}
+
+// Cut 截掉 Scope 多取的一条，并在还有数据时生成下一页游标
+func Cut[T any](p *Params, rows []T, key func(*T) Cursor) *Page[T] {
+	page := &Page[T]{List: rows}
+	if len(rows) <= p.Limit {
+		return page
+	}
+	page.List = rows[:p.Limit]
+	page.Next = p.Encode(key(&page.List[p.Limit-1]))
+	return page
+}
+
+// Encode 生成指向 cur 的游标
+func (p *Params) Encode(cur Cursor) string {
+	buf := make([]byte, cursorBody, cursorBody+macSize)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(cur.CreatedAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[8:16], cur.ID)
+	if p.Desc {
+		buf[16] = 1
+	}
+	buf = append(buf, sign(p.spec.Name, buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decode(name, raw string) (Cursor, bool, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(buf) != cursorBody+macSize {
+		return Cursor{}, false, errorx.ErrInvalidCursor
+	}
+	if !hmac.Equal(buf[cursorBody:], sign(name, buf[:cursorBody])) {
+		return Cursor{}, false, errorx.ErrInvalidCursor
+	}
+	cur := Cursor{
+		CreatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(buf[0:8]))),
+		ID:        binary.BigEndian.Uint64(buf[8:16]),
+	}
+	return cur, buf[16] == 1, nil
+}
+
+func sign(name string, body []byte) []byte {
+	mac := hmac.New(sha256.New, signKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(body)
+	return mac.Sum(nil)[:macSize]
+}
+
+// EscapeLike 转义 LIKE 中的通配符
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
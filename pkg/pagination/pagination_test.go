@@ -0,0 +1,50 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	spec := &Spec{Name: "tasks"}
+	p := &Params{Limit: 2, Desc: true, spec: spec}
+	want := Cursor{CreatedAt: time.Date(2024, 5, 1, 8, 30, 0, 123456000, time.UTC), ID: 42}
+
+	raw := p.Encode(want)
+	got, desc, err := decode(spec.Name, raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID || !desc {
+		t.Fatalf("decode = %+v desc=%v, want %+v desc=true", got, desc, want)
+	}
+
+	if _, _, err := decode("members", raw); err == nil {
+		t.Fatal("cursor accepted by another list")
+	}
+	tampered := []byte(raw)
+	tampered[3] ^= 1
+	if _, _, err := decode(spec.Name, string(tampered)); err == nil {
+		t.Fatal("tampered cursor accepted")
+	}
+}
+
+func TestCut(t *testing.T) {
+	type row struct{ id uint64 }
+	key := func(r *row) Cursor { return Cursor{CreatedAt: time.Unix(int64(r.id), 0), ID: r.id} }
+	p := &Params{Limit: 2, Desc: true, spec: &Spec{Name: "t"}}
+
+	page := Cut(p, []row{{3}, {2}, {1}}, key)
+	if len(page.List) != 2 || page.Next == "" {
+		t.Fatalf("full page: len=%d next=%q", len(page.List), page.Next)
+	}
+	cur, _, err := decode("t", page.Next)
+	if err != nil || cur.ID != 2 {
+		t.Fatalf("next cursor = %+v, %v; want id 2", cur, err)
+	}
+
+	page = Cut(p, []row{{1}}, key)
+	if len(page.List) != 1 || page.Next != "" {
+		t.Fatalf("last page: len=%d next=%q", len(page.List), page.Next)
+	}
+}
@@ -0,0 +1,295 @@
+// Package rbac 维护系统角色与权限。
+// 角色存放在 Postgres，每个实例在内存中保留一份；修改只经由 Store 写入，
+// 并通过 Redis 频道通知所有实例重新加载。用户的角色与状态按请求解析，在内存中缓存 userTTL。
+package rbac
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	channel    = "rbac:invalidate"
+	msgRoles   = "roles"
+	msgUserPfx = "user:"
+
+	// userTTL 为用户角色在内存中的缓存时间，错过失效通知时最多延迟这么久生效
+	userTTL = time.Minute
+)
+
+var roleNameRe = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,15}$`)
+
+type member struct {
+	role    models.UserRole
+	active  bool
+	expires time.Time
+}
+
+type Store struct {
+	db  *db.DB
+	rdb *rdb.Client
+
+	mu    sync.RWMutex
+	roles map[models.UserRole]*models.Role
+	users map[uint64]member
+}
+
+func NewStore(pg *db.DB, cache *rdb.Client) *Store {
+	if err := pg.AutoMigrate(&models.Role{}); err != nil {
+		panic(err)
+	}
+	s := &Store{db: pg, rdb: cache, users: map[uint64]member{}}
+	ctx := context.Background()
+	if err := s.seed(ctx); err != nil {
+		panic(err)
+	}
+	if err := s.Load(ctx); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// seed 写入缺失的内置角色，已存在的保持管理员修改过的权限
+func (s *Store) seed(ctx context.Context) error {
+	for _, r := range models.BuiltInRoles {
+		role := r
+		if err := s.db.WithContext(ctx).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load 从数据库重新加载全部角色，并清空用户缓存
+func (s *Store) Load(ctx context.Context) error {
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Find(&roles).Error; err != nil {
+		return err
+	}
+	m := make(map[models.UserRole]*models.Role, len(roles))
+	for i := range roles {
+		m[roles[i].Name] = &roles[i]
+	}
+
+	s.mu.Lock()
+	s.roles = m
+	s.users = map[uint64]member{}
+	s.mu.Unlock()
+	return nil
+}
+
+// RoleCan 判断角色是否拥有权限，未知角色没有任何权限
+func (s *Store) RoleCan(role models.UserRole, perm models.Permission) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.roles[role]
+	return ok && r.Has(perm)
+}
+
+// Privileged 判断角色是否拥有管理类权限
+func (s *Store) Privileged(role models.UserRole) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.roles[role]
+	return ok && r.Privileged()
+}
+
+// Allowed 判断用户当前是否拥有全部 perms；未激活、已封禁或已删除的用户没有任何权限
+func (s *Store) Allowed(ctx context.Context, userID uint64, perms ...models.Permission) (bool, error) {
+	m, err := s.member(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !m.active {
+		return false, nil
+	}
+	for _, p := range perms {
+		if !s.RoleCan(m.role, p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *Store) member(ctx context.Context, userID uint64) (member, error) {
+	now := time.Now()
+	s.mu.RLock()
+	m, ok := s.users[userID]
+	s.mu.RUnlock()
+	if ok && now.Before(m.expires) {
+		return m, nil
+	}
+
+	var u models.User
+	err := s.db.WithContext(ctx).
+		Select("id", "role", "status").
+		Where("id = ? AND deleted_at IS NULL", userID).
+		First(&u).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return member{}, err
+	}
+	m = member{role: u.Role, active: err == nil && u.Status == models.StatusActive, expires: now.Add(userTTL)}
+
+	s.mu.Lock()
+	s.users[userID] = m
+	s.mu.Unlock()
+	return m, nil
+}
+
+// Roles 返回全部角色，按名称排序
+func (s *Store) Roles() []models.Role {
+	s.mu.RLock()
+	out := make([]models.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		out = append(out, *r)
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(out, func(a, b models.Role) int { return strings.Compare(string(a.Name), string(b.Name)) })
+	return out
+}
+
+// SaveRole 创建或修改角色；内置角色只能修改描述与权限
+func (s *Store) SaveRole(ctx context.Context, role *models.Role) error {
+	if !roleNameRe.MatchString(string(role.Name)) {
+		return errorx.ErrInvalidRoleName
+	}
+	perms := make([]models.Permission, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		if !p.Valid() {
+			return errorx.ErrInvalidPermission
+		}
+		if !slices.Contains(perms, p) {
+			perms = append(perms, p)
+		}
+	}
+	role.Permissions = perms
+	// 管理员角色须保留全部权限，避免把所有人锁在管理接口之外
+	if role.Name == models.UserRoleAdmin && !role.Has(models.PermissionAll) {
+		return errorx.ErrInvalidPermission
+	}
+	role.BuiltIn = slices.ContainsFunc(models.BuiltInRoles, func(r models.Role) bool { return r.Name == role.Name })
+
+	if err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description", "permissions", "updated_at"}),
+		}).
+		Create(role).Error; err != nil {
+		return err
+	}
+	return s.invalidate(ctx, msgRoles)
+}
+
+// DeleteRole 只能删除没有用户使用的自定义角色
+func (s *Store) DeleteRole(ctx context.Context, name models.UserRole) error {
+	s.mu.RLock()
+	r, ok := s.roles[name]
+	s.mu.RUnlock()
+	if !ok {
+		return errorx.ErrRoleNotFound
+	}
+	if r.BuiltIn {
+		return errorx.ErrRoleBuiltIn
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("role = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errorx.ErrRoleInUse
+	}
+	if err := s.db.WithContext(ctx).Where("name = ?", name).Delete(&models.Role{}).Error; err != nil {
+		return err
+	}
+	return s.invalidate(ctx, msgRoles)
+}
+
+// AssignRole 修改用户的角色
+func (s *Store) AssignRole(ctx context.Context, userID uint64, role models.UserRole) error {
+	s.mu.RLock()
+	_, ok := s.roles[role]
+	s.mu.RUnlock()
+	if !ok {
+		return errorx.ErrRoleNotFound
+	}
+	if err := s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("role", role).Error; err != nil {
+		return err
+	}
+	return s.InvalidateUser(ctx, userID)
+}
+
+// InvalidateUser 在用户状态（封禁、删除）变化后调用，使各实例重新读取该用户
+func (s *Store) InvalidateUser(ctx context.Context, userID uint64) error {
+	return s.invalidate(ctx, msgUserPfx+strconv.FormatUint(userID, 10))
+}
+
+// invalidate 先在本实例生效，再通知其他实例
+func (s *Store) invalidate(ctx context.Context, msg string) error {
+	if err := s.apply(ctx, msg); err != nil {
+		return err
+	}
+	return s.rdb.Publish(ctx, channel, msg).Err()
+}
+
+func (s *Store) apply(ctx context.Context, msg string) error {
+	if msg == msgRoles {
+		return s.Load(ctx)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(msg, msgUserPfx), 10, 64)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	delete(s.users, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// RunSubscriber 接收其他实例的失效通知；每隔 interval 全量重新加载一次，兜底错过的通知
+func (s *Store) RunSubscriber(ctx context.Context, interval time.Duration) error {
+	sub := s.rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+	msgs := sub.Channel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			if err := s.apply(ctx, msg.Payload); err != nil {
+				logx.Errorf("apply rbac invalidation %q: %v", msg.Payload, err)
+			}
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				logx.Errorf("reload roles: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package schedule
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// Cron 为标准 5 段 cron 表达式：分 时 日 月 周，支持 *、数字、a-b 范围、逗号列表与 /n 步长；
+// 日与周同时指定时满足其一即可
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type bounds struct{ min, max int }
+
+var fieldBounds = []bounds{
+	{0, 59}, // 分
+	{0, 23}, // 时
+	{1, 31}, // 日
+	{1, 12}, // 月
+	{0, 6},  // 周，0 为周日
+}
+
+// Parse 解析 cron 表达式，另支持 @hourly、@daily、@weekly、@monthly
+func Parse(expr string) (*Cron, error) {
+	switch strings.TrimSpace(expr) {
+	case "@hourly":
+		expr = "0 * * * *"
+	case "@daily":
+		expr = "0 0 * * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrInvalidCron
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseField(f, fieldBounds[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 周日也可以写成 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, ErrInvalidCron
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := b.min, b.max
+		upper := b.max
+		if b.max == 6 {
+			upper = 7
+		}
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			ends := strings.SplitN(rng, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(ends[0])
+			hi, err2 = strconv.Atoi(ends[1])
+			if err1 != nil || err2 != nil {
+				return 0, ErrInvalidCron
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, ErrInvalidCron
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > upper || lo > hi {
+			return 0, ErrInvalidCron
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := has(c.dom, t.Day())
+	dowOK := has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// Next 返回严格晚于 t 的下一个触发时间（按 t 的时区计算），五年内无匹配时返回零值
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,53 @@
+package session
+
+import "strings"
+
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"okhttp/", "OkHttp"},
+		{"Go-http-client/", "Go"},
+		{"python-requests/", "Python"},
+	}
+	platforms = []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DeviceName 从 User-Agent 粗略推断设备名，如 "Chrome on macOS"；无法识别时返回 "Unknown"
+func DeviceName(ua string) string {
+	var browser, platform string
+	for _, b := range browsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown"
+}
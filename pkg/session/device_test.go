@@ -0,0 +1,31 @@
+package session
+
+import "testing"
+
+func TestDeviceName(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", "Firefox on Linux"},
+		{"curl/8.7.1", "curl"},
+		{"", "Unknown"},
+	}
+	for _, tc := range cases {
+		if got := DeviceName(tc.ua); got != tc.want {
+			t.Errorf("DeviceName(%q) = %q, want %q", tc.ua, got, tc.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("上海市", 7); got != "上海" {
+		t.Errorf("truncate = %q, want %q", got, "上海")
+	}
+	if got := truncate("abc", 5); got != "abc" {
+		t.Errorf("truncate = %q, want %q", got, "abc")
+	}
+}
@@ -0,0 +1,358 @@
+// Package session 记录每次登录产生的会话。
+// 会话存放在 Postgres，Redis 中按 sid 缓存其归属用户（已撤销的缓存为墓碑），
+// 鉴权中间件每个请求只读一次 Redis；缓存缺失时回源数据库并回填。
+// 每个会话同时是一个 refresh token 家族，refresh token 每用一次轮换一次，见 Rotate。
+package session
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/rdb"
+	"asum/pkg/utils"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	keyPrefix  = "session:"
+	seenPrefix = "session:seen:"
+	tombstone  = "revoked"
+
+	// seenInterval 内最多写一次 last_seen_at
+	seenInterval = 5 * time.Minute
+	// retention 为会话过期后保留的时间，便于回看登录设备
+	retention = 30 * 24 * time.Hour
+)
+
+// setUnlessRevoked 在键不是墓碑时写入，避免回填或轮换覆盖并发写入的墓碑
+var setUnlessRevoked = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// Locator 返回 IP 的大致位置，如 "Shanghai, Shanghai, China"；查不到时返回空串
+type Locator func(ctx context.Context, ip string) string
+
+type Store struct {
+	db     *db.DB
+	rdb    *rdb.Client
+	locate Locator
+}
+
+func NewStore(pg *db.DB, cache *rdb.Client, locate Locator) *Store {
+	if err := pg.AutoMigrate(&models.Session{}, &models.RefreshToken{}); err != nil {
+		panic(err)
+	}
+	return &Store{db: pg, rdb: cache, locate: locate}
+}
+
+func cacheKey(sid string) string {
+	return keyPrefix + sid
+}
+
+// Create 为 userID 新建一个到 expiresAt 过期的会话，设备、UA、IP 与位置取自请求上下文
+func (s *Store) Create(ctx context.Context, userID uint64, device string, expiresAt time.Time) (*models.Session, error) {
+	ua, ip := utils.GetUserAgent(ctx), utils.GetRemoteIP(ctx)
+	if device == "" {
+		device = DeviceName(ua)
+	}
+	sess := &models.Session{
+		ID:         utils.GenerateRandomKey(16),
+		UserID:     userID,
+		Device:     truncate(device, 128),
+		UserAgent:  truncate(ua, 500),
+		IP:         ip,
+		LastSeenAt: time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	if s.locate != nil && ip != "" {
+		sess.Location = truncate(s.locate(ctx, ip), 128)
+	}
+	if err := s.db.WithContext(ctx).Create(sess).Error; err != nil {
+		return nil, err
+	}
+	s.cache(ctx, sess.ID, strconv.FormatUint(userID, 10), expiresAt)
+	return sess, nil
+}
+
+// Active 判断会话属于 userID 且未撤销、未过期，并按 seenInterval 刷新最后活跃时间
+func (s *Store) Active(ctx context.Context, userID uint64, sid string) (bool, error) {
+	if sid == "" {
+		return false, nil
+	}
+	owner := strconv.FormatUint(userID, 10)
+
+	val, err := s.rdb.Get(ctx, cacheKey(sid)).Result()
+	switch {
+	case err == nil:
+		if val != owner {
+			return false, nil
+		}
+	case errors.Is(err, redis.Nil):
+		sess, err := s.find(ctx, sid)
+		if errors.Is(err, errorx.ErrSessionNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if sess.RevokedAt != nil {
+			s.cache(ctx, sid, tombstone, sess.ExpiresAt)
+			return false, nil
+		}
+		s.cache(ctx, sid, strconv.FormatUint(sess.UserID, 10), sess.ExpiresAt)
+		if sess.UserID != userID {
+			return false, nil
+		}
+	default:
+		return false, err
+	}
+
+	s.touch(ctx, sid)
+	return true, nil
+}
+
+// IssueRefresh 为会话签发第一个 refresh token，有效期与会话相同
+func (s *Store) IssueRefresh(ctx context.Context, sess *models.Session) (string, error) {
+	raw := utils.GenerateConfirmToken()
+	rt := &models.RefreshToken{
+		Hash:      utils.HashToken(raw),
+		FamilyID:  sess.ID,
+		UserID:    sess.UserID,
+		ExpiresAt: sess.ExpiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(rt).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Rotate 用掉 raw 并在同一家族内签发新的 refresh token，会话有效期顺延到 expiresAt。
+// raw 已经用过时视为泄露，撤销整个会话并返回 ErrRefreshReused
+func (s *Store) Rotate(ctx context.Context, raw string, expiresAt time.Time) (*models.Session, string, error) {
+	var rt models.RefreshToken
+	err := s.db.WithContext(ctx).Where("hash = ?", utils.HashToken(raw)).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", errorx.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if rt.UsedAt != nil {
+		return nil, "", s.reused(ctx, &rt)
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return nil, "", errorx.ErrTokenInvalid
+	}
+
+	next := utils.GenerateConfirmToken()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.RefreshToken{}).
+			Where("hash = ? AND used_at IS NULL", rt.Hash).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errorx.ErrRefreshReused
+		}
+
+		res = tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ?", rt.FamilyID, now).
+			Updates(map[string]any{"expires_at": expiresAt, "last_seen_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errorx.ErrSessionRevoked
+		}
+
+		return tx.Create(&models.RefreshToken{
+			Hash:      utils.HashToken(next),
+			FamilyID:  rt.FamilyID,
+			UserID:    rt.UserID,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+	if errors.Is(err, errorx.ErrRefreshReused) {
+		// 并发请求抢先用掉了同一个 token，同样按重复使用处理
+		return nil, "", s.reused(ctx, &rt)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	sess, err := s.find(ctx, rt.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+	s.cache(ctx, sess.ID, strconv.FormatUint(sess.UserID, 10), sess.ExpiresAt)
+	return sess, next, nil
+}
+
+// reused 撤销重复使用的 refresh token 所在的家族
+func (s *Store) reused(ctx context.Context, rt *models.RefreshToken) error {
+	logx.Infof("refresh token reused: user %d session %s", rt.UserID, rt.FamilyID)
+	var sess models.Session
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL", rt.FamilyID).
+		First(&sess).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorx.ErrRefreshReused
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.revoke(ctx, []models.Session{sess}); err != nil {
+		return err
+	}
+	return errorx.ErrRefreshReused
+}
+
+// List 返回用户仍然有效的会话，最近活跃的在前
+func (s *Store) List(ctx context.Context, userID uint64) ([]models.Session, error) {
+	var list []models.Session
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+// Revoke 撤销用户的一个会话
+func (s *Store) Revoke(ctx context.Context, userID uint64, sid string) error {
+	var sess models.Session
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sid, userID).
+		First(&sess).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorx.ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.revoke(ctx, []models.Session{sess})
+}
+
+// RevokeAll 撤销用户除 except 以外的全部会话，except 为空时全部撤销，返回撤销的数量
+func (s *Store) RevokeAll(ctx context.Context, userID uint64, except string) (int, error) {
+	q := s.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if except != "" {
+		q = q.Where("id <> ?", except)
+	}
+	var list []models.Session
+	if err := q.Find(&list).Error; err != nil {
+		return 0, err
+	}
+	if len(list) == 0 {
+		return 0, nil
+	}
+	return len(list), s.revoke(ctx, list)
+}
+
+// revoke 先写墓碑再标记数据库。墓碑没写进去时旧的归属缓存仍然有效，撤销不会生效，
+// 所以写失败直接返回错误；此时数据库未改动，调用方重试时仍能找到这些会话
+func (s *Store) revoke(ctx context.Context, list []models.Session) error {
+	ids := make([]string, len(list))
+	pipe := s.rdb.Pipeline()
+	for i, sess := range list {
+		ids[i] = sess.ID
+		if ttl := time.Until(sess.ExpiresAt); ttl > 0 {
+			pipe.Set(ctx, cacheKey(sess.ID), tombstone, ttl)
+		} else {
+			pipe.Del(ctx, cacheKey(sess.ID))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RunCleaner 定期删除过期超过 retention 的会话与 refresh token
+func (s *Store) RunCleaner(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		before := time.Now().Add(-retention)
+		if err := s.db.WithContext(ctx).
+			Where("expires_at < ?", before).
+			Delete(&models.RefreshToken{}).Error; err != nil {
+			logx.Errorf("clean refresh tokens: %v", err)
+		}
+		if err := s.db.WithContext(ctx).
+			Where("expires_at < ?", before).
+			Delete(&models.Session{}).Error; err != nil {
+			logx.Errorf("clean sessions: %v", err)
+		}
+	}
+}
+
+func (s *Store) find(ctx context.Context, sid string) (*models.Session, error) {
+	var sess models.Session
+	err := s.db.WithContext(ctx).Where("id = ?", sid).First(&sess).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && time.Now().After(sess.ExpiresAt)) {
+		return nil, errorx.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// cache 写入缓存直到会话过期，只用于有效会话的归属和回源时的回填：写失败时键不存在或仍为旧值，
+// 下次请求回源数据库即可。撤销不能依赖它，见 revoke
+func (s *Store) cache(ctx context.Context, sid, val string, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Millisecond {
+		_ = s.rdb.Del(ctx, cacheKey(sid)).Err()
+		return
+	}
+	if err := setUnlessRevoked.Run(ctx, s.rdb, []string{cacheKey(sid)}, tombstone, val, ttl.Milliseconds()).Err(); err != nil {
+		logx.Errorf("cache session %s: %v", sid, err)
+	}
+}
+
+func (s *Store) touch(ctx context.Context, sid string) {
+	ok, err := s.rdb.SetNX(ctx, seenPrefix+sid, 1, seenInterval).Result()
+	if err != nil || !ok {
+		return
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ?", sid).
+		Update("last_seen_at", time.Now()).Error; err != nil {
+		logx.Errorf("touch session %s: %v", sid, err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
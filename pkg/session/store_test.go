@@ -0,0 +1,138 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/errorx"
+	"asum/pkg/rdb"
+	"asum/pkg/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewStore(&db.DB{DB: gdb}, &rdb.Client{Client: client}, nil)
+}
+
+// login 模拟一次登录：新建会话并签发第一个 refresh token
+func login(t *testing.T, s *Store, userID uint64) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	sess, err := s.Create(ctx, userID, "test", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.IssueRefresh(ctx, sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess.ID, raw
+}
+
+func TestRotate(t *testing.T) {
+	ctx, s := context.Background(), newTestStore(t)
+	sid, first := login(t, s, 7)
+
+	sess, second, err := s.Rotate(ctx, first, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if sess.ID != sid || sess.UserID != 7 {
+		t.Errorf("rotated session = %s of user %d, want %s of user 7", sess.ID, sess.UserID, sid)
+	}
+	if second == "" || second == first {
+		t.Fatalf("rotation returned %q, want a new token", second)
+	}
+	if time.Until(sess.ExpiresAt) < time.Hour {
+		t.Errorf("session expiry not extended: %s", sess.ExpiresAt)
+	}
+
+	// 新 token 同样只能用一次，可以继续轮换
+	if _, _, err := s.Rotate(ctx, second, time.Now().Add(2*time.Hour)); err != nil {
+		t.Errorf("rotate the rotated token: %v", err)
+	}
+	if ok, err := s.Active(ctx, 7, sid); err != nil || !ok {
+		t.Errorf("Active after rotation = %v, %v, want true", ok, err)
+	}
+}
+
+func TestRotateReuseRevokesFamily(t *testing.T) {
+	ctx, s := context.Background(), newTestStore(t)
+	sid, first := login(t, s, 7)
+	otherSID, otherRaw := login(t, s, 7)
+
+	_, second, err := s.Rotate(ctx, first, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧 token 再次出现视为泄露：报错并撤销整个家族
+	if _, _, err := s.Rotate(ctx, first, time.Now().Add(time.Hour)); !errors.Is(err, errorx.ErrRefreshReused) {
+		t.Fatalf("reuse: err = %v, want ErrRefreshReused", err)
+	}
+	if ok, _ := s.Active(ctx, 7, sid); ok {
+		t.Error("session still active after reuse")
+	}
+	// 家族中后来签发的 token（可能已落入攻击者手中）也随之作废
+	if _, _, err := s.Rotate(ctx, second, time.Now().Add(time.Hour)); !errors.Is(err, errorx.ErrSessionRevoked) {
+		t.Errorf("rotate the newer token: err = %v, want ErrSessionRevoked", err)
+	}
+
+	// 同一用户的其他会话不受影响
+	if ok, _ := s.Active(ctx, 7, otherSID); !ok {
+		t.Error("other session revoked")
+	}
+	if _, _, err := s.Rotate(ctx, otherRaw, time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("rotate in the other session: %v", err)
+	}
+}
+
+func TestRotateRejectsUnknownToken(t *testing.T) {
+	ctx, s := context.Background(), newTestStore(t)
+	login(t, s, 7)
+
+	for _, raw := range []string{"", "not-a-refresh-token"} {
+		if _, _, err := s.Rotate(ctx, raw, time.Now().Add(time.Hour)); !errors.Is(err, errorx.ErrTokenInvalid) {
+			t.Errorf("Rotate(%q): err = %v, want ErrTokenInvalid", raw, err)
+		}
+	}
+}
+
+func TestRotateRejectsAccessToken(t *testing.T) {
+	ctx, s := context.Background(), newTestStore(t)
+	sid, raw := login(t, s, 7)
+
+	// 把 access token 提交到刷新接口：它不是任何会话签发的 refresh token，不能换来新令牌
+	access, err := token.NewManager(token.Config{Secret: "secret"}, nil).GenerateAccessToken(7, "a@b.c", 1, sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Rotate(ctx, access, time.Now().Add(time.Hour)); !errors.Is(err, errorx.ErrTokenInvalid) {
+		t.Fatalf("Rotate(access token): err = %v, want ErrTokenInvalid", err)
+	}
+	// 也不会被当成旧 token 重放而撤销会话
+	if ok, _ := s.Active(ctx, 7, sid); !ok {
+		t.Error("session revoked by an access token")
+	}
+	if _, _, err := s.Rotate(ctx, raw, time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("rotate the real refresh token: %v", err)
+	}
+}
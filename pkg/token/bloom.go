@@ -0,0 +1,80 @@
+package token
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+// bloom 为固定大小的布隆过滤器，只用于判断 jti 一定不在黑名单中
+type bloom struct {
+	bits []uint64
+	k    uint32
+}
+
+func newBloom(m, k uint32) *bloom {
+	return &bloom{bits: make([]uint64, (m+63)/64), k: k}
+}
+
+func (b *bloom) positions(key string, fn func(uint32)) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	m := uint32(len(b.bits) * 64)
+	for i := uint32(0); i < b.k; i++ {
+		fn((h1 + i*h2) % m)
+	}
+}
+
+func (b *bloom) Add(key string) {
+	b.positions(key, func(p uint32) { b.bits[p/64] |= 1 << (p % 64) })
+}
+
+func (b *bloom) Test(key string) bool {
+	ok := true
+	b.positions(key, func(p uint32) {
+		if b.bits[p/64]&(1<<(p%64)) == 0 {
+			ok = false
+		}
+	})
+	return ok
+}
+
+// lru 缓存布隆过滤器命中后向 Redis 确认的结果
+type lru struct {
+	cap   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	val bool
+}
+
+func newLRU(cap int) *lru {
+	return &lru{cap: cap, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lru) Get(key string) (val, ok bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return false, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).val, true
+}
+
+func (c *lru) Put(key string, val bool) {
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).val = val
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, val: val})
+	if c.ll.Len() > c.cap {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.items, last.Value.(*lruEntry).key)
+	}
+}
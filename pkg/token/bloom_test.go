@@ -0,0 +1,47 @@
+package token
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	b := newBloom(1<<16, 4)
+	for i := 0; i < 1000; i++ {
+		b.Add("jti-" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !b.Test("jti-" + strconv.Itoa(i)) {
+			t.Fatalf("Test(jti-%d) = false after Add", i)
+		}
+	}
+	fp := 0
+	for i := 1000; i < 11000; i++ {
+		if b.Test("jti-" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if fp > 100 {
+		t.Errorf("false positives = %d/10000, want <= 100", fp)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.Put("a", true)
+	c.Put("b", false)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) missing")
+	}
+	c.Put("c", true)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) present, want evicted")
+	}
+	if v, ok := c.Get("a"); !ok || !v {
+		t.Errorf("Get(a) = %v, %v, want true, true", v, ok)
+	}
+	c.Put("c", false)
+	if v, _ := c.Get("c"); v {
+		t.Error("Get(c) = true after overwrite")
+	}
+}
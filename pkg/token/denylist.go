@@ -0,0 +1,147 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"asum/pkg/logx"
+	"asum/pkg/rdb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// denyKey 为 jti -> 过期时间戳的有序集合，过期的成员在重新加载时清理
+	denyKey     = "auth:denylist"
+	denyChannel = "auth:denylist"
+
+	bloomBits   = 1 << 20
+	bloomHashes = 4
+	lruSize     = 4096
+)
+
+// Denylist 记录提前作废的 access token（按 jti）。
+// 每个实例在本地维护黑名单的布隆过滤器，绝大多数请求不在过滤器中，无需访问 Redis；
+// 命中时再向 Redis 确认，确认结果放入 LRU。新增的 jti 经 Redis 频道广播给其他实例
+type Denylist struct {
+	rdb *rdb.Client
+
+	mu    sync.Mutex
+	bloom *bloom
+	seen  *lru
+}
+
+func NewDenylist(cache *rdb.Client) *Denylist {
+	d := &Denylist{rdb: cache}
+	if err := d.Load(context.Background()); err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Deny 作废 jti，直到令牌本身在 exp 过期
+func (d *Denylist) Deny(ctx context.Context, jti string, exp time.Time) error {
+	if jti == "" || !time.Now().Before(exp) {
+		return nil
+	}
+	_, err := d.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, denyKey, redis.Z{Score: float64(exp.Unix()), Member: jti})
+		p.Publish(ctx, denyChannel, jti)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.add(jti)
+	return nil
+}
+
+// Denied 判断 jti 是否已作废；布隆过滤器未命中时不访问 Redis
+func (d *Denylist) Denied(ctx context.Context, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	d.mu.Lock()
+	maybe := d.bloom.Test(jti)
+	denied, known := d.seen.Get(jti)
+	d.mu.Unlock()
+	if !maybe {
+		return false, nil
+	}
+	if known {
+		return denied, nil
+	}
+
+	err := d.rdb.ZScore(ctx, denyKey, jti).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+	denied = err == nil
+	d.mu.Lock()
+	d.seen.Put(jti, denied)
+	d.mu.Unlock()
+	return denied, nil
+}
+
+// Load 清理已过期的成员，并用 Redis 中的黑名单重建本地过滤器
+func (d *Denylist) Load(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := d.rdb.ZRemRangeByScore(ctx, denyKey, "-inf", now).Err(); err != nil {
+		return err
+	}
+	jtis, err := d.rdb.ZRange(ctx, denyKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	b := newBloom(bloomBits, bloomHashes)
+	for _, jti := range jtis {
+		b.Add(jti)
+	}
+	d.mu.Lock()
+	d.bloom = b
+	d.seen = newLRU(lruSize)
+	d.mu.Unlock()
+	return nil
+}
+
+// Run 接收其他实例作废的 jti；每隔 interval 全量重建一次，兜底错过的通知并剔除已过期的成员
+func (d *Denylist) Run(ctx context.Context, interval time.Duration) error {
+	sub := d.rdb.Subscribe(ctx, denyChannel)
+	defer sub.Close()
+	msgs := sub.Channel()
+
+	// 订阅建立前作废的 jti 由这次加载补上
+	if err := d.Load(ctx); err != nil {
+		logx.Errorf("load token denylist: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			d.add(msg.Payload)
+		case <-ticker.C:
+			if err := d.Load(ctx); err != nil {
+				logx.Errorf("load token denylist: %v", err)
+			}
+		}
+	}
+}
+
+func (d *Denylist) add(jti string) {
+	d.mu.Lock()
+	d.bloom.Add(jti)
+	d.seen.Put(jti, true)
+	d.mu.Unlock()
+}
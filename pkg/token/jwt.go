@@ -1,9 +1,16 @@
 package token
 
 import (
+	"context"
+	"crypto/cipher"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"asum/pkg/rdb"
+	"asum/pkg/utils"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -13,66 +20,173 @@ var (
 )
 
 type Config struct {
-	Secret        string        `yaml:"secret"`
-	Issuer        string        `yaml:"issuer"`
-	AccessExpiry  time.Duration `yaml:"access_expiry"`
-	RefreshExpiry time.Duration `yaml:"refresh_expiry"`
+	// Algorithm 为签名算法：HS256（默认，使用 Secret）、RS256、ES256 或 EdDSA。
+	// 非对称算法的密钥保存在 Redis 中，按 RotateEvery 轮换，公钥通过 /.well-known/jwks.json 公布；
+	// 此时 Secret 只用于验证切换前签发的 HS256 令牌，切换满 AccessExpiry 后不再接受 HS256，可以删除
+	Algorithm   string        `mapstructure:"algorithm" yaml:"algorithm"`
+	Secret      string        `mapstructure:"secret" yaml:"secret"`
+	RotateEvery time.Duration `mapstructure:"rotate_every" yaml:"rotate_every"`
+	// KeyEncryptionKey 用于加密保存在 Redis 中的私钥，非对称算法必填；修改后需清空 Redis 中的密钥重新生成
+	KeyEncryptionKey string        `mapstructure:"key_encryption_key" yaml:"key_encryption_key"`
+	Issuer           string        `mapstructure:"issuer" yaml:"issuer"`
+	AccessExpiry     time.Duration `mapstructure:"access_expiry" yaml:"access_expiry"`
+	RefreshExpiry    time.Duration `mapstructure:"refresh_expiry" yaml:"refresh_expiry"`
 }
 
+// TypeAccess 为 access token 的 typ 声明。refresh token 是不透明的一次性令牌（见 session.Store），
+// 不是 JWT；没有该声明的旧令牌一律拒绝
+const TypeAccess = "access"
+
 type Claims struct {
+	Type   string `json:"typ"`
 	UserID uint64 `json:"userId"`
 	Email  string `json:"email"`
 	Level  int    `json:"level"`
+	// Impersonator 不为 0 时表示管理员模拟该用户登录
+	Impersonator uint64 `json:"imp,omitempty"`
+	// SessionID 为签发令牌的登录会话，撤销会话后令牌立即失效；模拟登录令牌没有会话
+	SessionID string `json:"sid,omitempty"`
+	// RegisteredClaims.ID 即 jti，每个令牌唯一，登出时按它加入 Denylist
 	jwt.RegisteredClaims
 }
 
 type Manager struct {
 	cfg Config
+	// rdb 保存非对称算法的签名密钥，使用 HS256 时为 nil
+	rdb *rdb.Client
+	// aead 加解密 rdb 中的私钥
+	aead cipher.AEAD
+	// switchedAt 为切换到非对称算法的时间，hsCutoff 之后不再接受 HS256，见 loadSwitchTime
+	switchedAt time.Time
+	hsCutoff   time.Time
+
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	loadedAt time.Time
 }
 
-func NewManager(cfg Config) *Manager {
+// NewManager 使用非对称算法时从 cache 加载签名密钥，还没有密钥时生成第一把
+func NewManager(cfg Config, cache *rdb.Client) *Manager {
 	if cfg.AccessExpiry == 0 {
 		cfg.AccessExpiry = 24 * time.Hour
 	}
 	if cfg.RefreshExpiry == 0 {
 		cfg.RefreshExpiry = 7 * 24 * time.Hour
 	}
-	return &Manager{cfg: cfg}
+	if cfg.RotateEvery == 0 {
+		cfg.RotateEvery = 30 * 24 * time.Hour
+	}
+	if cfg.Algorithm == "" || cfg.Algorithm == "HS256" {
+		cfg.Algorithm = "HS256"
+		return &Manager{cfg: cfg}
+	}
+
+	if _, err := signingMethod(cfg.Algorithm); err != nil {
+		panic(err)
+	}
+	if cfg.RotateEvery < 2*keyPublishAhead {
+		panic(fmt.Sprintf("jwt rotate_every must be at least %s", 2*keyPublishAhead))
+	}
+	if cfg.KeyEncryptionKey == "" {
+		panic(fmt.Sprintf("jwt key_encryption_key is required for %s", cfg.Algorithm))
+	}
+	aead, err := newKeyCipher(cfg.KeyEncryptionKey)
+	if err != nil {
+		panic(err)
+	}
+	m := &Manager{cfg: cfg, rdb: cache, aead: aead}
+	ctx := context.Background()
+	if err := m.loadSwitchTime(ctx); err != nil {
+		panic(err)
+	}
+	if err := m.Load(ctx); err != nil {
+		panic(err)
+	}
+	if len(m.keys) == 0 {
+		// 多个实例同时首次启动时可能各生成一把，都会出现在 JWKS 中，不影响验证
+		if err := m.addKey(ctx, time.Now()); err != nil {
+			panic(err)
+		}
+		if err := m.Load(ctx); err != nil {
+			panic(err)
+		}
+	}
+	return m
 }
 
-func (m *Manager) GenerateAccessToken(userID uint64, email string, level int) (string, error) {
-	return m.generateToken(userID, email, level, m.cfg.AccessExpiry)
+// RefreshExpiry 为 refresh token 的有效期，会话在这段时间内不刷新即过期
+func (m *Manager) RefreshExpiry() time.Duration {
+	return m.cfg.RefreshExpiry
 }
 
-func (m *Manager) GenerateRefreshToken(userID uint64, email string, level int) (string, error) {
-	return m.generateToken(userID, email, level, m.cfg.RefreshExpiry)
+func (m *Manager) GenerateAccessToken(userID uint64, email string, level int, sessionID string) (string, error) {
+	return m.sign(Claims{UserID: userID, Email: email, Level: level, SessionID: sessionID}, m.cfg.AccessExpiry)
 }
 
-func (m *Manager) generateToken(userID uint64, email string, level int, expiry time.Duration) (string, error) {
+// ImpersonationExpiry 为模拟登录令牌的有效期，不签发 refresh token
+const ImpersonationExpiry = 30 * time.Minute
+
+// GenerateImpersonationToken 为管理员签发模拟 userID 的短期 access token
+func (m *Manager) GenerateImpersonationToken(userID uint64, email string, level int, adminID uint64) (string, error) {
+	return m.sign(Claims{UserID: userID, Email: email, Level: level, Impersonator: adminID}, ImpersonationExpiry)
+}
+
+func (m *Manager) sign(claims Claims, expiry time.Duration) (string, error) {
 	now := time.Now()
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Level:  level,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    m.cfg.Issuer,
-			Subject:   email,
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.cfg.Secret))
+	claims.Type = TypeAccess
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    m.cfg.Issuer,
+		Subject:   claims.Email,
+		ID:        utils.GenerateRandomKey(16),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+	}
+
+	if m.cfg.Algorithm == "HS256" {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(m.cfg.Secret))
+	}
+
+	key, err := m.current()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// acceptHS256 判断使用非对称算法时是否还接受切换前签发的 HS256 令牌
+func (m *Manager) acceptHS256() bool {
+	return m.cfg.Algorithm != "HS256" && m.cfg.Secret != "" && time.Now().Before(m.hsCutoff)
 }
 
-func (m *Manager) ParseToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// ParseToken 校验签名、有效期与令牌类型，是验证 access token 的唯一入口
+func (m *Manager) ParseToken(ctx context.Context, tokenString string) (*Claims, error) {
+	methods := []string{m.cfg.Algorithm}
+	if m.acceptHS256() {
+		methods = append(methods, "HS256")
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			if m.cfg.Algorithm == "HS256" {
+				return []byte(m.cfg.Secret), nil
+			}
+			// 切换后只接受此前签发的旧令牌
+			claims, ok := t.Claims.(*Claims)
+			if !ok || claims.IssuedAt == nil || !claims.IssuedAt.Before(m.switchedAt) {
+				return nil, ErrInvalidToken
+			}
+			return []byte(m.cfg.Secret), nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		key, ok := m.verifyKey(ctx, kid)
+		if !ok || key.method.Alg() != t.Method.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return []byte(m.cfg.Secret), nil
-	})
+		return key.private.Public(), nil
+	}, jwt.WithValidMethods(methods))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -82,28 +196,9 @@ func (m *Manager) ParseToken(tokenString string) (*Claims, error) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.Type != TypeAccess {
 		return nil, ErrInvalidToken
 	}
 
 	return claims, nil
 }
-
-func (m *Manager) RefreshToken(refreshToken string) (string, string, error) {
-	claims, err := m.ParseToken(refreshToken)
-	if err != nil {
-		return "", "", err
-	}
-
-	accessToken, err := m.GenerateAccessToken(claims.UserID, claims.Email, claims.Level)
-	if err != nil {
-		return "", "", err
-	}
-
-	newRefreshToken, err := m.GenerateRefreshToken(claims.UserID, claims.Email, claims.Level)
-	if err != nil {
-		return "", "", err
-	}
-
-	return accessToken, newRefreshToken, nil
-}
@@ -0,0 +1,174 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestManager(t *testing.T, alg string) *Manager {
+	t.Helper()
+	m := &Manager{cfg: Config{Algorithm: alg, AccessExpiry: time.Hour}}
+	if alg == "HS256" {
+		m.cfg.Secret = "secret"
+		return m
+	}
+	private, err := generateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, _ := signingMethod(alg)
+	m.keys = map[string]*signingKey{
+		"k1": {kid: "k1", method: method, private: private, activeAt: time.Now().Add(-time.Hour)},
+	}
+	m.loadedAt = time.Now()
+	if m.aead, err = newKeyCipher("kek"); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, alg := range []string{"HS256", "RS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			m := newTestManager(t, alg)
+			s, err := m.GenerateAccessToken(7, "a@b.c", 1, "sid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := m.ParseToken(context.Background(), s)
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if claims.UserID != 7 || claims.SessionID != "sid" {
+				t.Errorf("claims = %+v", claims)
+			}
+			keys := m.JWKS().Keys
+			if alg == "HS256" {
+				if len(keys) != 0 {
+					t.Errorf("JWKS has %d keys for HS256", len(keys))
+				}
+				return
+			}
+			if len(keys) != 1 || keys[0].Kid != "k1" || keys[0].Alg != alg {
+				t.Errorf("JWKS = %+v", keys)
+			}
+		})
+	}
+}
+
+func TestParseRejectsForeignKeys(t *testing.T) {
+	m := newTestManager(t, "ES256")
+	other := newTestManager(t, "ES256")
+	s, _ := other.GenerateAccessToken(7, "a@b.c", 1, "sid")
+	if _, err := m.ParseToken(context.Background(), s); err != ErrInvalidToken {
+		t.Errorf("token from another key: err = %v, want ErrInvalidToken", err)
+	}
+
+	// 没有配置 secret 时不接受 HS256，防止用公钥冒充 HMAC 密钥
+	claims := Claims{Type: TypeAccess, UserID: 7}
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	tk := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tk.Header["kid"] = "k1"
+	s, _ = tk.SignedString([]byte(""))
+	if _, err := m.ParseToken(context.Background(), s); err != ErrInvalidToken {
+		t.Errorf("HS256 token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestParseRejectsOtherTypes(t *testing.T) {
+	m := newTestManager(t, "HS256")
+	for _, typ := range []string{"", "refresh", "ACCESS"} {
+		claims := Claims{Type: typ, UserID: 7}
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if _, err := m.ParseToken(context.Background(), s); err != ErrInvalidToken {
+			t.Errorf("typ %q: err = %v, want ErrInvalidToken", typ, err)
+		}
+	}
+}
+
+func TestPublicJWK(t *testing.T) {
+	m := newTestManager(t, "EdDSA")
+	j := m.JWKS().Keys[0]
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if j.Kty != "OKP" || j.Crv != "Ed25519" || err != nil || len(x) != 32 {
+		t.Errorf("JWK = %+v", j)
+	}
+
+	m = newTestManager(t, "RS256")
+	j = m.JWKS().Keys[0]
+	if j.Kty != "RSA" || j.E != "AQAB" {
+		t.Errorf("JWK = %+v", j)
+	}
+}
+
+func TestStoredKeyEncrypted(t *testing.T) {
+	m := newTestManager(t, "ES256")
+	k := m.keys["k1"]
+	data, err := m.encodeKey("k1", k.private, k.activeAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sk storedKey
+	if err := json.Unmarshal(data, &sk); err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(k.private)
+	if bytes.Contains(sk.Key, der) {
+		t.Fatal("private key stored in plaintext")
+	}
+
+	got, err := m.decodeKey("k1", &sk)
+	if err != nil {
+		t.Fatalf("decodeKey: %v", err)
+	}
+	if !got.private.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(k.private.Public()) {
+		t.Error("decoded key differs")
+	}
+	if _, err := m.decodeKey("k2", &sk); err == nil {
+		t.Error("key decoded under another kid")
+	}
+	other := newTestManager(t, "ES256")
+	other.aead, _ = newKeyCipher("another kek")
+	if _, err := other.decodeKey("k1", &sk); err == nil {
+		t.Error("key decoded with another key encryption key")
+	}
+}
+
+func TestHS256Cutoff(t *testing.T) {
+	m := newTestManager(t, "ES256")
+	m.cfg.Secret = "secret"
+	m.switchedAt = time.Now().Add(-10 * time.Minute)
+	m.hsCutoff = m.switchedAt.Add(m.cfg.AccessExpiry)
+
+	hs256 := func(issuedAt time.Time) string {
+		claims := Claims{Type: TypeAccess, UserID: 7}
+		claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(24 * time.Hour))
+		s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		return s
+	}
+	old, fresh := hs256(time.Now().Add(-20*time.Minute)), hs256(time.Now())
+
+	if _, err := m.ParseToken(context.Background(), old); err != nil {
+		t.Errorf("token issued before the switch: err = %v", err)
+	}
+	if _, err := m.ParseToken(context.Background(), fresh); err != ErrInvalidToken {
+		t.Errorf("token issued after the switch: err = %v, want ErrInvalidToken", err)
+	}
+
+	// 过了切换时间加 AccessExpiry，即使 exp 未到、secret 仍在也不再接受
+	m.switchedAt = time.Now().Add(-2 * time.Hour)
+	m.hsCutoff = m.switchedAt.Add(m.cfg.AccessExpiry)
+	if _, err := m.ParseToken(context.Background(), hs256(time.Now().Add(-3*time.Hour))); err != ErrInvalidToken {
+		t.Errorf("token after the cutoff: err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,352 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"asum/pkg/logx"
+	"asum/pkg/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// keysKey 为 kid -> 签名密钥的哈希表，所有实例共用。私钥用 KeyEncryptionKey 加密后保存，
+	// 只拿到 Redis 的读权限不能伪造令牌
+	keysKey       = "auth:jwt:keys"
+	rotateLockKey = "auth:jwt:rotate"
+	// switchedKey 记录首次以非对称算法启动的时间（Unix 秒），此后签发的 HS256 令牌一律拒绝
+	switchedKey = "auth:jwt:switched_at"
+
+	// keyPublishAhead 新密钥先在 JWKS 中公布这么久才用于签名，留给其他实例和下游服务刷新公钥
+	keyPublishAhead = time.Hour
+	// keyRetireGrace 为淘汰旧密钥时额外保留的时间，容忍各实例间的时钟偏差
+	keyRetireGrace = 5 * time.Minute
+	// keyReloadMinInterval 限制遇到未知 kid 时重新加载的频率，避免被伪造的 kid 打满 Redis
+	keyReloadMinInterval = time.Minute
+)
+
+// storedKey 为 Redis 中保存的签名密钥，Key 为 AES-GCM 加密的 PKCS#8 DER，以 kid 作为附加数据，
+// 换到别的 kid 下无法解密
+type storedKey struct {
+	Alg      string    `json:"alg"`
+	Key      []byte    `json:"key"`
+	ActiveAt time.Time `json:"activeAt"`
+}
+
+type signingKey struct {
+	kid      string
+	method   jwt.SigningMethod
+	private  crypto.Signer
+	activeAt time.Time
+}
+
+// signingMethod 返回支持的非对称签名算法，HS256 不在此列
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case "RS256":
+		return jwt.SigningMethodRS256, nil
+	case "ES256":
+		return jwt.SigningMethodES256, nil
+	case "EdDSA":
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+}
+
+// newKeyCipher 由配置的 KeyEncryptionKey 派生加密私钥用的 AES-GCM，做法与 totp.Cipher 相同
+func newKeyCipher(kek string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(kek))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeKey 加密私钥，返回写入 Redis 的 JSON
+func (m *Manager) encodeKey(kid string, private crypto.Signer, activeAt time.Time) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := m.aead.Seal(nonce, nonce, der, []byte(kid))
+	return json.Marshal(&storedKey{Alg: m.cfg.Algorithm, Key: sealed, ActiveAt: activeAt})
+}
+
+func (m *Manager) decodeKey(kid string, sk *storedKey) (*signingKey, error) {
+	method, err := signingMethod(sk.Alg)
+	if err != nil {
+		return nil, err
+	}
+	n := m.aead.NonceSize()
+	if len(sk.Key) < n {
+		return nil, fmt.Errorf("decrypt jwt key %s: too short", kid)
+	}
+	der, err := m.aead.Open(nil, sk.Key[:n], sk.Key[n:], []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt jwt key %s: %w", kid, err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt key %s: %w", kid, err)
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("parse jwt key %s: unexpected type %T", kid, parsed)
+	}
+	return &signingKey{kid: kid, method: method, private: private, activeAt: sk.ActiveAt}, nil
+}
+
+// loadSwitchTime 读取切换到非对称算法的时间，首次启动时写入当前时间。
+// 切换前签发的 HS256 令牌最多再存活到 hsCutoff，之后即使仍配置了 secret 也不再接受
+func (m *Manager) loadSwitchTime(ctx context.Context) error {
+	if err := m.rdb.SetNX(ctx, switchedKey, time.Now().Unix(), 0).Err(); err != nil {
+		return err
+	}
+	sec, err := m.rdb.Get(ctx, switchedKey).Int64()
+	if err != nil {
+		return err
+	}
+	m.switchedAt = time.Unix(sec, 0)
+	m.hsCutoff = m.switchedAt.Add(max(m.cfg.AccessExpiry, ImpersonationExpiry) + keyRetireGrace)
+	return nil
+}
+
+// current 返回已生效的密钥中最新的一个，用于签名
+func (m *Manager) current() (*signingKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var cur *signingKey
+	for _, k := range m.keys {
+		if k.activeAt.After(now) {
+			continue
+		}
+		if cur == nil || k.activeAt.After(cur.activeAt) {
+			cur = k
+		}
+	}
+	if cur == nil {
+		return nil, fmt.Errorf("no active jwt signing key")
+	}
+	return cur, nil
+}
+
+// verifyKey 按 kid 查找公钥；本地没有时从 Redis 重新加载，以跟上其他实例的轮换
+func (m *Manager) verifyKey(ctx context.Context, kid string) (*signingKey, bool) {
+	m.mu.RLock()
+	k, ok := m.keys[kid]
+	stale := time.Since(m.loadedAt) >= keyReloadMinInterval
+	m.mu.RUnlock()
+	if ok || !stale || m.rdb == nil {
+		return k, ok
+	}
+
+	if err := m.Load(ctx); err != nil {
+		logx.Errorf("reload jwt keys: %v", err)
+		return nil, false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok = m.keys[kid]
+	return k, ok
+}
+
+// Load 从 Redis 读取全部签名密钥，替换本地缓存
+func (m *Manager) Load(ctx context.Context) error {
+	vals, err := m.rdb.HGetAll(ctx, keysKey).Result()
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*signingKey, len(vals))
+	for kid, val := range vals {
+		var sk storedKey
+		if err := json.Unmarshal([]byte(val), &sk); err != nil {
+			return fmt.Errorf("decode jwt key %s: %w", kid, err)
+		}
+		k, err := m.decodeKey(kid, &sk)
+		if err != nil {
+			return err
+		}
+		keys[kid] = k
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// addKey 生成 cfg.Algorithm 的新密钥，自 activeAt 起用于签名
+func (m *Manager) addKey(ctx context.Context, activeAt time.Time) error {
+	private, err := generateKey(m.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	kid := utils.GenerateRandomKey(8)
+	data, err := m.encodeKey(kid, private, activeAt)
+	if err != nil {
+		return err
+	}
+	return m.rdb.HSet(ctx, keysKey, kid, data).Err()
+}
+
+// Rotate 在最新密钥即将到期时提前生成下一把密钥，并删除已无有效令牌的旧密钥。
+// 多个实例同时运行时只有拿到锁的一个执行
+func (m *Manager) Rotate(ctx context.Context) error {
+	ok, err := m.rdb.SetNX(ctx, rotateLockKey, 1, time.Minute).Result()
+	if err != nil || !ok {
+		return err
+	}
+	defer m.rdb.Del(context.WithoutCancel(ctx), rotateLockKey)
+
+	if err := m.Load(ctx); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	keys := make([]*signingKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	m.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].activeAt.Before(keys[j].activeAt) })
+
+	now := time.Now()
+	if len(keys) == 0 || !now.Before(keys[len(keys)-1].activeAt.Add(m.cfg.RotateEvery-keyPublishAhead)) {
+		if err := m.addKey(ctx, now.Add(keyPublishAhead)); err != nil {
+			return err
+		}
+	}
+
+	// 一把密钥被下一把取代后，用它签发的令牌最多再存活 maxLifetime
+	maxLifetime := max(m.cfg.AccessExpiry, ImpersonationExpiry) + keyRetireGrace
+	var retired []string
+	for i := 0; i+1 < len(keys); i++ {
+		if keys[i+1].activeAt.Add(maxLifetime).Before(now) {
+			retired = append(retired, keys[i].kid)
+		}
+	}
+	if len(retired) > 0 {
+		if err := m.rdb.HDel(ctx, keysKey, retired...).Err(); err != nil {
+			return err
+		}
+	}
+	return m.Load(ctx)
+}
+
+// Run 每隔 interval 轮换一次密钥并重新加载；使用 HS256 时直接返回
+func (m *Manager) Run(ctx context.Context, interval time.Duration) error {
+	if m.rdb == nil {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.Rotate(ctx); err != nil {
+				logx.Errorf("rotate jwt keys: %v", err)
+			}
+			if err := m.Load(ctx); err != nil {
+				logx.Errorf("load jwt keys: %v", err)
+			}
+		}
+	}
+}
+
+// JWK 为 RFC 7517 中的公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 返回全部可用于验证的公钥，包括已公布但尚未生效的下一把密钥；使用 HS256 时为空
+func (m *Manager) JWKS() *JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := &JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, k := range m.keys {
+		out.Keys = append(out.Keys, publicJWK(k))
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].Kid < out.Keys[j].Kid })
+	return out
+}
+
+func publicJWK(k *signingKey) JWK {
+	b64 := base64.RawURLEncoding.EncodeToString
+	j := JWK{Use: "sig", Kid: k.kid, Alg: k.method.Alg()}
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = b64(pub.N.Bytes())
+		j.E = b64(bigEndian(pub.E))
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		j.Kty = "EC"
+		j.Crv = pub.Curve.Params().Name
+		j.X = b64(pub.X.FillBytes(make([]byte, size)))
+		j.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = b64(pub)
+	}
+	return j
+}
+
+func bigEndian(e int) []byte {
+	var b []byte
+	for ; e > 0; e >>= 8 {
+		b = append([]byte{byte(e)}, b...)
+	}
+	return b
+}
@@ -0,0 +1,41 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"asum/pkg/rdb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// revokeTTL 不短于 refresh token 的最长有效期，过期后早于该时间签发的令牌本身也已过期
+const revokeTTL = 30 * 24 * time.Hour
+
+func revokedKey(userID uint64) string {
+	return fmt.Sprintf("auth:revoked:%d", userID)
+}
+
+// RevokeUser 使 userID 在 at 之前签发的全部令牌失效，用于修改邮箱等需要重新登录的场景
+func RevokeUser(ctx context.Context, cache *rdb.Client, userID uint64, at time.Time) error {
+	return cache.Set(ctx, revokedKey(userID), at.Unix(), revokeTTL).Err()
+}
+
+// Revoked 判断令牌是否签发于用户最近一次 RevokeUser 之前
+func Revoked(ctx context.Context, cache *rdb.Client, claims *Claims) (bool, error) {
+	val, err := cache.Get(ctx, revokedKey(claims.UserID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	before, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || claims.IssuedAt == nil {
+		return false, nil
+	}
+	return claims.IssuedAt.Unix() < before, nil
+}
@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+type Config struct {
+	// Issuer 显示在验证器中的服务名，未配置时为 asum
+	Issuer string `yaml:"issuer"`
+	// Key 为加密保存 TOTP 密钥的服务端密钥，修改后已启用的两步验证都需要重新绑定
+	Key string `yaml:"key"`
+}
+
+// Cipher 使用 AES-GCM 加密保存在数据库中的 TOTP 密钥
+type Cipher struct {
+	aead   cipher.AEAD
+	issuer string
+}
+
+func NewCipher(cfg Config) (*Cipher, error) {
+	if cfg.Key == "" {
+		return nil, ErrEmptyKey
+	}
+	key := sha256.Sum256([]byte(cfg.Key))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = "asum"
+	}
+	return &Cipher{aead: aead, issuer: issuer}, nil
+}
+
+func (c *Cipher) Issuer() string {
+	return c.issuer
+}
+
+func (c *Cipher) Seal(secret string) string {
+	nonce := make([]byte, c.aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	return base64.RawStdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(secret), nil))
+}
+
+func (c *Cipher) Open(sealed string) (string, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return "", ErrInvalidSecret
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret 为 RFC 6238 附录 B 中 SHA1 的测试密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tc := range cases {
+		got, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tc.unix, err)
+		}
+		if got != tc.want {
+			t.Errorf("Code(%d) = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, Step(now)-1)
+	step, ok := Verify(rfcSecret, code, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("Verify(previous step) = %d, %v, want %d, true", step, ok, Step(now)-1)
+	}
+	old, _ := Code(rfcSecret, Step(now)-3)
+	if _, ok := Verify(rfcSecret, old, now); ok {
+		t.Error("Verify accepted a code outside the skew window")
+	}
+	if _, ok := Verify(rfcSecret, "12345", now); ok {
+		t.Error("Verify accepted a short code")
+	}
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher(Config{Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := GenerateSecret()
+	sealed := c.Seal(secret)
+	if strings.Contains(sealed, secret) {
+		t.Fatal("sealed secret contains plaintext")
+	}
+	got, err := c.Open(sealed)
+	if err != nil || got != secret {
+		t.Errorf("Open = %q, %v, want %q", got, err, secret)
+	}
+	other, _ := NewCipher(Config{Key: "other"})
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("Open with a different key succeeded")
+	}
+	if _, err := NewCipher(Config{}); err != ErrEmptyKey {
+		t.Errorf("NewCipher(empty) err = %v, want ErrEmptyKey", err)
+	}
+}
@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"asum/pkg/rdb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RetentionDays 为每日计数保留的天数
+const RetentionDays = 35
+
+const retention = RetentionDays * 24 * time.Hour
+
+const dayLayout = "20060102"
+
+func keyDayKey(taskID uint64, keyID string, day time.Time) string {
+	return fmt.Sprintf("usage:%d:%s:%s", taskID, keyID, day.UTC().Format(dayLayout))
+}
+
+func taskDayKey(taskID uint64, day time.Time) string {
+	return fmt.Sprintf("usage:task:%d:%s", taskID, day.UTC().Format(dayLayout))
+}
+
+func userDayKey(userID uint64, day time.Time) string {
+	return fmt.Sprintf("usage:user:%d:%s", userID, day.UTC().Format(dayLayout))
+}
+
+// Today 返回当前统计日（UTC）
+func Today() string {
+	return time.Now().UTC().Format(dayLayout)
+}
+
+// Incr 累加当天的调用量，同时计入 key、task 与用户三个维度
+func Incr(ctx context.Context, redisDB *rdb.Client, taskID, userID uint64, keyID string, n int64) error {
+	now := time.Now()
+	pipe := redisDB.Pipeline()
+	for _, key := range []string{
+		keyDayKey(taskID, keyID, now),
+		taskDayKey(taskID, now),
+		userDayKey(userID, now),
+	} {
+		pipe.IncrBy(ctx, key, n)
+		pipe.Expire(ctx, key, retention)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+type Daily struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// Days 返回某个 key 最近 days 天（含今天）的每日调用量，按日期升序
+func Days(ctx context.Context, redisDB *rdb.Client, taskID uint64, keyID string, days int) ([]Daily, error) {
+	return daily(ctx, redisDB, days, func(day time.Time) string {
+		return keyDayKey(taskID, keyID, day)
+	})
+}
+
+// TaskDays 返回 task 最近 days 天的每日调用量
+func TaskDays(ctx context.Context, redisDB *rdb.Client, taskID uint64, days int) ([]Daily, error) {
+	return daily(ctx, redisDB, days, func(day time.Time) string {
+		return taskDayKey(taskID, day)
+	})
+}
+
+// UserDays 返回用户名下全部 task 最近 days 天的每日调用量
+func UserDays(ctx context.Context, redisDB *rdb.Client, userID uint64, days int) ([]Daily, error) {
+	return daily(ctx, redisDB, days, func(day time.Time) string {
+		return userDayKey(userID, day)
+	})
+}
+
+func daily(ctx context.Context, redisDB *rdb.Client, days int, keyOf func(time.Time) string) ([]Daily, error) {
+	if days <= 0 {
+		days = 1
+	}
+	now := time.Now().UTC()
+	pipe := redisDB.Pipeline()
+	cmds := make([]*redis.StringCmd, days)
+	for i := 0; i < days; i++ {
+		cmds[i] = pipe.Get(ctx, keyOf(now.AddDate(0, 0, i-days+1)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	out := make([]Daily, days)
+	for i, cmd := range cmds {
+		n, _ := cmd.Int64()
+		out[i] = Daily{
+			Date:  now.AddDate(0, 0, i-days+1).Format(dayLayout),
+			Count: n,
+		}
+	}
+	return out, nil
+}
+
+// DeleteTask 删除 task 及其各 key 的全部每日计数，用户维度的计数保留
+func DeleteTask(ctx context.Context, redisDB *rdb.Client, taskID uint64) error {
+	return deleteMatching(ctx, redisDB,
+		fmt.Sprintf("usage:%d:*", taskID),
+		fmt.Sprintf("usage:task:%d:*", taskID),
+	)
+}
+
+// DeleteUser 删除用户维度的全部每日计数
+func DeleteUser(ctx context.Context, redisDB *rdb.Client, userID uint64) error {
+	return deleteMatching(ctx, redisDB, fmt.Sprintf("usage:user:%d:*", userID))
+}
+
+func deleteMatching(ctx context.Context, redisDB *rdb.Client, patterns ...string) error {
+	for _, pattern := range patterns {
+		var cursor uint64
+		for {
+			keys, next, err := redisDB.Scan(ctx, cursor, pattern, 200).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := redisDB.Del(ctx, keys...).Err(); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil
+}
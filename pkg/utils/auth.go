@@ -1,6 +1,12 @@
 package utils
 
-import "github.com/gofiber/fiber/v3"
+import (
+	"time"
+
+	"asum/pkg/models"
+
+	"github.com/gofiber/fiber/v3"
+)
 
 func GetUserID(c fiber.Ctx) uint64 {
 	if uid, ok := c.Locals("userID").(uint64); ok {
@@ -15,3 +21,49 @@ func GetUserLevel(c fiber.Ctx) int {
 	}
 	return 0
 }
+
+// GetImpersonatorID 返回模拟登录的管理员 ID，正常登录时为 0
+func GetImpersonatorID(c fiber.Ctx) uint64 {
+	if id, ok := c.Locals("impersonatorID").(uint64); ok {
+		return id
+	}
+	return 0
+}
+
+// GetSessionID 返回当前令牌所属的会话，模拟登录时为空
+func GetSessionID(c fiber.Ctx) string {
+	if sid, ok := c.Locals("sessionID").(string); ok {
+		return sid
+	}
+	return ""
+}
+
+// GetTokenID 返回当前 access token 的 jti
+func GetTokenID(c fiber.Ctx) string {
+	if jti, ok := c.Locals("tokenID").(string); ok {
+		return jti
+	}
+	return ""
+}
+
+// GetTokenExpiresAt 返回当前 access token 的过期时间
+func GetTokenExpiresAt(c fiber.Ctx) time.Time {
+	if exp, ok := c.Locals("tokenExpiresAt").(time.Time); ok {
+		return exp
+	}
+	return time.Time{}
+}
+
+func GetApiKey(c fiber.Ctx) string {
+	if key, ok := c.Locals("apiKey").(string); ok {
+		return key
+	}
+	return ""
+}
+
+func GetApiCache(c fiber.Ctx) *models.ApiCache {
+	if cache, ok := c.Locals("apiCache").(*models.ApiCache); ok {
+		return cache
+	}
+	return nil
+}
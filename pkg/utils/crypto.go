@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -58,3 +59,9 @@ func GenerateVerificationCode(length int) string {
 func GenerateConfirmToken() string {
 	return GenerateRandomToken(32)
 }
+
+// HashToken 返回一次性令牌的 SHA-256 十六进制摘要，库里只保存摘要
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
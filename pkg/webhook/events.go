@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"time"
+
+	"asum/pkg/models"
+)
+
+// 各事件 Envelope.Data 的内容
+
+type KeyRotatedData struct {
+	KeyPrefix        string     `json:"keyPrefix"`
+	PrevKeyPrefix    string     `json:"prevKeyPrefix,omitempty"`
+	PrevKeyExpiresAt *time.Time `json:"prevKeyExpiresAt,omitempty"`
+	RotatedBy        uint64     `json:"rotatedBy"`
+}
+
+type QuotaLowData struct {
+	Quota     int64 `json:"quota"`
+	Baseline  int64 `json:"baseline"`
+	Threshold int64 `json:"thresholdPct"`
+}
+
+type BulkFinishedData struct {
+	KeyPrefix string `json:"keyPrefix"`
+	Count     int    `json:"count"`
+	Quota     int64  `json:"quota"`
+}
+
+type MemberJoinedData struct {
+	UserID uint64          `json:"userId"`
+	Email  string          `json:"email"`
+	Role   models.TaskRole `json:"role"`
+}
+
+type WatchChangedData struct {
+	ItemID   uint64 `json:"itemId"`
+	ItemName string `json:"itemName"`
+	Changes  any    `json:"changes"`
+}
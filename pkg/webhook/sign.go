@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 投递请求头
+const (
+	HeaderEvent     = "X-Asum-Event"
+	HeaderDelivery  = "X-Asum-Delivery"
+	HeaderTimestamp = "X-Asum-Timestamp"
+	HeaderSignature = "X-Asum-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrSignature = errors.New("webhook signature mismatch")
+	ErrTimestamp = errors.New("webhook timestamp out of tolerance")
+)
+
+// Sign 对 "<timestamp>.<body>" 做 HMAC-SHA256，返回 X-Asum-Signature 的值
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 供接收方校验签名，时间戳与 now 相差超过 tolerance 视为重放
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestamp
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrTimestamp
+	}
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrSignature
+	}
+	return nil
+}
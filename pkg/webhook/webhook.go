@@ -0,0 +1,340 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"asum/pkg/db"
+	"asum/pkg/logx"
+	"asum/pkg/models"
+	"asum/pkg/queue"
+	"asum/pkg/rdb"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	readyQueueKey = "queue:webhooks"
+	// retryKey 为待重试投递的 ZSET，score 为下次尝试的 unix 秒，到期后移回 readyQueueKey
+	retryKey = "webhook:retry"
+
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 2 * time.Hour
+
+	sendTimeout   = 10 * time.Second
+	maxErrorBytes = 500
+
+	// staleAfter 为投递超过预期的下次尝试时间仍未更新即视为丢失的时长，
+	// 通常是出队后尚未完成时进程退出；重新入队后可能重复投递，接收方应按 X-Asum-Delivery 去重
+	staleAfter    = 15 * time.Minute
+	sweepInterval = time.Minute
+	sweepLockKey  = "webhook:sweep"
+	sweepBatch    = 100
+)
+
+// Job 为队列中的一次投递尝试
+type Job struct {
+	DeliveryID uint64 `json:"deliveryId"`
+}
+
+// Envelope 为推送给接收方的请求体
+type Envelope struct {
+	Event      string    `json:"event"`
+	TaskID     uint64    `json:"taskId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher 负责生成投递记录并通过 Redis 队列异步推送，失败时按指数退避重试
+type Dispatcher struct {
+	db     *db.DB
+	rdb    *rdb.Client
+	q      *queue.RedisQueue[*Job]
+	client *http.Client
+}
+
+func NewDispatcher(pg *db.DB, cache *rdb.Client) *Dispatcher {
+	return &Dispatcher{
+		db:     pg,
+		rdb:    cache,
+		q:      queue.NewRedisQueue[*Job](cache, readyQueueKey),
+		client: NewClient(sendTimeout),
+	}
+}
+
+// Publish 为 task 下订阅了该事件的每个启用中的 webhook 生成一条投递并入队
+func (d *Dispatcher) Publish(ctx context.Context, taskID uint64, event string, data any) error {
+	var hooks []models.TaskWebhook
+	if err := d.db.WithContext(ctx).
+		Where("task_id = ? AND enabled = ?", taskID, true).
+		Find(&hooks).Error; err != nil {
+		return err
+	}
+	var targets []models.TaskWebhook
+	for _, h := range hooks {
+		if h.Subscribes(event) {
+			targets = append(targets, h)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(&Envelope{Event: event, TaskID: taskID, OccurredAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+	deliveries := make([]models.WebhookDelivery, len(targets))
+	for i, h := range targets {
+		deliveries[i] = models.WebhookDelivery{
+			WebhookID: h.ID,
+			TaskID:    taskID,
+			Event:     event,
+			Payload:   string(body),
+		}
+	}
+	if err := d.db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return err
+	}
+	for _, dl := range deliveries {
+		if err := d.q.Push(ctx, &Job{DeliveryID: dl.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Go 在后台发布事件，业务流程不因 webhook 失败而失败
+func (d *Dispatcher) Go(taskID uint64, event string, data any) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := d.Publish(ctx, taskID, event, data); err != nil {
+			logx.Errorf("publish webhook %s of task %d: %v", event, taskID, err)
+		}
+	}()
+}
+
+// Replay 以原投递的内容生成一条新的投递，原记录保持不变
+func (d *Dispatcher) Replay(ctx context.Context, orig *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	dl := &models.WebhookDelivery{
+		WebhookID: orig.WebhookID,
+		TaskID:    orig.TaskID,
+		Event:     orig.Event,
+		Payload:   orig.Payload,
+		ReplayOf:  orig.ID,
+	}
+	if err := d.db.WithContext(ctx).Create(dl).Error; err != nil {
+		return nil, err
+	}
+	if err := d.q.Push(ctx, &Job{DeliveryID: dl.ID}); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// RunWorker 启动 workers 个投递协程，定期把到期的重试移回投递队列，并重新入队丢失的投递
+func (d *Dispatcher) RunWorker(ctx context.Context, workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go d.consume(ctx)
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sweep.C:
+			if err := d.sweep(ctx); err != nil {
+				logx.Errorf("sweep stale webhook deliveries: %v", err)
+			}
+			continue
+		case <-ticker.C:
+		}
+		if err := promoteScript.Run(ctx, d.rdb, []string{retryKey, readyQueueKey}, time.Now().Unix()).Err(); err != nil && !errors.Is(err, redis.Nil) {
+			logx.Errorf("promote webhook retries: %v", err)
+		}
+	}
+}
+
+// promoteScript 原子地把到期的重试从 ZSET 移到投递队列，多实例同时执行也不会重复投递
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, job in ipairs(due) do
+	if redis.call('ZREM', KEYS[1], job) == 1 then
+		redis.call('RPUSH', KEYS[2], job)
+	end
+end
+return #due
+`)
+
+// sweep 重新入队仍为待投递、但早已过了下次尝试时间的投递。多实例时只由拿到锁的一个执行
+func (d *Dispatcher) sweep(ctx context.Context) error {
+	ok, err := d.rdb.SetNX(ctx, sweepLockKey, 1, sweepInterval).Result()
+	if err != nil || !ok {
+		return err
+	}
+
+	// 失败过的投递在重试队列中最多等待 maxBackoff，超过这段时间仍未更新才算丢失
+	now := time.Now()
+	var pending []models.WebhookDelivery
+	if err := d.db.WithContext(ctx).
+		Select("id").
+		Where("status = ? AND ((attempts = 0 AND updated_at < ?) OR updated_at < ?)",
+			models.DeliveryPending, now.Add(-staleAfter), now.Add(-maxBackoff-staleAfter)).
+		Order("updated_at").
+		Limit(sweepBatch).
+		Find(&pending).Error; err != nil {
+		return err
+	}
+
+	for _, dl := range pending {
+		if err := d.db.WithContext(ctx).Model(&dl).Update("updated_at", now).Error; err != nil {
+			return err
+		}
+		if err := d.q.Push(ctx, &Job{DeliveryID: dl.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) consume(ctx context.Context) {
+	for {
+		job, err := d.q.Pop(ctx, 5*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, queue.ErrQueueTimeout) {
+				logx.Errorf("pop webhook job: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		if err := d.attempt(ctx, job.DeliveryID); err != nil {
+			logx.Errorf("deliver webhook %d: %v", job.DeliveryID, err)
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, id uint64) error {
+	var dl models.WebhookDelivery
+	if err := d.db.WithContext(ctx).First(&dl, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if dl.Status != models.DeliveryPending {
+		return nil
+	}
+
+	var hook models.TaskWebhook
+	err := d.db.WithContext(ctx).First(&hook, dl.WebhookID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !hook.Enabled):
+		dl.Status = models.DeliveryFailed
+		dl.Error = "webhook removed or disabled"
+		return d.save(ctx, &dl)
+	case err != nil:
+		return err
+	}
+
+	code, sendErr := Send(ctx, d.client, hook.URL, hook.Secret, &dl)
+	dl.Attempts++
+	dl.ResponseCode = code
+	if sendErr == nil {
+		dl.Status = models.DeliverySucceeded
+		dl.Error = ""
+		return d.save(ctx, &dl)
+	}
+
+	dl.Error = truncate(sendErr.Error(), maxErrorBytes)
+	if dl.Attempts >= MaxAttempts {
+		dl.Status = models.DeliveryFailed
+		return d.save(ctx, &dl)
+	}
+	if err := d.save(ctx, &dl); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(&Job{DeliveryID: dl.ID})
+	if err != nil {
+		return err
+	}
+	at := time.Now().Add(Backoff(dl.Attempts))
+	return d.rdb.ZAdd(ctx, retryKey, redis.Z{Score: float64(at.Unix()), Member: raw}).Err()
+}
+
+func (d *Dispatcher) save(ctx context.Context, dl *models.WebhookDelivery) error {
+	return d.db.WithContext(ctx).
+		Model(dl).
+		Select("status", "attempts", "response_code", "error", "updated_at").
+		Updates(dl).Error
+}
+
+// Backoff 返回第 attempts 次失败后距下次尝试的间隔：30s、1m、2m……封顶 2h
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := baseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return wait
+}
+
+// Send 发送一次带签名的投递，返回接收方的响应码；非 2xx 视为失败
+func Send(ctx context.Context, client *http.Client, url, secret string, dl *models.WebhookDelivery) (int, error) {
+	body := []byte(dl.Payload)
+	ts := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "asum-webhook/1.0")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(dl.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"asum/pkg/models"
+)
+
+func TestSendSigned(t *testing.T) {
+	const secret = "whsec_test"
+	var (
+		gotEvent    string
+		gotDelivery string
+		verifyErr   error
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotEvent = r.Header.Get(HeaderEvent)
+		gotDelivery = r.Header.Get(HeaderDelivery)
+		verifyErr = Verify(secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, 5*time.Minute, time.Now())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	dl := &models.WebhookDelivery{ID: 42, Event: models.EventKeyRotated, Payload: `{"event":"key.rotated"}`}
+	code, err := Send(context.Background(), srv.Client(), srv.URL, secret, dl)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("Send = %d, %v", code, err)
+	}
+	if verifyErr != nil {
+		t.Fatalf("receiver verify: %v", verifyErr)
+	}
+	if gotEvent != models.EventKeyRotated || gotDelivery != "42" {
+		t.Fatalf("headers: event=%q delivery=%q", gotEvent, gotDelivery)
+	}
+}
+
+func TestSendNon2xx(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	code, err := Send(context.Background(), srv.Client(), srv.URL, "s", &models.WebhookDelivery{Payload: "{}"})
+	if err == nil || code != http.StatusBadGateway {
+		t.Fatalf("Send = %d, %v; want 502 and error", code, err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{}`)
+	sig := Sign("s", now.Unix(), body)
+	ts := "1700000000"
+
+	if err := Verify("s", ts, sig, body, time.Minute, now); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	if err := Verify("other", ts, sig, body, time.Minute, now); err != ErrSignature {
+		t.Fatalf("wrong secret: %v", err)
+	}
+	if err := Verify("s", ts, sig, []byte(`{"x":1}`), time.Minute, now); err != ErrSignature {
+		t.Fatalf("tampered body: %v", err)
+	}
+	if err := Verify("s", ts, sig, body, time.Minute, now.Add(2*time.Minute)); err != ErrTimestamp {
+		t.Fatalf("stale timestamp: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		10: maxBackoff,
+	}
+	for n, want := range cases {
+		if got := Backoff(n); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := PublicIP(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached loopback server")
+	}))
+	defer srv.Close()
+
+	dl := &models.WebhookDelivery{ID: 1, Event: models.EventKeyRotated, Payload: `{}`}
+	_, err := Send(context.Background(), NewClient(time.Second), srv.URL, "whsec_test", dl)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Send to loopback: err = %v, want ErrPrivateAddress", err)
+	}
+	if err := CheckURL(context.Background(), "http://169.254.169.254/latest/meta-data"); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("CheckURL metadata: err = %v, want ErrPrivateAddress", err)
+	}
+}